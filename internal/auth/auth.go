@@ -2,43 +2,91 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
-	"fmt"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-// Create password hash for new users on sign-up
-func CreatePasswordHash(password string) ([]byte, error) {
-	pw := []byte(password)
+// Settings for issuing and validating tokens
+type TokenConfig struct {
+	Keys            *KeySet
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	Issuer          string
+	Audience        string        // Left out of tokens and not checked when empty
+	ClockSkew       time.Duration // Leeway allowed for exp, nbf and iat between servers
+}
 
-	newHash, err := bcrypt.GenerateFromPassword(pw, 12)
-	if err != nil {
-		return []byte{}, err
+// Token settings used unless configured otherwise
+func DefaultTokenConfig(keys *KeySet) *TokenConfig {
+	return &TokenConfig{
+		Keys:            keys,
+		AccessTokenTTL:  1 * time.Hour,
+		RefreshTokenTTL: 60 * 24 * time.Hour,
+		Issuer:          "chirpy",
+		ClockSkew:       30 * time.Second,
 	}
+}
 
-	return newHash, nil
+// Claims carried by access tokens
+type AccessClaims struct {
+	jwt.RegisteredClaims
+	Role     string `json:"role,omitempty"`      // Role of the user, only set on a user's own session
+	ClientID string `json:"client_id,omitempty"` // Set on tokens issued to third-party (OAuth) clients
+	Scope    string `json:"scope,omitempty"`     // Space separated scopes granted to the client
+}
+
+// Scopes granted to a third-party client - nil for a user's own session, which is granted every scope
+func (claims *AccessClaims) Scopes() []string {
+	if claims.ClientID == "" {
+		return nil
+	}
+	return strings.Fields(claims.Scope)
+}
+
+// Effective role of the token - client tokens and tokens without a role claim only get the user role
+func (claims *AccessClaims) UserRole() string {
+	if claims.ClientID != "" || !ValidRole(claims.Role) {
+		return RoleUser
+	}
+	return claims.Role
 }
 
 // Create a new access token for a user
-func CreateAccessToken(userID uuid.UUID, JWTSecret []byte) (string, error) {
+func CreateAccessToken(userID uuid.UUID, role string, tokenCfg *TokenConfig) (string, error) {
+	return createAccessToken(userID, role, "", nil, tokenCfg)
+}
+
+// Create a new access token for a third-party client acting on behalf of a user
+func CreateClientAccessToken(userID uuid.UUID, clientID string, scopes []string, tokenCfg *TokenConfig) (string, error) {
+	return createAccessToken(userID, "", clientID, scopes, tokenCfg)
+}
+
+func createAccessToken(userID uuid.UUID, role, clientID string, scopes []string, tokenCfg *TokenConfig) (string, error) {
 	now := time.Now().UTC()
-	jwtExpiration := 1 * 60 * 60
 
-	claims := &jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(jwtExpiration) * time.Second)),
-		Subject:   userID.String(),
+	claims := &AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenCfg.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenCfg.AccessTokenTTL)),
+			Subject:   userID.String(),
+		},
+		Role:     role,
+		ClientID: clientID,
+		Scope:    strings.Join(scopes, " "),
+	}
+	if tokenCfg.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{tokenCfg.Audience}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedString, err := token.SignedString(JWTSecret)
+	signedString, err := tokenCfg.Keys.Sign(claims)
 	if err != nil {
 		return "", err
 	}
@@ -46,39 +94,55 @@ func CreateAccessToken(userID uuid.UUID, JWTSecret []byte) (string, error) {
 	return signedString, nil
 }
 
+// Extract the token from a "Bearer <token>" Authorization header
+func GetBearerToken(header string) (string, error) {
+	if !strings.HasPrefix(header, "Bearer ") {
+		return "", errors.New("invalid or missing Authorization header")
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")), nil
+}
+
 // Authorization request using an access token
-func AccessTokenAuth(header string, JWTSecret []byte) (uuid.UUID, error) {
-	var token string
-	if strings.HasPrefix(header, "Bearer ") {
-		token = strings.TrimPrefix(header, "Bearer ")
-		token = strings.TrimSpace(token)
-	} else {
-		err := errors.New("invalid or missing Authorization header")
-		return uuid.Nil, err
+func AccessTokenAuth(header string, tokenCfg *TokenConfig) (uuid.UUID, error) {
+	_, userID, err := ParseAccessToken(header, tokenCfg)
+	return userID, err
+}
+
+// Validate an access token and return its claims along with the user ID from the subject
+func ParseAccessToken(header string, tokenCfg *TokenConfig) (*AccessClaims, uuid.UUID, error) {
+	token, err := GetBearerToken(header)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(tokenCfg.Keys.ValidMethods()),
+		jwt.WithIssuer(tokenCfg.Issuer),
+		jwt.WithLeeway(tokenCfg.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+	if tokenCfg.Audience != "" {
+		options = append(options, jwt.WithAudience(tokenCfg.Audience))
 	}
 
-	claims := &jwt.RegisteredClaims{}
-	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return uuid.Nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return JWTSecret, nil
-	})
+	claims := &AccessClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, tokenCfg.Keys.Keyfunc, options...)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, uuid.Nil, err
 	}
 
 	userID := claims.Subject
 	convertedUserID, err := uuid.Parse(userID)
 	if err != nil {
-		return uuid.Nil, errors.New("failed to convert userID from subject to uuid.UUID")
+		return nil, uuid.Nil, errors.New("failed to convert userID from subject to uuid.UUID")
 	}
 
-	return convertedUserID, nil
+	return claims, convertedUserID, nil
 }
 
 // Create a new refresh token for a user
-func CreateRefreshToken() (string, time.Time, error) {
+func CreateRefreshToken(lifetime time.Duration) (string, time.Time, error) {
 
 	// Create a refresh token string
 	randBytes := make([]byte, 32)
@@ -90,7 +154,13 @@ func CreateRefreshToken() (string, time.Time, error) {
 
 	// Define token expiration timestamp
 	now := time.Now().UTC()
-	expirationTimestamp := now.Add(time.Duration(60*24) * time.Hour)
+	expirationTimestamp := now.Add(lifetime)
 
 	return hexString, expirationTimestamp, nil
 }
+
+// Digest of an opaque token (refresh or personal access token) - only the digest is stored in the DB
+func HashToken(token string) string {
+	digest := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(digest[:])
+}
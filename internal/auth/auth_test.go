@@ -0,0 +1,511 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Token config signing with a shared secret, so tests don't need a key directory
+func InitMockTokenConfig(t *testing.T) *TokenConfig {
+	keys, err := LoadKeySet("", "", []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Failed to initialize mock key set: %s", err)
+	}
+	tokenCfg := DefaultTokenConfig(keys)
+	tokenCfg.Issuer = "chirpy-test"
+	tokenCfg.Audience = "chirpy-api"
+	tokenCfg.ClockSkew = 30 * time.Second
+	return tokenCfg
+}
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	tokenCfg := InitMockTokenConfig(t)
+	userID := uuid.New()
+
+	token, err := CreateAccessToken(userID, RoleModerator, tokenCfg)
+	if err != nil {
+		t.Fatalf("Failed to create access token: %s", err)
+	}
+
+	claims, gotID, err := ParseAccessToken("Bearer "+token, tokenCfg)
+	if err != nil {
+		t.Fatalf("Valid access token rejected: %s", err)
+	}
+	if gotID != userID {
+		t.Errorf("Wrong user ID from access token.\nExpected: '%s'\nGot: '%s'", userID, gotID)
+	}
+	if claims.UserRole() != RoleModerator {
+		t.Errorf("Wrong role from access token.\nExpected: '%s'\nGot: '%s'", RoleModerator, claims.UserRole())
+	}
+}
+
+func TestAccessTokenLifetime(t *testing.T) {
+	tokenCfg := InitMockTokenConfig(t)
+	tokenCfg.AccessTokenTTL = 5 * time.Minute
+
+	token, err := CreateAccessToken(uuid.New(), RoleUser, tokenCfg)
+	if err != nil {
+		t.Fatalf("Failed to create access token: %s", err)
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatalf("Failed to parse access token: %s", err)
+	}
+	lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+	if lifetime != tokenCfg.AccessTokenTTL {
+		t.Errorf("Wrong access token lifetime.\nExpected: '%s'\nGot: '%s'", tokenCfg.AccessTokenTTL, lifetime)
+	}
+}
+
+func TestAccessTokenValidation(t *testing.T) {
+	tokenCfg := InitMockTokenConfig(t)
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name      string
+		claims    jwt.RegisteredClaims
+		wantError string
+	}{
+		{
+			name: "valid",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		},
+		{
+			name: "expired",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now.Add(-2 * time.Hour)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(-time.Hour)),
+			},
+			wantError: "expired",
+		},
+		{
+			name: "expired within clock skew",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now.Add(-time.Hour)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(-10 * time.Second)),
+			},
+		},
+		{
+			name: "missing expiration",
+			claims: jwt.RegisteredClaims{
+				Issuer:   "chirpy-test",
+				Audience: jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt: jwt.NewNumericDate(now),
+			},
+			wantError: "exp",
+		},
+		{
+			name: "not yet valid",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now.Add(10 * time.Minute)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			wantError: "not valid yet",
+		},
+		{
+			name: "issued in the future",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now.Add(10 * time.Minute)),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			wantError: "used before issued",
+		},
+		{
+			name: "wrong issuer",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "someone-else",
+				Audience:  jwt.ClaimStrings{"chirpy-api"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			wantError: "issuer",
+		},
+		{
+			name: "wrong audience",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				Audience:  jwt.ClaimStrings{"another-api"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			wantError: "audience",
+		},
+		{
+			name: "missing audience",
+			claims: jwt.RegisteredClaims{
+				Issuer:    "chirpy-test",
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+			wantError: "aud",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := tc.claims
+			claims.Subject = uuid.New().String()
+			token, err := tokenCfg.Keys.Sign(&claims)
+			if err != nil {
+				t.Fatalf("Failed to sign token: %s", err)
+			}
+
+			_, err = AccessTokenAuth("Bearer "+token, tokenCfg)
+			if tc.wantError == "" {
+				if err != nil {
+					t.Errorf("Expected token to be accepted, got: '%s'", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("Expected token to be rejected with '%s'", tc.wantError)
+			}
+			if !strings.Contains(err.Error(), tc.wantError) {
+				t.Errorf("Wrong validation error.\nExpected to contain: '%s'\nGot: '%s'", tc.wantError, err)
+			}
+		})
+	}
+}
+
+func TestAccessTokenWrongSecret(t *testing.T) {
+	tokenCfg := InitMockTokenConfig(t)
+	token, err := CreateAccessToken(uuid.New(), RoleUser, tokenCfg)
+	if err != nil {
+		t.Fatalf("Failed to create access token: %s", err)
+	}
+
+	otherKeys, err := LoadKeySet("", "", []byte("another-secret"))
+	if err != nil {
+		t.Fatalf("Failed to initialize mock key set: %s", err)
+	}
+	otherCfg := *tokenCfg
+	otherCfg.Keys = otherKeys
+
+	if _, err := AccessTokenAuth("Bearer "+token, &otherCfg); err == nil {
+		t.Error("Expected token signed with another secret to be rejected")
+	}
+}
+
+// Write a private key to a key directory as <kid>.pem
+func writePrivateKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal private key: %s", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatalf("Failed to write private key: %s", err)
+	}
+}
+
+// Write the public part of a key to a key directory as <kid>.pub.pem
+func writePublicKey(t *testing.T, dir, kid string, key crypto.Signer) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("Failed to marshal public key: %s", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pub.pem"), data, 0644); err != nil {
+		t.Fatalf("Failed to write public key: %s", err)
+	}
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate Ed25519 key: %s", err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %s", err)
+	}
+	return key
+}
+
+// Claims that pass validation with the default token config
+func validClaims() *AccessClaims {
+	now := time.Now().UTC()
+	return &AccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			Subject:   uuid.New().String(),
+		},
+	}
+}
+
+func TestKeySetRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     crypto.Signer
+		wantAlg string
+	}{
+		{"Ed25519", newEd25519Key(t), "EdDSA"},
+		{"RSA", newRSAKey(t), "RS256"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrivateKey(t, dir, "2024-10-01", tt.key)
+			keys, err := LoadKeySet(dir, "", nil)
+			if err != nil {
+				t.Fatalf("Failed to load key set: %s", err)
+			}
+			tokenCfg := DefaultTokenConfig(keys)
+			userID := uuid.New()
+
+			token, err := CreateAccessToken(userID, RoleUser, tokenCfg)
+			if err != nil {
+				t.Fatalf("Failed to create access token: %s", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &AccessClaims{})
+			if err != nil {
+				t.Fatalf("Failed to parse access token: %s", err)
+			}
+			if parsed.Header["kid"] != "2024-10-01" {
+				t.Errorf("Wrong kid in token header.\nExpected: '%s'\nGot: '%v'", "2024-10-01", parsed.Header["kid"])
+			}
+			if parsed.Method.Alg() != tt.wantAlg {
+				t.Errorf("Wrong signing algorithm.\nExpected: '%s'\nGot: '%s'", tt.wantAlg, parsed.Method.Alg())
+			}
+
+			_, gotID, err := ParseAccessToken("Bearer "+token, tokenCfg)
+			if err != nil {
+				t.Fatalf("Valid access token rejected: %s", err)
+			}
+			if gotID != userID {
+				t.Errorf("Wrong user ID from access token.\nExpected: '%s'\nGot: '%s'", userID, gotID)
+			}
+		})
+	}
+}
+
+func TestKeySetRejectsUntrustedKeys(t *testing.T) {
+	edKey := newEd25519Key(t)
+	rsaKey := newRSAKey(t)
+	secret := []byte("test-secret")
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "ed", edKey)
+	writePublicKey(t, dir, "rsa", rsaKey)
+	keys, err := LoadKeySet(dir, "ed", secret)
+	if err != nil {
+		t.Fatalf("Failed to load key set: %s", err)
+	}
+	tokenCfg := DefaultTokenConfig(keys)
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, validClaims())
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %s", err)
+		}
+		return signed
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantError string
+	}{
+		{
+			name:      "Unknown kid",
+			token:     sign(jwt.SigningMethodEdDSA, "retired", newEd25519Key(t)),
+			wantError: "unknown signing key",
+		},
+		{
+			name:      "RSA signature under an Ed25519 kid",
+			token:     sign(jwt.SigningMethodRS256, "ed", rsaKey),
+			wantError: "unexpected signing method",
+		},
+		{
+			name:      "Ed25519 signature under an RSA kid",
+			token:     sign(jwt.SigningMethodEdDSA, "rsa", edKey),
+			wantError: "unexpected signing method",
+		},
+		{
+			name:      "HS256 signature under an asymmetric kid",
+			token:     sign(jwt.SigningMethodHS256, "ed", secret),
+			wantError: "unexpected signing method",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseAccessToken("Bearer "+tt.token, tokenCfg)
+			if err == nil {
+				t.Fatal("Expected token to be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.wantError) {
+				t.Errorf("Wrong error.\nExpected: '%s'\nGot: '%s'", tt.wantError, err)
+			}
+		})
+	}
+}
+
+func TestKeySetLegacyTokens(t *testing.T) {
+	secret := []byte("test-secret")
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString(secret)
+	if err != nil {
+		t.Fatalf("Failed to sign legacy token: %s", err)
+	}
+
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "2024-10-01", newEd25519Key(t))
+
+	tests := []struct {
+		name       string
+		dir        string
+		hmacSecret []byte
+		until      time.Time
+		wantValid  bool
+	}{
+		{"Within the migration window", dir, secret, time.Now().Add(time.Hour), true},
+		{"After the migration window", dir, secret, time.Now().Add(-time.Hour), false},
+		{"Without a migration window", dir, secret, time.Time{}, false},
+		{"Secret removed", dir, nil, time.Now().Add(time.Hour), false},
+		{"Different secret", dir, []byte("another-secret"), time.Now().Add(time.Hour), false},
+		// Without a key directory every token is an HS256 token
+		{"Only a secret configured", "", secret, time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := LoadKeySet(tt.dir, "", tt.hmacSecret)
+			if err != nil {
+				t.Fatalf("Failed to load key set: %s", err)
+			}
+			logged := 0
+			keys.AllowLegacyTokens(tt.until, func(format string, args ...interface{}) {
+				logged++
+			})
+
+			_, _, err = ParseAccessToken("Bearer "+legacy, DefaultTokenConfig(keys))
+			if tt.wantValid && err != nil {
+				t.Errorf("Legacy token without a kid rejected: %s", err)
+			}
+			if !tt.wantValid && err == nil {
+				t.Error("Expected legacy token without a kid to be rejected")
+			}
+			if tt.dir != "" && tt.wantValid && logged != 1 {
+				t.Errorf("Expected the legacy token to be logged once, got %d", logged)
+			}
+		})
+	}
+}
+
+func TestKeySetReload(t *testing.T) {
+	oldKey := newEd25519Key(t)
+	dir := t.TempDir()
+	writePrivateKey(t, dir, "2024-01-01", oldKey)
+
+	keys, err := LoadKeySet(dir, "", nil)
+	if err != nil {
+		t.Fatalf("Failed to load key set: %s", err)
+	}
+	tokenCfg := DefaultTokenConfig(keys)
+	oldToken, err := CreateAccessToken(uuid.New(), RoleUser, tokenCfg)
+	if err != nil {
+		t.Fatalf("Failed to create access token: %s", err)
+	}
+
+	jwks := keys.JWKS()
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("Wrong number of keys in JWKS.\nExpected: '%d'\nGot: '%d'", 1, len(jwks.Keys))
+	}
+	if jwk := jwks.Keys[0]; jwk.KeyID != "2024-01-01" || jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" || jwk.Algorithm != "EdDSA" || jwk.X == "" {
+		t.Errorf("Wrong Ed25519 JWK: %+v", jwk)
+	}
+
+	// Rotate: a newer key takes over signing, the old one is kept for verification only
+	if err := os.Remove(filepath.Join(dir, "2024-01-01.pem")); err != nil {
+		t.Fatalf("Failed to remove old key: %s", err)
+	}
+	writePublicKey(t, dir, "2024-01-01", oldKey)
+	writePrivateKey(t, dir, "2024-06-01", newRSAKey(t))
+
+	if len(keys.JWKS().Keys) != 1 {
+		t.Error("Expected JWKS to change only on Reload")
+	}
+	if err := keys.Reload(); err != nil {
+		t.Fatalf("Failed to reload key set: %s", err)
+	}
+
+	jwks = keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Wrong number of keys in JWKS.\nExpected: '%d'\nGot: '%d'", 2, len(jwks.Keys))
+	}
+	if jwk := jwks.Keys[1]; jwk.KeyID != "2024-06-01" || jwk.KeyType != "RSA" || jwk.Algorithm != "RS256" || jwk.N == "" || jwk.E != "AQAB" {
+		t.Errorf("Wrong RSA JWK: %+v", jwk)
+	}
+
+	newToken, err := CreateAccessToken(uuid.New(), RoleUser, tokenCfg)
+	if err != nil {
+		t.Fatalf("Failed to create access token: %s", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &AccessClaims{})
+	if err != nil {
+		t.Fatalf("Failed to parse access token: %s", err)
+	}
+	if parsed.Header["kid"] != "2024-06-01" {
+		t.Errorf("Wrong signing key after reload.\nExpected: '%s'\nGot: '%v'", "2024-06-01", parsed.Header["kid"])
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if _, _, err := ParseAccessToken("Bearer "+token, tokenCfg); err != nil {
+			t.Errorf("Token signed with the %s key rejected after reload: %s", name, err)
+		}
+	}
+
+	// A broken directory leaves the loaded keys in place
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("not a key"), 0600); err != nil {
+		t.Fatalf("Failed to write broken key: %s", err)
+	}
+	if err := keys.Reload(); err == nil {
+		t.Error("Expected reload of a broken key directory to fail")
+	}
+	if len(keys.JWKS().Keys) != 2 {
+		t.Error("Expected a failed reload to keep the loaded keys")
+	}
+}
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type signingKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+type verificationKey struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+}
+
+// Keys used to sign and verify access tokens - tokens without a kid are legacy HS256 tokens checked with the shared secret
+type KeySet struct {
+	dir        string
+	signingKID string
+	hmacSecret []byte
+	signer     *signingKey
+	verifiers  map[string]*verificationKey
+	// Once asymmetric keys sign, legacy tokens are only accepted until then, and every use is logged
+	legacyUntil time.Time
+	legacyLogf  func(format string, args ...interface{})
+	mux         *sync.RWMutex
+}
+
+// JSON Web Key, as published on the JWKS endpoint
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Load access token keys from a directory of <kid>.pem PKCS#8 private keys and <kid>.pub.pem public keys of retired ones.
+// An empty dir falls back to HS256 signing with hmacSecret.
+func LoadKeySet(dir, signingKID string, hmacSecret []byte) (*KeySet, error) {
+	ks := &KeySet{
+		dir:        dir,
+		signingKID: signingKID,
+		hmacSecret: hmacSecret,
+		verifiers:  make(map[string]*verificationKey),
+		mux:        &sync.RWMutex{},
+	}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Re-read the key directory, e.g. after adding a key to rotate to - keys are swapped only if the whole directory loads successfully
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		if len(ks.hmacSecret) == 0 {
+			return errors.New("no JWT key directory or JWT secret configured")
+		}
+		return nil
+	}
+
+	signers, verifiers, err := readKeyDir(ks.dir)
+	if err != nil {
+		return err
+	}
+
+	var signer *signingKey
+	if ks.signingKID != "" {
+		signer = signers[ks.signingKID]
+		if signer == nil {
+			return fmt.Errorf("signing key '%s' not found in %s", ks.signingKID, ks.dir)
+		}
+	} else {
+		// The greatest kid signs, so naming keys by date makes the newest one active
+		kids := make([]string, 0, len(signers))
+		for kid := range signers {
+			kids = append(kids, kid)
+		}
+		if len(kids) == 0 {
+			return fmt.Errorf("no private keys found in %s", ks.dir)
+		}
+		sort.Strings(kids)
+		signer = signers[kids[len(kids)-1]]
+	}
+
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	ks.signer = signer
+	ks.verifiers = verifiers
+	return nil
+}
+
+// Accept legacy HS256 tokens without a kid until a point in time after moving to asymmetric keys, logging each one.
+// Without a migration window they're rejected as soon as a key directory is used.
+func (ks *KeySet) AllowLegacyTokens(until time.Time, logf func(format string, args ...interface{})) {
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	ks.legacyUntil = until
+	ks.legacyLogf = logf
+}
+
+// Sign claims with the active signing key
+func (ks *KeySet) Sign(claims jwt.Claims) (string, error) {
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	if ks.signer == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(ks.signer.method, claims)
+	token.Header["kid"] = ks.signer.kid
+	return token.SignedString(ks.signer.private)
+}
+
+// Resolve the verification key of a token from its kid header
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok || kid == "" {
+		// Legacy tokens signed with the shared secret
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(ks.hmacSecret) > 0 {
+			if ks.signer == nil {
+				return ks.hmacSecret, nil
+			}
+			if !time.Now().Before(ks.legacyUntil) {
+				return nil, errors.New("tokens without a kid are no longer accepted")
+			}
+			if ks.legacyLogf != nil {
+				subject, _ := token.Claims.GetSubject()
+				ks.legacyLogf("Legacy HS256 access token without a kid presented for user %s.", subject)
+			}
+			return ks.hmacSecret, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	key, ok := ks.verifiers[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.public, nil
+}
+
+// Signing algorithms accepted during verification
+func (ks *KeySet) ValidMethods() []string {
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	methods := []string{}
+	if len(ks.hmacSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	seen := make(map[string]bool)
+	for _, key := range ks.verifiers {
+		if !seen[key.method.Alg()] {
+			seen[key.method.Alg()] = true
+			methods = append(methods, key.method.Alg())
+		}
+	}
+	return methods
+}
+
+// Public keys of every active verification key
+func (ks *KeySet) JWKS() JWKS {
+	ks.mux.RLock()
+	defer ks.mux.RUnlock()
+
+	kids := make([]string, 0, len(ks.verifiers))
+	for kid := range ks.verifiers {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	jwks := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := ks.verifiers[kid]
+		jwk := JWK{
+			KeyID:     kid,
+			Use:       "sig",
+			Algorithm: key.method.Alg(),
+		}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
+
+func readKeyDir(dir string) (map[string]*signingKey, map[string]*verificationKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read JWT key directory %s: %w", dir, err)
+	}
+
+	signers := make(map[string]*signingKey)
+	verifiers := make(map[string]*verificationKey)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".pem") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read key %s: %w", name, err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, nil, fmt.Errorf("key %s is not PEM encoded", name)
+		}
+
+		if kid, ok := strings.CutSuffix(name, ".pub.pem"); ok {
+			parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to parse public key %s: %w", name, err)
+			}
+			method, err := methodForKey(parsed)
+			if err != nil {
+				return nil, nil, fmt.Errorf("key %s: %w", name, err)
+			}
+			// A private key with the same kid takes precedence
+			if _, exists := verifiers[kid]; !exists {
+				verifiers[kid] = &verificationKey{kid: kid, method: method, public: parsed}
+			}
+			continue
+		}
+
+		kid := strings.TrimSuffix(name, ".pem")
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse private key %s: %w", name, err)
+		}
+		private, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("key %s can't be used for signing", name)
+		}
+		method, err := methodForKey(private.Public())
+		if err != nil {
+			return nil, nil, fmt.Errorf("key %s: %w", name, err)
+		}
+		signers[kid] = &signingKey{kid: kid, method: method, private: private}
+		verifiers[kid] = &verificationKey{kid: kid, method: method, public: private.Public()}
+	}
+
+	return signers, verifiers, nil
+}
+
+func methodForKey(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public.(type) {
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	}
+	return nil, errors.New("unsupported key type, use Ed25519 or RSA")
+}
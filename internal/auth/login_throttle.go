@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits applied to failed login attempts
+type ThrottleLimits struct {
+	FreeAttempts    int           // Failed attempts allowed before any backoff kicks in
+	LockoutAttempts int           // Failed attempts that trigger a temporary lockout
+	BaseDelay       time.Duration // Backoff after the first attempt past FreeAttempts, doubled for every further failure
+	MaxDelay        time.Duration // Upper bound for the backoff
+	LockoutDuration time.Duration // How long a locked out account or IP stays blocked
+	ResetAfter      time.Duration // Failure history is forgotten after this much quiet time
+}
+
+// Default limits per account
+var DefaultAccountLimits = ThrottleLimits{
+	FreeAttempts:    3,
+	LockoutAttempts: 10,
+	BaseDelay:       1 * time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      1 * time.Hour,
+}
+
+// Default limits per IP address - looser, since many users can share one address
+var DefaultIPLimits = ThrottleLimits{
+	FreeAttempts:    10,
+	LockoutAttempts: 50,
+	BaseDelay:       1 * time.Second,
+	MaxDelay:        5 * time.Minute,
+	LockoutDuration: 30 * time.Minute,
+	ResetAfter:      1 * time.Hour,
+}
+
+type attemptRecord struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// Tracks failed login attempts per account and per IP address
+type LoginThrottle struct {
+	accounts      map[string]*attemptRecord
+	ips           map[string]*attemptRecord
+	accountLimits ThrottleLimits
+	ipLimits      ThrottleLimits
+	now           func() time.Time
+	mux           *sync.Mutex
+}
+
+// Outcome of a recorded login failure
+type ThrottleResult struct {
+	RetryAfter     time.Duration
+	AccountLocked  bool
+	IPLocked       bool
+	AccountFailure int
+	IPFailure      int
+}
+
+func NewLoginThrottle(accountLimits, ipLimits ThrottleLimits) *LoginThrottle {
+	return &LoginThrottle{
+		accounts:      make(map[string]*attemptRecord),
+		ips:           make(map[string]*attemptRecord),
+		accountLimits: accountLimits,
+		ipLimits:      ipLimits,
+		now:           time.Now,
+		mux:           &sync.Mutex{},
+	}
+}
+
+// Check if a login attempt is currently allowed, returns the time left until the next attempt otherwise
+func (lt *LoginThrottle) Allow(email, ip string) (time.Duration, bool) {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+
+	now := lt.now()
+	wait := lt.blockedFor(lt.accounts, normalizeAccount(email), lt.accountLimits, now)
+	if ipWait := lt.blockedFor(lt.ips, ip, lt.ipLimits, now); ipWait > wait {
+		wait = ipWait
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, wait == 0
+}
+
+// Record a failed login attempt and apply backoff or lockout to both the account and the IP address
+func (lt *LoginThrottle) RegisterFailure(email, ip string) ThrottleResult {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+
+	now := lt.now()
+	account := lt.fail(lt.accounts, normalizeAccount(email), lt.accountLimits, now)
+	address := lt.fail(lt.ips, ip, lt.ipLimits, now)
+
+	result := ThrottleResult{
+		AccountLocked:  account.failures >= lt.accountLimits.LockoutAttempts,
+		IPLocked:       address.failures >= lt.ipLimits.LockoutAttempts,
+		AccountFailure: account.failures,
+		IPFailure:      address.failures,
+	}
+	result.RetryAfter = account.blockedUntil.Sub(now)
+	if ipWait := address.blockedUntil.Sub(now); ipWait > result.RetryAfter {
+		result.RetryAfter = ipWait
+	}
+	if result.RetryAfter < 0 {
+		result.RetryAfter = 0
+	}
+	return result
+}
+
+// Clear the failure history of an account after a successful login
+func (lt *LoginThrottle) RegisterSuccess(email string) {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+
+	delete(lt.accounts, normalizeAccount(email))
+}
+
+// Drop records that are neither blocked nor recent enough to matter
+func (lt *LoginThrottle) Prune() {
+	lt.mux.Lock()
+	defer lt.mux.Unlock()
+
+	now := lt.now()
+	prune(lt.accounts, lt.accountLimits, now)
+	prune(lt.ips, lt.ipLimits, now)
+}
+
+func (lt *LoginThrottle) blockedFor(records map[string]*attemptRecord, key string, limits ThrottleLimits, now time.Time) time.Duration {
+	record, ok := records[key]
+	if !ok {
+		return 0
+	}
+	if expired(record, limits, now) {
+		delete(records, key)
+		return 0
+	}
+	return record.blockedUntil.Sub(now)
+}
+
+func (lt *LoginThrottle) fail(records map[string]*attemptRecord, key string, limits ThrottleLimits, now time.Time) *attemptRecord {
+	record, ok := records[key]
+	if !ok || expired(record, limits, now) {
+		record = &attemptRecord{}
+		records[key] = record
+	}
+	record.failures++
+	record.lastFailure = now
+
+	if record.failures >= limits.LockoutAttempts {
+		record.blockedUntil = now.Add(limits.LockoutDuration)
+	} else if record.failures > limits.FreeAttempts {
+		record.blockedUntil = now.Add(backoff(record.failures-limits.FreeAttempts, limits))
+	}
+	return record
+}
+
+// Exponential backoff - BaseDelay * 2^(n-1), capped at MaxDelay
+func backoff(n int, limits ThrottleLimits) time.Duration {
+	delay := limits.BaseDelay
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= limits.MaxDelay {
+			return limits.MaxDelay
+		}
+	}
+	return delay
+}
+
+func expired(record *attemptRecord, limits ThrottleLimits, now time.Time) bool {
+	return now.After(record.blockedUntil) && now.Sub(record.lastFailure) > limits.ResetAfter
+}
+
+func prune(records map[string]*attemptRecord, limits ThrottleLimits, now time.Time) {
+	for key, record := range records {
+		if expired(record, limits, now) {
+			delete(records, key)
+		}
+	}
+}
+
+func normalizeAccount(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+var testThrottleLimits = ThrottleLimits{
+	FreeAttempts:    3,
+	LockoutAttempts: 8,
+	BaseDelay:       1 * time.Second,
+	MaxDelay:        10 * time.Second,
+	LockoutDuration: 15 * time.Minute,
+	ResetAfter:      1 * time.Hour,
+}
+
+// Throttle with a clock the test moves by hand, and IP limits loose enough to stay out of the way
+func newTestThrottle() (*LoginThrottle, *time.Time) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	ipLimits := testThrottleLimits
+	ipLimits.FreeAttempts = 1000
+	ipLimits.LockoutAttempts = 1000
+	throttle := NewLoginThrottle(testThrottleLimits, ipLimits)
+	throttle.now = func() time.Time { return now }
+	return throttle, &now
+}
+
+func TestLoginThrottleBackoff(t *testing.T) {
+	throttle, _ := newTestThrottle()
+
+	tests := []struct {
+		failure    int
+		wantDelay  time.Duration
+		wantLocked bool
+	}{
+		{1, 0, false},
+		{2, 0, false},
+		{3, 0, false},
+		{4, 1 * time.Second, false},
+		{5, 2 * time.Second, false},
+		{6, 4 * time.Second, false},
+		{7, 8 * time.Second, false},
+		{8, 15 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		result := throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1")
+		if result.AccountFailure != tt.failure {
+			t.Errorf("Wrong failure count.\nExpected: '%d'\nGot: '%d'", tt.failure, result.AccountFailure)
+		}
+		if result.RetryAfter != tt.wantDelay {
+			t.Errorf("Wrong backoff after failure %d.\nExpected: '%s'\nGot: '%s'", tt.failure, tt.wantDelay, result.RetryAfter)
+		}
+		if result.AccountLocked != tt.wantLocked {
+			t.Errorf("Wrong lockout after failure %d.\nExpected: '%v'\nGot: '%v'", tt.failure, tt.wantLocked, result.AccountLocked)
+		}
+		wait, ok := throttle.Allow("walt@breakingbad.com", "10.0.0.1")
+		if ok != (tt.wantDelay == 0) || wait != tt.wantDelay {
+			t.Errorf("Wrong Allow after failure %d.\nExpected: '%s'\nGot: '%s' (allowed: %v)", tt.failure, tt.wantDelay, wait, ok)
+		}
+	}
+}
+
+func TestLoginThrottleBackoffCap(t *testing.T) {
+	limits := testThrottleLimits
+	limits.LockoutAttempts = 100
+
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{1, 1 * time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{20, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := backoff(tt.n, limits); got != tt.want {
+			t.Errorf("Wrong backoff for %d.\nExpected: '%s'\nGot: '%s'", tt.n, tt.want, got)
+		}
+	}
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	throttle, now := newTestThrottle()
+
+	for i := 0; i < testThrottleLimits.LockoutAttempts; i++ {
+		throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1")
+	}
+
+	// Other accounts aren't affected, and the lockout applies however the address is written
+	if _, ok := throttle.Allow("jesse@breakingbad.com", "10.0.0.1"); !ok {
+		t.Error("Expected another account to be allowed")
+	}
+	if _, ok := throttle.Allow("  Walt@BreakingBad.com ", "10.0.0.2"); ok {
+		t.Error("Expected the locked out account to be blocked from another IP address")
+	}
+
+	*now = now.Add(testThrottleLimits.LockoutDuration - time.Second)
+	if wait, ok := throttle.Allow("walt@breakingbad.com", "10.0.0.1"); ok || wait != time.Second {
+		t.Errorf("Expected the lockout to last 1s more, got %s (allowed: %v)", wait, ok)
+	}
+
+	*now = now.Add(2 * time.Second)
+	if _, ok := throttle.Allow("walt@breakingbad.com", "10.0.0.1"); !ok {
+		t.Error("Expected the account to be allowed after the lockout")
+	}
+
+	// The failure history outlives the lockout, so the next failure locks the account out again
+	if result := throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1"); !result.AccountLocked {
+		t.Errorf("Expected another lockout, got %d failures", result.AccountFailure)
+	}
+}
+
+func TestLoginThrottleIPLockout(t *testing.T) {
+	limits := testThrottleLimits
+	throttle := NewLoginThrottle(limits, limits)
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	throttle.now = func() time.Time { return now }
+
+	// Spraying one password over many accounts from one address
+	var result ThrottleResult
+	for i := 0; i < limits.LockoutAttempts; i++ {
+		result = throttle.RegisterFailure(string(rune('a'+i))+"@breakingbad.com", "10.0.0.1")
+	}
+	if !result.IPLocked || result.AccountLocked {
+		t.Errorf("Expected only the IP address to be locked out, got %+v", result)
+	}
+	if _, ok := throttle.Allow("saul@breakingbad.com", "10.0.0.1"); ok {
+		t.Error("Expected the locked out IP address to be blocked for every account")
+	}
+	if _, ok := throttle.Allow("saul@breakingbad.com", "10.0.0.2"); !ok {
+		t.Error("Expected another IP address to be allowed")
+	}
+}
+
+func TestLoginThrottleSuccessResets(t *testing.T) {
+	throttle, now := newTestThrottle()
+
+	for i := 0; i < testThrottleLimits.FreeAttempts+1; i++ {
+		throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1")
+	}
+	*now = now.Add(time.Second)
+	throttle.RegisterSuccess("Walt@BreakingBad.com")
+
+	if _, ok := throttle.Allow("walt@breakingbad.com", "10.0.0.1"); !ok {
+		t.Error("Expected the account to be allowed after a successful login")
+	}
+	if result := throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1"); result.AccountFailure != 1 || result.RetryAfter != 0 {
+		t.Errorf("Expected the failure count to start over, got %d failures and %s backoff", result.AccountFailure, result.RetryAfter)
+	}
+}
+
+func TestLoginThrottleQuietPeriodResets(t *testing.T) {
+	throttle, now := newTestThrottle()
+
+	for i := 0; i < testThrottleLimits.FreeAttempts+1; i++ {
+		throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1")
+	}
+	*now = now.Add(testThrottleLimits.ResetAfter + time.Second)
+
+	if result := throttle.RegisterFailure("walt@breakingbad.com", "10.0.0.1"); result.AccountFailure != 1 {
+		t.Errorf("Expected the failure history to be forgotten, got %d failures", result.AccountFailure)
+	}
+}
+
+func TestLoginThrottlePrune(t *testing.T) {
+	// A lockout longer than the quiet period, so a record can be old but still blocked
+	limits := testThrottleLimits
+	limits.LockoutDuration = 2 * time.Hour
+	throttle := NewLoginThrottle(limits, limits)
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	throttle.now = func() time.Time { return now }
+
+	throttle.RegisterFailure("old@breakingbad.com", "10.0.0.1")
+	for i := 0; i < limits.LockoutAttempts; i++ {
+		throttle.RegisterFailure("locked@breakingbad.com", "10.0.0.2")
+	}
+	now = now.Add(limits.ResetAfter - time.Minute)
+	throttle.RegisterFailure("recent@breakingbad.com", "10.0.0.3")
+
+	now = now.Add(2 * time.Minute)
+	throttle.Prune()
+
+	tests := []struct {
+		name    string
+		records map[string]*attemptRecord
+		key     string
+		kept    bool
+	}{
+		{"Stale account", throttle.accounts, "old@breakingbad.com", false},
+		{"Locked out account", throttle.accounts, "locked@breakingbad.com", true},
+		{"Recent account", throttle.accounts, "recent@breakingbad.com", true},
+		{"Stale IP address", throttle.ips, "10.0.0.1", false},
+		{"Locked out IP address", throttle.ips, "10.0.0.2", true},
+		{"Recent IP address", throttle.ips, "10.0.0.3", true},
+	}
+	for _, tt := range tests {
+		if _, ok := tt.records[tt.key]; ok != tt.kept {
+			t.Errorf("Wrong pruning of %s.\nExpected kept: '%v'\nGot: '%v'", tt.name, tt.kept, ok)
+		}
+	}
+}
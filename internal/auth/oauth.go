@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+// Only S256 is supported - "plain" offers no protection if the authorization request leaks
+const PKCEMethodS256 = "S256"
+
+// Create a random, URL-safe token (authorization codes, client IDs and secrets)
+func CreateRandomToken(size int) (string, error) {
+	randBytes := make([]byte, size)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(randBytes), nil
+}
+
+// Check a PKCE code verifier against the challenge sent with the authorization request (RFC 7636)
+func VerifyPKCE(verifier, challenge, method string) bool {
+	if method != PKCEMethodS256 {
+		return false
+	}
+	// Verifiers must be 43-128 characters long
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	digest := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(digest[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// Parse a space separated OAuth scope parameter, returns false if any scope is unknown
+func ParseScopes(scope string) ([]string, bool) {
+	scopes := []string{}
+	seen := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !ValidScope(s) {
+			return nil, false
+		}
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, true
+}
+
+// Constant-time comparison of a secret against its stored digest
+func SecretMatchesHash(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(hash)) == 1
+}
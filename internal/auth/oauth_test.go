@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	digest := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"S256 match", verifier, challenge, PKCEMethodS256, true},
+		{"S256 verifier mismatch", verifier[:42] + "x", challenge, PKCEMethodS256, false},
+		{"S256 challenge mismatch", verifier, challenge[:len(challenge)-1] + "A", PKCEMethodS256, false},
+		{"plain method is not supported", verifier, verifier, "plain", false},
+		{"Missing method", verifier, challenge, "", false},
+		{"Verifier too short", verifier[:42], challenge, PKCEMethodS256, false},
+		{"Verifier too long", strings.Repeat("a", 129), challenge, PKCEMethodS256, false},
+		{"Empty challenge", verifier, "", PKCEMethodS256, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("Wrong PKCE result.\nExpected: '%v'\nGot: '%v'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVerifyPKCEVerifierLengths(t *testing.T) {
+	for _, length := range []int{43, 128} {
+		verifier := strings.Repeat("a", length)
+		digest := sha256.Sum256([]byte(verifier))
+		challenge := base64.RawURLEncoding.EncodeToString(digest[:])
+		if !VerifyPKCE(verifier, challenge, PKCEMethodS256) {
+			t.Errorf("Verifier of %d characters rejected", length)
+		}
+	}
+}
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		scope  string
+		want   []string
+		wantOK bool
+	}{
+		{"Single scope", "chirps:read", []string{ScopeChirpsRead}, true},
+		{"Several scopes keep their order", "messages:read chirps:write", []string{ScopeMessagesRead, ScopeChirpsWrite}, true},
+		{"Duplicates are dropped", "chirps:read chirps:read chirps:write chirps:read", []string{ScopeChirpsRead, ScopeChirpsWrite}, true},
+		{"Extra whitespace", "  chirps:read \t chirps:write ", []string{ScopeChirpsRead, ScopeChirpsWrite}, true},
+		{"Empty", "", []string{}, true},
+		{"Unknown scope", "chirps:delete", nil, false},
+		{"Unknown scope among known ones", "chirps:read admin chirps:write", nil, false},
+		{"Scopes are case sensitive", "Chirps:Read", nil, false},
+		{"Comma separated", "chirps:read,chirps:write", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseScopes(tt.scope)
+			if ok != tt.wantOK {
+				t.Fatalf("Wrong validity for '%s'.\nExpected: '%v'\nGot: '%v'", tt.scope, tt.wantOK, ok)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Wrong scopes for '%s'.\nExpected: '%v'\nGot: '%v'", tt.scope, tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2id parameters - memory is in KiB
+type PasswordParams struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// argon2id parameters used unless configured otherwise - 64 MiB of memory and 3 passes over it
+func DefaultPasswordParams() *PasswordParams {
+	return &PasswordParams{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+var errUnknownPasswordHash = errors.New("unknown password hash format")
+
+// Create password hash for new users on sign-up - argon2id in the PHC string format, $argon2id$v=19$m=...,t=...,p=...$<salt>$<key>
+func CreatePasswordHash(password string, params *PasswordParams) ([]byte, error) {
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return []byte{}, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	encoded := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return []byte(encoded), nil
+}
+
+// Check a password against an argon2id or legacy bcrypt hash. needsRehash reports if the hash should be replaced
+// with one created with the current algorithm and parameters, so raising the parameters is just a config change.
+func CheckPasswordHash(password string, hash []byte, params *PasswordParams) (match bool, needsRehash bool, err error) {
+	encoded := string(hash)
+
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		stored, salt, key, err := decodeArgon2idHash(encoded)
+		if err != nil {
+			return false, false, err
+		}
+		otherKey := argon2.IDKey([]byte(password), salt, stored.Iterations, stored.Memory, stored.Parallelism, stored.KeyLength)
+		if subtle.ConstantTimeCompare(key, otherKey) != 1 {
+			return false, false, nil
+		}
+		outdated := stored.Memory != params.Memory ||
+			stored.Iterations != params.Iterations ||
+			stored.Parallelism != params.Parallelism ||
+			stored.SaltLength != params.SaltLength ||
+			stored.KeyLength != params.KeyLength
+		return true, outdated, nil
+
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		err := bcrypt.CompareHashAndPassword(hash, []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, true, nil
+	}
+
+	return false, false, errUnknownPasswordHash
+}
+
+// Split a PHC string into its parameters, salt and key
+func decodeArgon2idHash(encoded string) (*PasswordParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, nil, nil, errUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash version: %w", err)
+	}
+	if version != argon2.Version {
+		return nil, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+
+	params := &PasswordParams{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid argon2id hash key: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters, so tests don't spend their time hashing
+func InitMockPasswordParams() *PasswordParams {
+	return &PasswordParams{
+		Memory:      8 * 1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+}
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	params := InitMockPasswordParams()
+
+	hash, err := CreatePasswordHash("Correct-Horse-1", params)
+	if err != nil {
+		t.Fatalf("Failed to create password hash: %s", err)
+	}
+
+	match, needsRehash, err := CheckPasswordHash("Correct-Horse-1", hash, params)
+	if err != nil || !match {
+		t.Fatalf("Valid password rejected: match=%t, err=%v", match, err)
+	}
+	if needsRehash {
+		t.Error("Hash created with the current parameters flagged for rehash")
+	}
+
+	match, _, err = CheckPasswordHash("Wrong-Horse-1", hash, params)
+	if err != nil || match {
+		t.Errorf("Wrong password accepted: match=%t, err=%v", match, err)
+	}
+}
+
+func TestPasswordHashRehash(t *testing.T) {
+	params := InitMockPasswordParams()
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-1"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to create bcrypt hash: %s", err)
+	}
+	outdatedParams := *params
+	outdatedParams.Iterations = 2
+	outdatedHash, err := CreatePasswordHash("Correct-Horse-1", &outdatedParams)
+	if err != nil {
+		t.Fatalf("Failed to create password hash: %s", err)
+	}
+
+	tests := []struct {
+		name string
+		hash []byte
+	}{
+		{name: "bcrypt", hash: bcryptHash},
+		{name: "outdated argon2id parameters", hash: outdatedHash},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			match, needsRehash, err := CheckPasswordHash("Correct-Horse-1", tc.hash, params)
+			if err != nil || !match {
+				t.Fatalf("Valid password rejected: match=%t, err=%v", match, err)
+			}
+			if !needsRehash {
+				t.Error("Expected the hash to be flagged for rehash")
+			}
+
+			match, _, err = CheckPasswordHash("Wrong-Horse-1", tc.hash, params)
+			if err != nil || match {
+				t.Errorf("Wrong password accepted: match=%t, err=%v", match, err)
+			}
+		})
+	}
+}
+
+func TestPasswordHashInvalid(t *testing.T) {
+	params := InitMockPasswordParams()
+
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$m=abc$salt$key", "$argon2id$v=18$m=8192,t=1,p=1$c2FsdA$a2V5"} {
+		if match, _, err := CheckPasswordHash("Correct-Horse-1", []byte(hash), params); err == nil || match {
+			t.Errorf("Expected hash '%s' to be rejected, got match=%t, err=%v", hash, match, err)
+		}
+	}
+}
+
+// go test ./internal/auth -run '^$' -bench Password
+func BenchmarkPasswordHash(b *testing.B) {
+	benchmarks := []*PasswordParams{
+		DefaultPasswordParams(),
+		{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		{Memory: 128 * 1024, Iterations: 3, Parallelism: 4, SaltLength: 16, KeyLength: 32},
+	}
+
+	for _, params := range benchmarks {
+		b.Run(fmt.Sprintf("argon2id m=%d t=%d p=%d", params.Memory, params.Iterations, params.Parallelism), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := CreatePasswordHash("Correct-Horse-1", params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+
+	b.Run("bcrypt cost=12", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := bcrypt.GenerateFromPassword([]byte("Correct-Horse-1"), 12); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Scopes that can be granted to personal access tokens
+const (
+	ScopeChirpsRead    = "chirps:read"
+	ScopeChirpsWrite   = "chirps:write"
+	ScopeProfileRead   = "profile:read"
+	ScopeProfileWrite  = "profile:write"
+	ScopeMessagesRead  = "messages:read"
+	ScopeMessagesWrite = "messages:write"
+)
+
+var validScopes = map[string]bool{
+	ScopeChirpsRead:    true,
+	ScopeChirpsWrite:   true,
+	ScopeProfileRead:   true,
+	ScopeProfileWrite:  true,
+	ScopeMessagesRead:  true,
+	ScopeMessagesWrite: true,
+}
+
+// Personal access tokens are recognizable by their prefix, so they can be told apart from JWTs
+const PersonalAccessTokenPrefix = "chirpy_pat_"
+
+// Check if a scope exists
+func ValidScope(scope string) bool {
+	return validScopes[scope]
+}
+
+// Check if a list of granted scopes contains the required one
+func HasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if a bearer token is a personal access token
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// Create a new personal access token - only its digest is stored, the token itself is shown to the user once
+func CreatePersonalAccessToken() (string, error) {
+	randBytes := make([]byte, 32)
+	if _, err := rand.Read(randBytes); err != nil {
+		return "", err
+	}
+	return PersonalAccessTokenPrefix + hex.EncodeToString(randBytes), nil
+}
@@ -0,0 +1,58 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// What happened to a subscription
+type Kind string
+
+const (
+	// A new paid period after the user had no subscription in effect
+	KindActivated Kind = "activated"
+	// The subscription was paid for another period
+	KindRenewed Kind = "renewed"
+	// The user cancelled - the subscription stays in effect until the end of the paid period
+	KindCancelled Kind = "cancelled"
+	// The subscription ended immediately
+	KindEnded Kind = "ended"
+	// An event we don't act on
+	KindIgnored Kind = ""
+)
+
+var (
+	ErrUnauthorized   = errors.New("webhook request could not be authenticated")
+	ErrInvalidPayload = errors.New("invalid webhook payload")
+)
+
+// A subscription event in our own terms
+type Event struct {
+	// The provider's ID of the event - retried deliveries of one event share it
+	ID string
+	// How long after the first delivery another one with the same ID is a retry - zero when the ID is unique
+	// for good. Set when the ID is derived from the payload, which a later event can repeat.
+	DuplicateWindow time.Duration
+	// The provider's name for the event type, kept for the event ledger and logs
+	Type string
+	Kind Kind
+
+	UserID uuid.UUID
+	// Empty when the provider doesn't say
+	Plan string
+	// End of the paid period, nil when the provider doesn't say
+	PeriodEnd *time.Time
+}
+
+// A billing vendor - it authenticates the vendor's webhooks and translates their payloads, so handlers never see them
+type Provider interface {
+	// Name used in the webhook URL and the event ledger
+	Name() string
+	// Check that a request comes from the provider - body is the raw request body
+	Authenticate(header http.Header, body []byte) error
+	// Translate a payload into an event. header is nil when a stored payload is replayed.
+	Parse(header http.Header, body []byte) (Event, error)
+}
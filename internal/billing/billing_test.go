@@ -0,0 +1,181 @@
+package billing
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/webhook"
+)
+
+const testUserID = "3311741c-680c-4546-99f3-fc9efac2036c"
+
+func TestParse(t *testing.T) {
+	userID := uuid.MustParse(testUserID)
+	periodEnd := time.Unix(1720000000, 0).UTC()
+
+	tests := []struct {
+		name     string
+		provider Provider
+		body     string
+		want     Event
+		wantErr  error
+	}{
+		{
+			name:     "polka upgrade",
+			provider: &Polka{},
+			body:     `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + testUserID + `","plan":"chirpy_red","period_end":"2024-07-03T09:46:40Z"}}`,
+			want:     Event{ID: "evt_1", Type: "user.upgraded", Kind: KindActivated, UserID: userID, Plan: "chirpy_red", PeriodEnd: &periodEnd},
+		},
+		{
+			name:     "polka event without an ID",
+			provider: &Polka{},
+			body:     `{"event":"user.downgraded","data":{"user_id":"` + testUserID + `"}}`,
+			want:     Event{ID: "sha256:f5ef0577550466543ea7e576dde65ed92c7b9c55b75d6769633921416a6bfa65", DuplicateWindow: polkaDuplicateWindow, Type: "user.downgraded", Kind: KindEnded, UserID: userID},
+		},
+		{
+			name:     "polka unknown event",
+			provider: &Polka{},
+			body:     `{"id":"evt_2","event":"user.created","data":{"user_id":"` + testUserID + `"}}`,
+			want:     Event{ID: "evt_2", Type: "user.created", Kind: KindIgnored, UserID: userID},
+		},
+		{
+			name:     "stripe subscription created",
+			provider: &Stripe{},
+			body:     `{"id":"evt_3","type":"customer.subscription.created","data":{"object":{"status":"active","current_period_end":1720000000,"metadata":{"user_id":"` + testUserID + `"},"items":{"data":[{"price":{"lookup_key":"chirpy_red"}}]}}}}`,
+			want:     Event{ID: "evt_3", Type: "customer.subscription.created", Kind: KindActivated, UserID: userID, Plan: "chirpy_red", PeriodEnd: &periodEnd},
+		},
+		{
+			name:     "stripe subscription created before the first payment",
+			provider: &Stripe{},
+			body:     `{"id":"evt_7","type":"customer.subscription.created","data":{"object":{"status":"incomplete","current_period_end":1720000000,"metadata":{"user_id":"` + testUserID + `","plan":"chirpy_red"}}}}`,
+			want:     Event{ID: "evt_7", Type: "customer.subscription.created", Kind: KindIgnored},
+		},
+		{
+			name:     "stripe first payment succeeded",
+			provider: &Stripe{},
+			body:     `{"id":"evt_8","type":"customer.subscription.updated","data":{"object":{"status":"active","current_period_end":1720000000,"metadata":{"user_id":"` + testUserID + `","plan":"chirpy_red"}}}}`,
+			want:     Event{ID: "evt_8", Type: "customer.subscription.updated", Kind: KindRenewed, UserID: userID, Plan: "chirpy_red", PeriodEnd: &periodEnd},
+		},
+		{
+			name:     "stripe cancellation at period end",
+			provider: &Stripe{},
+			body:     `{"id":"evt_4","type":"customer.subscription.updated","data":{"object":{"status":"active","cancel_at_period_end":true,"current_period_end":1720000000,"metadata":{"user_id":"` + testUserID + `","plan":"chirpy_red"}}}}`,
+			want:     Event{ID: "evt_4", Type: "customer.subscription.updated", Kind: KindCancelled, UserID: userID, Plan: "chirpy_red", PeriodEnd: &periodEnd},
+		},
+		{
+			name:     "stripe past due subscription",
+			provider: &Stripe{},
+			body:     `{"id":"evt_5","type":"customer.subscription.updated","data":{"object":{"status":"past_due","metadata":{"user_id":"` + testUserID + `"}}}}`,
+			want:     Event{ID: "evt_5", Type: "customer.subscription.updated", Kind: KindIgnored},
+		},
+		{
+			name:     "stripe subscription without a user",
+			provider: &Stripe{},
+			body:     `{"id":"evt_6","type":"customer.subscription.deleted","data":{"object":{"status":"canceled","metadata":{}}}}`,
+			wantErr:  ErrInvalidPayload,
+		},
+		{
+			name:     "invalid JSON",
+			provider: &Stripe{},
+			body:     `{"id":`,
+			wantErr:  ErrInvalidPayload,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.provider.Parse(nil, []byte(tc.body))
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Expected error '%v', got '%v'", tc.wantErr, err)
+			}
+			if tc.wantErr != nil {
+				return
+			}
+			if got.ID != tc.want.ID || got.DuplicateWindow != tc.want.DuplicateWindow || got.Type != tc.want.Type || got.Kind != tc.want.Kind || got.UserID != tc.want.UserID || got.Plan != tc.want.Plan {
+				t.Errorf("Expected %+v, got %+v", tc.want, got)
+			}
+			if (got.PeriodEnd == nil) != (tc.want.PeriodEnd == nil) || (got.PeriodEnd != nil && !got.PeriodEnd.Equal(*tc.want.PeriodEnd)) {
+				t.Errorf("Expected period end %v, got %v", tc.want.PeriodEnd, got.PeriodEnd)
+			}
+		})
+	}
+}
+
+func TestPolkaEventWithoutIDIsKeyedByBody(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"` + testUserID + `"}}`)
+	polka := &Polka{}
+
+	parse := func(header http.Header, body []byte) Event {
+		event, err := polka.Parse(header, body)
+		if err != nil {
+			t.Fatalf("Failed to parse event: %s", err)
+		}
+		return event
+	}
+
+	first := parse(nil, body)
+	if first.DuplicateWindow != polkaDuplicateWindow {
+		t.Errorf("Expected a duplicate window of %s, got %s", polkaDuplicateWindow, first.DuplicateWindow)
+	}
+	// A retry is signed again, with a new timestamp
+	signed := parse(http.Header{"Polka-Timestamp": []string{"1719997300"}}, body)
+	resigned := parse(http.Header{"Polka-Timestamp": []string{"1719997900"}}, body)
+	if signed.ID != first.ID || resigned.ID != first.ID {
+		t.Errorf("Expected retries signed at different times to be the same event, got %s, %s and %s", first.ID, signed.ID, resigned.ID)
+	}
+
+	other := parse(nil, []byte(`{"event":"user.downgraded","data":{"user_id":"`+testUserID+`"}}`))
+	if other.ID == first.ID {
+		t.Errorf("Expected different bodies to be different events, got %s twice", first.ID)
+	}
+
+	withID := parse(http.Header{"Polka-Event-Id": []string{"evt_9"}}, body)
+	if withID.ID != "evt_9" || withID.DuplicateWindow != 0 {
+		t.Errorf("Expected the delivered event ID without a window, got %s and %s", withID.ID, withID.DuplicateWindow)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"customer.subscription.deleted"}`)
+	verifier, err := webhook.NewVerifier([]string{"whsec_test"}, webhook.DefaultTolerance)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	timestamp, signature := webhook.Sign("whsec_test", time.Now(), body)
+	_, wrongSignature := webhook.Sign("whsec_other", time.Now(), body)
+
+	stripeHeader := func(value string) http.Header {
+		return http.Header{"Stripe-Signature": []string{value}}
+	}
+	tests := []struct {
+		name     string
+		provider Provider
+		header   http.Header
+		wantErr  bool
+	}{
+		{name: "stripe signature", provider: &Stripe{Verifier: verifier}, header: stripeHeader("t=" + timestamp + "," + signature)},
+		{name: "stripe with a rotated-out signature", provider: &Stripe{Verifier: verifier}, header: stripeHeader("t=" + timestamp + "," + wrongSignature + "," + signature)},
+		{name: "stripe wrong secret", provider: &Stripe{Verifier: verifier}, header: stripeHeader("t=" + timestamp + "," + wrongSignature), wantErr: true},
+		{name: "stripe without signature", provider: &Stripe{Verifier: verifier}, header: http.Header{}, wantErr: true},
+		{name: "polka api key", provider: &Polka{APIKey: "polka-key"}, header: http.Header{"Authorization": []string{"ApiKey polka-key"}}},
+		{name: "polka wrong api key", provider: &Polka{APIKey: "polka-key"}, header: http.Header{"Authorization": []string{"ApiKey other-key"}}, wantErr: true},
+		{name: "polka without a configured key", provider: &Polka{}, header: http.Header{"Authorization": []string{"ApiKey "}}, wantErr: true},
+		{name: "polka signature", provider: &Polka{Verifier: verifier}, header: http.Header{"Polka-Timestamp": []string{timestamp}, "Polka-Signature": []string{signature}}},
+		{name: "polka api key when signatures are required", provider: &Polka{Verifier: verifier, APIKey: "polka-key"}, header: http.Header{"Authorization": []string{"ApiKey polka-key"}}, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.provider.Authenticate(tc.header, body)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expected error: %t, got '%v'", tc.wantErr, err)
+			}
+			if err != nil && !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("Expected ErrUnauthorized, got '%v'", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package billing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/webhook"
+)
+
+const ProviderStripe = "stripe"
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object stripeSubscription `json:"object"`
+	} `json:"data"`
+}
+
+// Our user ID is in the metadata, set when the checkout session is created
+type stripeSubscription struct {
+	Status            string            `json:"status"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	Items             struct {
+		Data []struct {
+			Price struct {
+				LookupKey string `json:"lookup_key"`
+			} `json:"price"`
+		} `json:"data"`
+	} `json:"items"`
+}
+
+// Stripe-compatible events, signed with "Stripe-Signature: t=<timestamp>,v1=<hex>[,v1=...]" over "<timestamp>.<raw body>"
+type Stripe struct {
+	Verifier *webhook.Verifier
+}
+
+func (s *Stripe) Name() string {
+	return ProviderStripe
+}
+
+func (s *Stripe) Authenticate(header http.Header, body []byte) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, "v1="+value)
+		}
+	}
+	if err := s.Verifier.Verify(timestamp, strings.Join(signatures, ","), body); err != nil {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, err)
+	}
+	return nil
+}
+
+func (s *Stripe) Parse(header http.Header, body []byte) (Event, error) {
+	var event stripeEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.ID == "" {
+		return Event{}, ErrInvalidPayload
+	}
+	parsed := Event{
+		ID:   event.ID,
+		Type: event.Type,
+	}
+
+	subscription := event.Data.Object
+	paid := subscription.Status == "active" || subscription.Status == "trialing"
+	switch event.Type {
+	case "customer.subscription.created":
+		// Subscriptions are created incomplete until the first payment succeeds - the update to active grants them
+		if !paid {
+			return parsed, nil
+		}
+		parsed.Kind = KindActivated
+	case "customer.subscription.updated":
+		switch {
+		case !paid:
+			// Past due, unpaid or incomplete - Stripe sends customer.subscription.deleted once it gives up
+			return parsed, nil
+		case subscription.CancelAtPeriodEnd:
+			parsed.Kind = KindCancelled
+		default:
+			parsed.Kind = KindRenewed
+		}
+	case "customer.subscription.deleted":
+		parsed.Kind = KindEnded
+	default:
+		return parsed, nil
+	}
+
+	userID, err := uuid.Parse(subscription.Metadata["user_id"])
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: subscription metadata has no valid user_id", ErrInvalidPayload)
+	}
+	parsed.UserID = userID
+
+	parsed.Plan = subscription.Metadata["plan"]
+	if parsed.Plan == "" && len(subscription.Items.Data) > 0 {
+		parsed.Plan = subscription.Items.Data[0].Price.LookupKey
+	}
+	if subscription.CurrentPeriodEnd > 0 {
+		periodEnd := time.Unix(subscription.CurrentPeriodEnd, 0).UTC()
+		parsed.PeriodEnd = &periodEnd
+	}
+	return parsed, nil
+}
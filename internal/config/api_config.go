@@ -4,9 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
 
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/billing"
 	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/entitlements"
+	"github.com/vmilasin/chirpy/internal/events"
 	"github.com/vmilasin/chirpy/internal/logger"
+	"github.com/vmilasin/chirpy/internal/mailer"
+	"github.com/vmilasin/chirpy/internal/profanity"
+	"github.com/vmilasin/chirpy/internal/webhook"
 )
 
 type ApiConfig struct {
@@ -14,12 +25,34 @@ type ApiConfig struct {
 	DB             *sql.DB
 	Queries        *database.Queries
 	AppLogs        *logger.AppLogs
-	JWTSecret      []byte
+	TokenConfig    *auth.TokenConfig
+	PasswordParams *auth.PasswordParams
 	Platform       string
 	PolkaKey       string
+	LoginThrottle  *auth.LoginThrottle
+	Mailer         mailer.Mailer
+	// Payment providers whose subscription webhooks we accept, by name
+	PaymentProviders map[string]billing.Provider
+	// Time between an account deletion request and the account being deleted
+	AccountDeletionGracePeriod time.Duration
+	// Where personal data export archives are written, and how long their download links stay valid
+	DataExportDir     string
+	DataExportLinkTTL time.Duration
+	// Length of a Chirpy Red billing period, used when the payment provider doesn't say when a period ends
+	SubscriptionPeriod time.Duration
+	// Limits and perks of each plan - chirp length, editing, scheduling, rate limits and media
+	Plans entitlements.Plans
+	// Masks profane words in chirps and messages - dictionaries can be reloaded at runtime
+	Profanity *profanity.Filter
+	// Sends events to registered webhook endpoints, and how often a delivery is tried before it's dead
+	WebhookSender      *webhook.Sender
+	WebhookMaxAttempts int
+	// Subscribers of domain events, and the signal that a transaction recorded new ones
+	EventBus             *events.Bus
+	DomainEventsRecorded chan struct{}
 }
 
-func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]string, jwtSecret []byte, platform, polkaKey string) *ApiConfig {
+func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]string, tokenConfig *auth.TokenConfig, platform, polkaKey string) *ApiConfig {
 	internalLogs := logger.InitiateLogs(logFiles)
 
 	cfg := &ApiConfig{
@@ -27,10 +60,37 @@ func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]str
 		DB:             db,
 		Queries:        queries,
 		AppLogs:        internalLogs,
-		JWTSecret:      jwtSecret,
+		TokenConfig:    tokenConfig,
+		PasswordParams: auth.DefaultPasswordParams(),
 		Platform:       platform,
 		PolkaKey:       polkaKey,
+		LoginThrottle:  auth.NewLoginThrottle(auth.DefaultAccountLimits, auth.DefaultIPLimits),
+		PaymentProviders: map[string]billing.Provider{
+			billing.ProviderPolka: &billing.Polka{APIKey: polkaKey},
+		},
+
+		AccountDeletionGracePeriod: 30 * 24 * time.Hour,
+		DataExportDir:              "exports",
+		DataExportLinkTTL:          24 * time.Hour,
+		SubscriptionPeriod:         30 * 24 * time.Hour,
+		Plans:                      entitlements.DefaultPlans(),
+		Profanity:                  profanity.Default(),
+		WebhookSender:              webhook.NewSender(nil),
+		WebhookMaxAttempts:         webhook.DefaultMaxAttempts,
+		EventBus:                   events.NewBus(),
+		DomainEventsRecorded:       make(chan struct{}, 1),
+	}
+	// Receivers on a dev machine are on private addresses
+	if platform == "dev" {
+		cfg.WebhookSender = webhook.NewSender(&http.Client{Timeout: webhook.DefaultTimeout})
 	}
+	cfg.subscribeToDomainEvents()
+	// Until an SMTP server is configured, e-mails end up in the user log
+	cfg.Mailer = mailer.NewLogMailer(func(format string, args ...interface{}) {
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, func() {
+			log.Printf(format, args...)
+		})
+	})
 
 	loggerOutput := func() {
 		output := `(
@@ -40,6 +100,7 @@ func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]str
 			database logs: %s 
 			chirp logs: %s 
 			user logs: %s
+			security logs: %s
 		}
 		)`
 		log.Printf(
@@ -48,6 +109,7 @@ func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]str
 			cfg.AppLogs.DatabaseLog,
 			cfg.AppLogs.ChirpLog,
 			cfg.AppLogs.UserLog,
+			cfg.AppLogs.SecurityLog,
 		)
 	}
 	err := cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, loggerOutput)
@@ -60,7 +122,7 @@ func NewApiConfig(db *sql.DB, queries *database.Queries, logFiles map[string]str
 
 func (cfg *ApiConfig) TransactionalQuery(ctx context.Context, txFunc func(tx *database.Queries) error) error {
 	// Create a new transaction
-	tx, err := cfg.DB.Begin()
+	tx, err := cfg.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -76,9 +138,181 @@ func (cfg *ApiConfig) TransactionalQuery(ctx context.Context, txFunc func(tx *da
 	}()
 
 	// Execute the transaction function
-	if err := txFunc(txQueries); err != nil {
+	if err = txFunc(txQueries); err != nil {
 		return err // Return the error to trigger the rollback
 	}
 
-	return tx.Commit()
+	err = tx.Commit()
+	if err == nil {
+		cfg.notifyDomainEvents()
+	}
+	return err
+}
+
+// Hard-delete accounts whose deletion grace period has passed - their chirps and tokens are removed by ON DELETE CASCADE
+func (cfg *ApiConfig) PurgeDeletedAccounts(ctx context.Context) {
+	now := sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	deletedIDs, err := cfg.Queries.DeleteUsersScheduledForDeletion(ctx, now)
+	output := func() {
+		if err != nil {
+			log.Printf("Failed to delete accounts scheduled for deletion: %s.", err)
+			return
+		}
+		for _, userID := range deletedIDs {
+			log.Printf("User %s deleted after the deletion grace period.", userID)
+		}
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+}
+
+// Remove data exports whose download link has expired, along with their archives
+func (cfg *ApiConfig) PurgeExpiredDataExports(ctx context.Context) {
+	filePaths, err := cfg.Queries.DeleteExpiredDataExports(ctx)
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to delete expired data exports: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		return
+	}
+	for _, filePath := range filePaths {
+		if filePath.Valid {
+			os.Remove(filePath.String)
+		}
+	}
+
+	// Archives of deleted accounts lose their DB row through ON DELETE CASCADE, clean them up by age
+	entries, err := os.ReadDir(cfg.DataExportDir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-(cfg.DataExportLinkTTL + time.Hour))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && !entry.IsDir() && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(cfg.DataExportDir, entry.Name()))
+		}
+	}
+}
+
+// Mark exports interrupted by a restart or crash as failed - they run in the process that was asked for them,
+// and one still pending after the export timeout is never going to finish
+func (cfg *ApiConfig) FailStaleDataExports(ctx context.Context) {
+	failed, err := cfg.Queries.FailStaleDataExports(ctx, time.Now().UTC().Add(-dataExportTimeout))
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to mark stale data exports as failed: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		return
+	}
+	if failed > 0 {
+		output := func() {
+			log.Printf("Marked %d interrupted data exports as failed.", failed)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	}
+}
+
+// Expire subscriptions whose paid period is over without a renewal
+func (cfg *ApiConfig) ExpireLapsedSubscriptions(ctx context.Context) {
+	expiredIDs, err := cfg.Queries.ExpireLapsedSubscriptions(ctx)
+	output := func() {
+		if err != nil {
+			log.Printf("Failed to expire lapsed subscriptions: %s.", err)
+			return
+		}
+		for _, userID := range expiredIDs {
+			log.Printf("Chirpy Red subscription of user %s expired.", userID)
+		}
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+}
+
+// Publish scheduled chirps whose publication time has come
+func (cfg *ApiConfig) PublishScheduledChirps(ctx context.Context) {
+	var published []database.Chirp
+	err := cfg.TransactionalQuery(ctx, func(tx *database.Queries) error {
+		var err error
+		published, err = tx.PublishDueScheduledChirps(ctx)
+		if err != nil {
+			return err
+		}
+		for _, chirp := range published {
+			if err := recordEvent(ctx, tx, aggregateChirp, chirp.ID, eventChirpCreated, chirpResponse(chirp)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	output := func() {
+		if err != nil {
+			log.Printf("Failed to publish scheduled chirps: %s.", err)
+			return
+		}
+		for _, chirp := range published {
+			log.Printf("Scheduled chirp %s by user %s published.", chirp.ID, chirp.UserID)
+		}
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+}
+
+// Send due webhook deliveries from the outbox. A failed attempt is retried with exponential backoff,
+// once a delivery runs out of attempts it's dead and stays in the delivery log until retried by hand.
+func (cfg *ApiConfig) DeliverWebhooks(ctx context.Context) {
+	for {
+		deliveries, err := cfg.Queries.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+			LeasedUntil:   time.Now().UTC().Add(webhookDeliveryLease),
+			MaxDeliveries: webhookDeliveryBatchSize,
+		})
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to claim due webhook deliveries: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			cfg.deliverWebhook(ctx, delivery)
+		}
+		if len(deliveries) < webhookDeliveryBatchSize {
+			return
+		}
+	}
+}
+
+func (cfg *ApiConfig) deliverWebhook(ctx context.Context, delivery database.ClaimDueWebhookDeliveriesRow) {
+	statusCode, sendErr := cfg.WebhookSender.Send(ctx, delivery.Url, delivery.Secret, delivery.EventType, delivery.ID.String(), delivery.Payload)
+
+	now := time.Now().UTC()
+	attempt := database.RecordWebhookDeliveryAttemptParams{
+		ID:            delivery.ID,
+		Status:        webhookDeliveryDelivered,
+		NextAttemptAt: now,
+	}
+	if statusCode != 0 {
+		attempt.LastStatusCode = sql.NullInt32{Int32: int32(statusCode), Valid: true}
+	}
+	if sendErr != nil {
+		attempt.LastError = sql.NullString{String: sendErr.Error(), Valid: true}
+		failedAttempts := int(delivery.Attempts) + 1
+		if failedAttempts >= cfg.WebhookMaxAttempts {
+			attempt.Status = webhookDeliveryDead
+		} else {
+			attempt.Status = webhookDeliveryPending
+			attempt.NextAttemptAt = now.Add(webhook.Backoff(failedAttempts))
+		}
+	}
+
+	err := cfg.Queries.RecordWebhookDeliveryAttempt(ctx, attempt)
+	output := func() {
+		if err != nil {
+			log.Printf("Failed to record the attempt of webhook delivery %s: %s.", delivery.ID, err)
+		}
+		if attempt.Status == webhookDeliveryDead {
+			log.Printf("Webhook delivery %s to %s is dead after %d attempts: %s.", delivery.ID, delivery.Url, delivery.Attempts+1, sendErr)
+		}
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
 }
@@ -0,0 +1,378 @@
+package config
+
+// Queries for personal data exports, run straight against cfg.DB rather than through sqlc.
+// sqlc's :many queries collect every row into a slice before returning, these hand each row
+// to a callback as it is read, so an export never has to hold all of a user's data in memory.
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+type ExportProfile struct {
+	ID                  uuid.UUID  `json:"id"`
+	Email               string     `json:"email"`
+	Role                string     `json:"role"`
+	IsChirpyRed         bool       `json:"is_chirpy_red"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at"`
+	ProfanityFilter     bool       `json:"profanity_filter"`
+}
+
+type ExportChirp struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	MediaUrls []string  `json:"media_urls"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExportScheduledChirp struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	MediaUrls []string  `json:"media_urls"`
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type ExportSession struct {
+	ID         int32      `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IpAddress  string     `json:"ip_address"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type ExportPersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+type ExportOAuthClient struct {
+	ID           string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectUris []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ExportOAuthGrant struct {
+	ClientID  string     `json:"client_id"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+type ExportMessage struct {
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+type ExportSubscription struct {
+	Plan               string     `json:"plan"`
+	Status             string     `json:"status"`
+	CurrentPeriodStart time.Time  `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time  `json:"current_period_end"`
+	CancelledAt        *time.Time `json:"cancelled_at"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+type ExportWebhookEndpoint struct {
+	ID         uuid.UUID `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	AllUsers   bool      `json:"all_users"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type ExportUserRelation struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const exportProfile = `
+SELECT
+    u.id,
+    u.email,
+    u.role,
+    EXISTS (
+        SELECT 1
+        FROM subscriptions s
+        WHERE s.user_id = u.id AND s.status IN ('active', 'cancelled') AND s.current_period_end > NOW()
+    ) AS is_chirpy_red,
+    u.created_at,
+    u.updated_at,
+    u.deletion_scheduled_at,
+    u.profanity_filter
+FROM users u
+WHERE u.id = $1
+`
+
+func (cfg *ApiConfig) getExportProfile(ctx context.Context, userID uuid.UUID) (ExportProfile, error) {
+	row := cfg.DB.QueryRowContext(ctx, exportProfile, userID)
+	var i ExportProfile
+	var deletionScheduledAt sql.NullTime
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Role,
+		&i.IsChirpyRed,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&deletionScheduledAt,
+		&i.ProfanityFilter,
+	)
+	i.DeletionScheduledAt = nullTimeToPtr(deletionScheduledAt)
+	return i, err
+}
+
+const exportChirps = `
+SELECT id, body, media_urls, created_at, updated_at
+FROM chirps
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportChirps(ctx context.Context, userID uuid.UUID, fn func(ExportChirp) error) error {
+	return streamRows(ctx, cfg.DB, exportChirps, userID, func(rows *sql.Rows) (ExportChirp, error) {
+		var i ExportChirp
+		err := rows.Scan(&i.ID, &i.Body, pq.Array(&i.MediaUrls), &i.CreatedAt, &i.UpdatedAt)
+		return i, err
+	}, fn)
+}
+
+const exportScheduledChirps = `
+SELECT id, body, media_urls, publish_at, created_at
+FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at
+`
+
+func (cfg *ApiConfig) streamExportScheduledChirps(ctx context.Context, userID uuid.UUID, fn func(ExportScheduledChirp) error) error {
+	return streamRows(ctx, cfg.DB, exportScheduledChirps, userID, func(rows *sql.Rows) (ExportScheduledChirp, error) {
+		var i ExportScheduledChirp
+		err := rows.Scan(&i.ID, &i.Body, pq.Array(&i.MediaUrls), &i.PublishAt, &i.CreatedAt)
+		return i, err
+	}, fn)
+}
+
+const exportSessions = `
+SELECT id, user_agent, ip_address, created_at, last_used_at, expires_at, revoked_at
+FROM refresh_tokens
+WHERE user_id = $1
+ORDER BY id
+`
+
+func (cfg *ApiConfig) streamExportSessions(ctx context.Context, userID uuid.UUID, fn func(ExportSession) error) error {
+	return streamRows(ctx, cfg.DB, exportSessions, userID, func(rows *sql.Rows) (ExportSession, error) {
+		var i ExportSession
+		var createdAt, lastUsedAt, revokedAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&createdAt,
+			&lastUsedAt,
+			&i.ExpiresAt,
+			&revokedAt,
+		)
+		i.CreatedAt = nullTimeToPtr(createdAt)
+		i.LastUsedAt = nullTimeToPtr(lastUsedAt)
+		i.RevokedAt = nullTimeToPtr(revokedAt)
+		return i, err
+	}, fn)
+}
+
+const exportPersonalAccessTokens = `
+SELECT id, name, scopes, created_at, expires_at, last_used_at, revoked_at
+FROM personal_access_tokens
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportPersonalAccessTokens(ctx context.Context, userID uuid.UUID, fn func(ExportPersonalAccessToken) error) error {
+	return streamRows(ctx, cfg.DB, exportPersonalAccessTokens, userID, func(rows *sql.Rows) (ExportPersonalAccessToken, error) {
+		var i ExportPersonalAccessToken
+		var expiresAt, lastUsedAt, revokedAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			pq.Array(&i.Scopes),
+			&i.CreatedAt,
+			&expiresAt,
+			&lastUsedAt,
+			&revokedAt,
+		)
+		i.ExpiresAt = nullTimeToPtr(expiresAt)
+		i.LastUsedAt = nullTimeToPtr(lastUsedAt)
+		i.RevokedAt = nullTimeToPtr(revokedAt)
+		return i, err
+	}, fn)
+}
+
+const exportOAuthClients = `
+SELECT id, name, redirect_uris, created_at
+FROM oauth_clients
+WHERE owner_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportOAuthClients(ctx context.Context, userID uuid.UUID, fn func(ExportOAuthClient) error) error {
+	return streamRows(ctx, cfg.DB, exportOAuthClients, userID, func(rows *sql.Rows) (ExportOAuthClient, error) {
+		var i ExportOAuthClient
+		err := rows.Scan(&i.ID, &i.Name, pq.Array(&i.RedirectUris), &i.CreatedAt)
+		return i, err
+	}, fn)
+}
+
+const exportOAuthGrants = `
+SELECT client_id, scopes, created_at, expires_at, revoked_at
+FROM oauth_refresh_tokens
+WHERE user_id = $1
+ORDER BY id
+`
+
+func (cfg *ApiConfig) streamExportOAuthGrants(ctx context.Context, userID uuid.UUID, fn func(ExportOAuthGrant) error) error {
+	return streamRows(ctx, cfg.DB, exportOAuthGrants, userID, func(rows *sql.Rows) (ExportOAuthGrant, error) {
+		var i ExportOAuthGrant
+		var revokedAt sql.NullTime
+		err := rows.Scan(
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&revokedAt,
+		)
+		i.RevokedAt = nullTimeToPtr(revokedAt)
+		return i, err
+	}, fn)
+}
+
+const exportBlocks = `
+SELECT blocked_id, created_at
+FROM user_blocks
+WHERE blocker_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportBlocks(ctx context.Context, userID uuid.UUID, fn func(ExportUserRelation) error) error {
+	return streamRows(ctx, cfg.DB, exportBlocks, userID, scanExportUserRelation, fn)
+}
+
+const exportMutes = `
+SELECT muted_id, created_at
+FROM user_mutes
+WHERE muter_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportMutes(ctx context.Context, userID uuid.UUID, fn func(ExportUserRelation) error) error {
+	return streamRows(ctx, cfg.DB, exportMutes, userID, scanExportUserRelation, fn)
+}
+
+func scanExportUserRelation(rows *sql.Rows) (ExportUserRelation, error) {
+	var i ExportUserRelation
+	err := rows.Scan(&i.UserID, &i.CreatedAt)
+	return i, err
+}
+
+// Messages sent and received - both sides of each conversation the user takes part in
+const exportMessages = `
+SELECT m.conversation_id, m.sender_id, m.body, m.created_at, m.read_at
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE c.user_a = $1 OR c.user_b = $1
+ORDER BY m.conversation_id, m.created_at
+`
+
+func (cfg *ApiConfig) streamExportMessages(ctx context.Context, userID uuid.UUID, fn func(ExportMessage) error) error {
+	return streamRows(ctx, cfg.DB, exportMessages, userID, func(rows *sql.Rows) (ExportMessage, error) {
+		var i ExportMessage
+		var readAt sql.NullTime
+		err := rows.Scan(
+			&i.ConversationID,
+			&i.SenderID,
+			&i.Body,
+			&i.CreatedAt,
+			&readAt,
+		)
+		i.ReadAt = nullTimeToPtr(readAt)
+		return i, err
+	}, fn)
+}
+
+const exportSubscriptions = `
+SELECT plan, status, current_period_start, current_period_end, cancelled_at, created_at
+FROM subscriptions
+WHERE user_id = $1
+`
+
+func (cfg *ApiConfig) streamExportSubscriptions(ctx context.Context, userID uuid.UUID, fn func(ExportSubscription) error) error {
+	return streamRows(ctx, cfg.DB, exportSubscriptions, userID, func(rows *sql.Rows) (ExportSubscription, error) {
+		var i ExportSubscription
+		var cancelledAt sql.NullTime
+		err := rows.Scan(
+			&i.Plan,
+			&i.Status,
+			&i.CurrentPeriodStart,
+			&i.CurrentPeriodEnd,
+			&cancelledAt,
+			&i.CreatedAt,
+		)
+		i.CancelledAt = nullTimeToPtr(cancelledAt)
+		return i, err
+	}, fn)
+}
+
+// Secrets are left out - they're credentials, not personal data
+const exportWebhookEndpoints = `
+SELECT id, url, event_types, all_users, created_at
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at
+`
+
+func (cfg *ApiConfig) streamExportWebhookEndpoints(ctx context.Context, userID uuid.UUID, fn func(ExportWebhookEndpoint) error) error {
+	return streamRows(ctx, cfg.DB, exportWebhookEndpoints, userID, func(rows *sql.Rows) (ExportWebhookEndpoint, error) {
+		var i ExportWebhookEndpoint
+		err := rows.Scan(&i.ID, &i.URL, pq.Array(&i.EventTypes), &i.AllUsers, &i.CreatedAt)
+		return i, err
+	}, fn)
+}
+
+// Run a query for a single user and pass each scanned row to fn, stopping at the first error
+func streamRows[T any](ctx context.Context, db *sql.DB, query string, userID uuid.UUID, scan func(*sql.Rows) (T, error), fn func(T) error) error {
+	rows, err := db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		i, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/events"
+)
+
+// Aggregates domain events are recorded for - events of one aggregate are dispatched in order
+const (
+	aggregateChirp = "chirp"
+	aggregateUser  = "user"
+)
+
+const (
+	// Events a dispatcher run takes on at a time, and how long they're reserved for it
+	domainEventBatchSize = 100
+	domainEventLease     = time.Minute
+
+	// How often an event is tried before it's dead
+	domainEventMaxAttempts = 10
+
+	// How long dispatched events are kept around for debugging, and dead ones for inspection
+	domainEventRetention     = 7 * 24 * time.Hour
+	deadDomainEventRetention = 30 * 24 * time.Hour
+)
+
+// Record a domain event with the queries of the transaction making the change it describes
+func recordEvent(ctx context.Context, queries *database.Queries, aggregateType string, aggregateID uuid.UUID, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return queries.CreateDomainEvent(ctx, database.CreateDomainEventParams{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		EventType:     eventType,
+		Payload:       payload,
+	})
+}
+
+// Register the in-process subscribers of domain events
+func (cfg *ApiConfig) subscribeToDomainEvents() {
+	for _, eventType := range outgoingEventTypes {
+		cfg.EventBus.Subscribe(eventType, "webhooks", cfg.queueWebhookDeliveries)
+	}
+}
+
+// Wake the dispatcher up after a transaction that may have recorded events, instead of waiting for its next tick
+func (cfg *ApiConfig) notifyDomainEvents() {
+	select {
+	case cfg.DomainEventsRecorded <- struct{}{}:
+	default:
+	}
+}
+
+// Publish recorded domain events to their subscribers until none are due. An event whose subscribers
+// fail is retried with backoff, and holds back the later events of its aggregate until it goes through
+// or runs out of attempts.
+func (cfg *ApiConfig) DispatchDomainEvents(ctx context.Context) {
+	for {
+		claimed, err := cfg.Queries.ClaimDomainEvents(ctx, database.ClaimDomainEventsParams{
+			LeasedUntil: time.Now().UTC().Add(domainEventLease),
+			MaxEvents:   domainEventBatchSize,
+		})
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to claim domain events: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, output)
+			return
+		}
+		if len(claimed) == 0 {
+			return
+		}
+
+		for _, recorded := range claimed {
+			cfg.dispatchDomainEvent(ctx, recorded)
+		}
+	}
+}
+
+func (cfg *ApiConfig) dispatchDomainEvent(ctx context.Context, recorded database.DomainEvent) {
+	event := events.Event{
+		ID:            recorded.ID,
+		AggregateType: recorded.AggregateType,
+		AggregateID:   recorded.AggregateID,
+		Type:          recorded.EventType,
+		Payload:       recorded.Payload,
+		CreatedAt:     recorded.CreatedAt,
+	}
+
+	publishErr := cfg.EventBus.Publish(ctx, event)
+	failedAttempts := int(recorded.Attempts) + 1
+	dead := publishErr != nil && failedAttempts >= domainEventMaxAttempts
+	var err error
+	switch {
+	case publishErr == nil:
+		err = cfg.Queries.MarkDomainEventDispatched(ctx, recorded.ID)
+	case dead:
+		err = cfg.Queries.MarkDomainEventDead(ctx, database.MarkDomainEventDeadParams{
+			ID:        recorded.ID,
+			LastError: sql.NullString{String: publishErr.Error(), Valid: true},
+		})
+	default:
+		err = cfg.Queries.RecordDomainEventFailure(ctx, database.RecordDomainEventFailureParams{
+			ID:            recorded.ID,
+			LastError:     sql.NullString{String: publishErr.Error(), Valid: true},
+			NextAttemptAt: time.Now().UTC().Add(events.RetryDelay(failedAttempts)),
+		})
+	}
+
+	if publishErr != nil || err != nil {
+		output := func() {
+			if dead {
+				log.Printf("Domain event %s (%s of %s %s) is dead after %d attempts: %s.", recorded.ID, recorded.EventType, recorded.AggregateType, recorded.AggregateID, failedAttempts, publishErr)
+			} else if publishErr != nil {
+				log.Printf("Domain event %s (%s of %s %s) failed on attempt %d: %s.", recorded.ID, recorded.EventType, recorded.AggregateType, recorded.AggregateID, failedAttempts, publishErr)
+			}
+			if err != nil {
+				log.Printf("Failed to record the outcome of domain event %s: %s.", recorded.ID, err)
+			}
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, output)
+	}
+}
+
+// Remove dispatched and dead domain events past their retention periods
+func (cfg *ApiConfig) PurgeDomainEvents(ctx context.Context) {
+	now := time.Now().UTC()
+	dispatchedBefore := sql.NullTime{Time: now.Add(-domainEventRetention), Valid: true}
+	if _, err := cfg.Queries.DeleteDispatchedDomainEvents(ctx, dispatchedBefore); err != nil {
+		output := func() {
+			log.Printf("Failed to delete dispatched domain events: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, output)
+	}
+
+	deadBefore := sql.NullTime{Time: now.Add(-deadDomainEventRetention), Valid: true}
+	if _, err := cfg.Queries.DeleteDeadDomainEvents(ctx, deadBefore); err != nil {
+		output := func() {
+			log.Printf("Failed to delete dead domain events: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, output)
+	}
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/events"
+)
+
+func TestDispatchDomainEventOutcome(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int32
+		fail     bool
+		want     string
+	}{
+		{"Published", 0, false, "MarkDomainEventDispatched"},
+		{"Published on a retry", domainEventMaxAttempts - 1, false, "MarkDomainEventDispatched"},
+		{"First failure", 0, true, "RecordDomainEventFailure"},
+		{"Failure with attempts left", domainEventMaxAttempts - 2, true, "RecordDomainEventFailure"},
+		{"Failure on the last attempt", domainEventMaxAttempts - 1, true, "MarkDomainEventDead"},
+	}
+	outcomes := []string{"MarkDomainEventDispatched", "RecordDomainEventFailure", "MarkDomainEventDead"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{}
+			bus := events.NewBus()
+			bus.Subscribe(events.AllEvents, "receiver", func(ctx context.Context, event events.Event) error {
+				if tt.fail {
+					return errors.New("receiver unavailable")
+				}
+				return nil
+			})
+			cfg := &ApiConfig{Queries: database.New(sql.OpenDB(db)), AppLogs: newTestLogs(t), EventBus: bus}
+
+			cfg.dispatchDomainEvent(context.Background(), database.DomainEvent{
+				ID:            uuid.New(),
+				AggregateType: aggregateChirp,
+				AggregateID:   uuid.New(),
+				EventType:     "chirp.created",
+				Attempts:      tt.attempts,
+			})
+
+			for _, outcome := range outcomes {
+				if got := db.hasRun(outcome); got != (outcome == tt.want) {
+					t.Errorf("Expected %s run %v, got %v", outcome, outcome == tt.want, got)
+				}
+			}
+		})
+	}
+}
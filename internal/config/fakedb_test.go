@@ -0,0 +1,129 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/vmilasin/chirpy/internal/logger"
+)
+
+var queryNamePattern = regexp.MustCompile(`-- name: (\w+)`)
+
+// In-memory stand-in for the database - answers queries by their sqlc name with canned rows,
+// and records the name of every statement that was run. Sequences answer successive runs of a
+// statement in turn, before falling back to results.
+type fakeDB struct {
+	mu        sync.Mutex
+	results   map[string]fakeRows
+	sequences map[string][]fakeRows
+	ran       []string
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+// Log files in a temporary directory, for handlers that log
+func newTestLogs(t *testing.T) *logger.AppLogs {
+	dir := t.TempDir()
+	logFiles := map[string]string{}
+	for _, name := range []string{"systemLog", "handlerLog", "databaseLog", "chirpLog", "userLog", "securityLog"} {
+		logFiles[name] = filepath.Join(dir, name+".log")
+	}
+	return logger.InitiateLogs(logFiles)
+}
+
+func (db *fakeDB) Connect(context.Context) (driver.Conn, error) { return &fakeConn{db: db}, nil }
+func (db *fakeDB) Driver() driver.Driver                        { return nil }
+
+func (db *fakeDB) run(query string) fakeRows {
+	name := query
+	if match := queryNamePattern.FindStringSubmatch(query); match != nil {
+		name = match[1]
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.ran = append(db.ran, name)
+	if sequence := db.sequences[name]; len(sequence) > 0 {
+		db.sequences[name] = sequence[1:]
+		return sequence[0]
+	}
+	result, ok := db.results[name]
+	if !ok {
+		return fakeRows{err: sql.ErrNoRows}
+	}
+	return result
+}
+
+// Whether a statement with the given name was run
+func (db *fakeDB) hasRun(name string) bool {
+	return db.timesRun(name) > 0
+}
+
+// How often a statement with the given name was run
+func (db *fakeDB) timesRun(name string) int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	count := 0
+	for _, ran := range db.ran {
+		if ran == name {
+			count++
+		}
+	}
+	return count
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	result := c.db.run(query)
+	if result.err != nil && result.err != sql.ErrNoRows {
+		return nil, result.err
+	}
+	// No rows at all - QueryRow reports sql.ErrNoRows on Scan
+	return &fakeCursor{columns: result.columns, rows: result.rows}, nil
+}
+
+func (c *fakeConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	result := c.db.run(query)
+	if result.err != nil && result.err != sql.ErrNoRows {
+		return nil, result.err
+	}
+	return driver.RowsAffected(len(result.rows)), nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeCursor struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *fakeCursor) Columns() []string { return r.columns }
+func (r *fakeCursor) Close() error      { return nil }
+
+func (r *fakeCursor) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -7,14 +7,24 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/vmilasin/chirpy/internal/profanity"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/entitlements"
+	"github.com/vmilasin/chirpy/internal/mailer"
 )
 
 type errorResponse struct {
@@ -24,6 +34,7 @@ type errorResponse struct {
 type AuthResponse struct {
 	ID    uuid.UUID `json:"user_id"`
 	Email string    `json:"email"`
+	Role  string    `json:"role"`
 }
 
 // RESPONSE HELPER FUNCTIONS
@@ -133,15 +144,121 @@ func (cfg *ApiConfig) PasswordValidation(password string) (int, error) {
 	return 0, nil
 }
 
+// How long the token confirming a new e-mail address stays valid
+const emailChangeTTL = 24 * time.Hour
+
+// Send a confirmation token to the new e-mail address and let the current address know about the change
+func (cfg *ApiConfig) requestEmailChange(context context.Context, userID uuid.UUID, currentEmail, newEmail string) (time.Time, int, error) {
+	token, err := auth.CreateRandomToken(32)
+	if err != nil {
+		return time.Time{}, http.StatusInternalServerError, fmt.Errorf("an error ocurred while creating the confirmation token: %s", err)
+	}
+
+	// Only the latest request can be confirmed
+	var changeReq database.CreateEmailChangeRequestRow
+	err = cfg.TransactionalQuery(context, func(tx *database.Queries) error {
+		if err := tx.DeletePendingEmailChangeRequests(context, userID); err != nil {
+			return err
+		}
+		params := database.CreateEmailChangeRequestParams{
+			UserID:    userID,
+			NewEmail:  newEmail,
+			TokenHash: auth.HashToken(token),
+			ExpiresAt: time.Now().UTC().Add(emailChangeTTL),
+		}
+		var err error
+		changeReq, err = tx.CreateEmailChangeRequest(context, params)
+		return err
+	})
+	if err != nil {
+		output := func() {
+			log.Printf("Could not save e-mail change request for user %s: %s", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		return time.Time{}, http.StatusInternalServerError, errors.New("could not save the e-mail change request")
+	}
+
+	err = cfg.Mailer.Send(context, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy e-mail address",
+		Body: fmt.Sprintf("Use this token to confirm %s as the e-mail address of your Chirpy account:\n\n%s\n\n"+
+			"Send it to POST /api/users/email/confirm before %s. If you didn't ask for this, ignore this message.",
+			newEmail, token, changeReq.ExpiresAt.Format(time.RFC1123)),
+	})
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to send e-mail change confirmation for user %s: %s", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.Queries.DeletePendingEmailChangeRequests(context, userID)
+		return time.Time{}, http.StatusBadGateway, errors.New("could not send the confirmation e-mail")
+	}
+
+	cfg.sendMail(context, mailer.Message{
+		To:      currentEmail,
+		Subject: "Your Chirpy e-mail address is being changed",
+		Body: fmt.Sprintf("Someone asked to change the e-mail address of your Chirpy account to %s.\n\n"+
+			"Nothing changes until the new address is confirmed. If this wasn't you, change your password.", newEmail),
+	})
+
+	return changeReq.ExpiresAt, 0, nil
+}
+
+// Send a notification e-mail - failures are logged, not returned
+func (cfg *ApiConfig) sendMail(context context.Context, msg mailer.Message) {
+	if err := cfg.Mailer.Send(context, msg); err != nil {
+		output := func() {
+			log.Printf("Failed to send e-mail '%s' to %s: %s", msg.Subject, msg.To, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	}
+}
+
+// Check if a DB error is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Returned when a login attempt is rejected because of too many failed attempts
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed login attempts. Please try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+// Single error for every credential failure, so responses don't reveal which e-mail addresses exist
+var errInvalidCredentials = errors.New("invalid e-mail address or password")
+
+// Hash compared against when the e-mail address doesn't exist, so both failures take the same time
+var (
+	dummyPWHash     []byte
+	dummyPWHashOnce sync.Once
+)
+
+func (cfg *ApiConfig) getDummyPWHash() []byte {
+	dummyPWHashOnce.Do(func() {
+		dummyPWHash, _ = auth.CreatePasswordHash("chirpy-dummy-password", cfg.PasswordParams)
+	})
+	return dummyPWHash
+}
+
 // User login
-func (cfg *ApiConfig) UserAuth(context context.Context, email, password string) (AuthResponse, int, error) {
+func (cfg *ApiConfig) UserAuth(context context.Context, email, password, ip string) (AuthResponse, int, error) {
+	// Reject the attempt early if the account or the IP address is backing off
+	if retryAfter, ok := cfg.LoginThrottle.Allow(email, ip); !ok {
+		output := func() {
+			log.Printf("Blocked login attempt for '%s' from %s, retry allowed in %s.", email, ip, retryAfter.Round(time.Second))
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+		return AuthResponse{}, http.StatusTooManyRequests, &LoginThrottledError{RetryAfter: retryAfter}
+	}
+
 	// Check if the provided user exists in the DB
 	userID, err := cfg.Queries.GetUserByEmail(context, email)
-	if err == sql.ErrNoRows {
-		returnError := errors.New("wrong e-mail address. Please type a valid one")
-		return AuthResponse{}, http.StatusUnauthorized, returnError
-	}
-	if err != nil {
+	if err != nil && err != sql.ErrNoRows {
 		output := func() {
 			log.Printf("Failed lookup during user login: %s.", err)
 		}
@@ -150,28 +267,109 @@ func (cfg *ApiConfig) UserAuth(context context.Context, email, password string)
 		return AuthResponse{}, http.StatusInternalServerError, returnError
 	}
 
-	hashedPW, err := cfg.Queries.GetPWHash(context, userID)
+	hashedPW := cfg.getDummyPWHash()
+	if err == nil {
+		hashedPW, err = cfg.Queries.GetPWHash(context, userID)
+		if err != nil {
+			output := func() {
+				log.Printf("Failed lookup during user login: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			returnError := fmt.Errorf("an error occured during user authentication: %s", err)
+			return AuthResponse{}, http.StatusInternalServerError, returnError
+		}
+	}
+
+	match, needsRehash, err := auth.CheckPasswordHash(password, hashedPW, cfg.PasswordParams)
 	if err != nil {
 		output := func() {
-			log.Printf("Failed lookup during user login: %s.", err)
+			log.Printf("Failed to check the password hash of user %s: %s.", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	}
+	if !match || userID == uuid.Nil {
+		result := cfg.LoginThrottle.RegisterFailure(email, ip)
+		output := func() {
+			log.Printf("Failed login attempt for '%s' from %s (account failures: %d, IP failures: %d).", email, ip, result.AccountFailure, result.IPFailure)
+			if result.AccountLocked {
+				log.Printf("Account '%s' locked out for %s.", email, result.RetryAfter.Round(time.Second))
+			}
+			if result.IPLocked {
+				log.Printf("IP address %s locked out for %s.", ip, result.RetryAfter.Round(time.Second))
+			}
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+		return AuthResponse{}, http.StatusUnauthorized, errInvalidCredentials
+	}
+
+	cfg.LoginThrottle.RegisterSuccess(email)
+
+	// Upgrade bcrypt hashes and argon2id hashes with outdated parameters while the password is at hand
+	if needsRehash {
+		cfg.rehashPassword(context, userID, password)
+	}
+
+	role, err := cfg.Queries.GetUserRole(context, userID)
+	if err != nil {
+		output := func() {
+			log.Printf("Failed role lookup during user login: %s.", err)
 		}
 		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
 		returnError := fmt.Errorf("an error occured during user authentication: %s", err)
 		return AuthResponse{}, http.StatusInternalServerError, returnError
 	}
 
-	if err := bcrypt.CompareHashAndPassword(hashedPW, []byte(password)); err != nil {
-		returnError := errors.New("incorrect password")
-		return AuthResponse{}, http.StatusUnauthorized, returnError
+	// Logging in during the grace period keeps the account
+	cancelled, err := cfg.Queries.CancelUserDeletion(context, userID)
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to cancel scheduled deletion of user %s: %s.", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	} else if cancelled > 0 {
+		output := func() {
+			log.Printf("Scheduled deletion of user %s cancelled by login from %s.", userID, ip)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
 	}
 
 	result := AuthResponse{
 		ID:    userID,
 		Email: email,
+		Role:  role,
 	}
 	return result, 0, nil
 }
 
+// Replace a user's password hash with one created with the current algorithm and parameters
+func (cfg *ApiConfig) rehashPassword(context context.Context, userID uuid.UUID, password string) {
+	newHash, err := auth.CreatePasswordHash(password, cfg.PasswordParams)
+	if err == nil {
+		params := database.UpdatePasswordHashParams{
+			PasswordHash: newHash,
+			ID:           userID,
+		}
+		err = cfg.Queries.UpdatePasswordHash(context, params)
+	}
+	output := func() {
+		if err != nil {
+			log.Printf("Failed to rehash the password of user %s: %s.", userID, err)
+			return
+		}
+		log.Printf("Password hash of user %s upgraded to the current parameters.", userID)
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+}
+
+// Get the client's IP address from the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
 // AUTH HELPERS
 
 // Get the access token that was stored in the context after passing through authentication middleware
@@ -184,6 +382,72 @@ func GetAccessTokenFromContext(r *http.Request) string {
 	return ""
 }
 
+// Returned when a refresh token that was already rotated gets presented again
+var errRefreshTokenReused = errors.New("refresh token reuse detected")
+
+// Revoke every token issued from the same login after a rotated refresh token was reused
+func (cfg *ApiConfig) revokeRefreshTokenFamily(r *http.Request, familyID, userID uuid.UUID) {
+	err := cfg.Queries.RevokeRefreshTokenFamily(r.Context(), familyID)
+	output := func() {
+		log.Printf("Refresh token reuse detected for user %s from %s (%s), token family %s revoked.", userID, clientIP(r), r.UserAgent(), familyID)
+		if err != nil {
+			log.Printf("Failed to revoke token family %s: %s.", familyID, err)
+		}
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+}
+
+// Authorization request using a personal access token
+func (cfg *ApiConfig) PersonalAccessTokenAuth(context context.Context, token string) (uuid.UUID, []string, int, error) {
+	pat, err := cfg.Queries.GetPersonalAccessTokenByHash(context, auth.HashToken(token))
+	if err == sql.ErrNoRows {
+		return uuid.Nil, nil, http.StatusUnauthorized, errors.New("invalid token")
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed personal access token lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		returnError := fmt.Errorf("an error occured during token authentication: %s", err)
+		return uuid.Nil, nil, http.StatusInternalServerError, returnError
+	}
+
+	if pat.RevokedAt.Valid {
+		return uuid.Nil, nil, http.StatusUnauthorized, errors.New("token has been revoked")
+	}
+	if pat.ExpiresAt.Valid && time.Now().UTC().After(pat.ExpiresAt.Time) {
+		return uuid.Nil, nil, http.StatusUnauthorized, errors.New("token has expired")
+	}
+
+	if err := cfg.Queries.TouchPersonalAccessToken(context, pat.ID); err != nil {
+		output := func() {
+			log.Printf("Failed to update personal access token %s usage: %s.", pat.ID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	}
+
+	return pat.UserID, pat.Scopes, 0, nil
+}
+
+// Check if the request's credentials grant a scope - JWT sessions are granted every scope
+func (cfg *ApiConfig) requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	scopes, ok := r.Context().Value(ctxTokenScopes).([]string)
+	if !ok || auth.HasScope(scopes, scope) {
+		return true
+	}
+	cfg.respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token is missing the required scope '%s'.", scope))
+	return false
+}
+
+// Reject personal access tokens and third-party client tokens on endpoints that manage the account's credentials
+func (cfg *ApiConfig) requireUserSession(w http.ResponseWriter, r *http.Request) bool {
+	if _, ok := r.Context().Value(ctxTokenScopes).([]string); !ok {
+		return true
+	}
+	cfg.respondWithError(w, http.StatusForbidden, "This endpoint requires a user login, personal access tokens and client tokens are not accepted.")
+	return false
+}
+
 // Return response based on the result of a failed authentication
 func (cfg *ApiConfig) resolveAuthTokenError(w http.ResponseWriter, err error) {
 	if err.Error() == "invalid or missing Authorization header" {
@@ -211,15 +475,108 @@ func (cfg *ApiConfig) resolveAuthTokenError(w http.ResponseWriter, err error) {
 
 // CHIRP HELPERS
 
-// Check if the chirp passes the length and profanity requirements
-func (cfg *ApiConfig) ChirpValidation(body string, w http.ResponseWriter, r *http.Request) string {
+// Longest media link accepted on a chirp
+const maxMediaURLLength = 2048
+
+// Check if the chirp passes the length and profanity requirements - the maximum length depends on the author's plan
+func (cfg *ApiConfig) ChirpValidation(body string, maxLength int, w http.ResponseWriter) (string, bool) {
 	// Check for maximum Chirp length
-	if body == "" || len(body) > 140 {
-		cfg.respondWithError(w, http.StatusBadRequest, "Chirp must be long 140 characters or less.")
-		return ""
+	if strings.TrimSpace(body) == "" || utf8.RuneCountInString(body) > maxLength {
+		cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Chirp must be long %d characters or less.", maxLength))
+		return "", false
 	}
 
 	// Run the profanity check against the chirp
-	cleanChirp := profanity.ProfanityCheck(body)
-	return cleanChirp
+	cleanChirp := cfg.Profanity.Check(body)
+	return cleanChirp, true
+}
+
+// Check the media attached to a chirp - links to files hosted elsewhere, as many as the author's plan allows
+func (cfg *ApiConfig) MediaValidation(media []string, maxAttachments int) (httpStatus int, err error) {
+	if len(media) > maxAttachments {
+		if maxAttachments == 0 {
+			return http.StatusForbidden, errors.New("Your plan doesn't allow media attachments.")
+		}
+		return http.StatusBadRequest, fmt.Errorf("A chirp can have at most %d media attachments.", maxAttachments)
+	}
+	for _, mediaURL := range media {
+		parsed, err := url.Parse(mediaURL)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" || len(mediaURL) > maxMediaURLLength {
+			return http.StatusBadRequest, fmt.Errorf("Invalid media URL '%s', media must be linked with an https URL.", mediaURL)
+		}
+	}
+	return 0, nil
+}
+
+// Media list to store with a chirp - a nil slice would be written as NULL
+func chirpMedia(media []string) []string {
+	if media == nil {
+		return []string{}
+	}
+	return media
+}
+
+func chirpResponse(chirp database.Chirp) CreateChirpResponse {
+	return CreateChirpResponse{
+		ID:        chirp.ID,
+		Body:      chirp.Body,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		UserID:    chirp.UserID,
+		Media:     chirp.MediaUrls,
+	}
+}
+
+// Entitlements of the user's plan - everyone without a subscription in effect is on the free plan
+func (cfg *ApiConfig) entitlementsFor(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (entitlements.Entitlements, bool) {
+	plan, err := cfg.Queries.GetActiveSubscriptionPlan(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		return cfg.Plans.For(entitlements.PlanFree), true
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to fetch the plan of user %s: %s.", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch the user's plan: '%s'", err))
+		return entitlements.Entitlements{}, false
+	}
+	return cfg.Plans.For(plan), true
+}
+
+// Enforce the hourly chirp limit of the user's plan, counting the chirps posted in the last hour
+func (cfg *ApiConfig) chirpRateLimit(w http.ResponseWriter, r *http.Request, userID uuid.UUID, perHour int) bool {
+	if perHour <= 0 {
+		return true
+	}
+	now := time.Now().UTC()
+	window, err := cfg.Queries.GetChirpRateWindow(r.Context(), database.GetChirpRateWindowParams{
+		UserID:    userID,
+		CreatedAt: now.Add(-time.Hour),
+	})
+	if err != nil {
+		output := func() {
+			log.Printf("Failed to count recent chirps of user %s: %s.", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to count recent chirps: '%s'", err))
+		return false
+	}
+	retryAfter, ok := chirpRateRetryAfter(window, perHour, now)
+	if ok {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	cfg.respondWithError(w, http.StatusTooManyRequests, fmt.Sprintf("Your plan allows %d chirps per hour.", perHour))
+	return false
+}
+
+// Whether another chirp fits in the hourly limit, and the seconds until it does otherwise.
+// A slot frees up once the oldest chirp in the window is an hour old.
+func chirpRateRetryAfter(window database.GetChirpRateWindowRow, perHour int, now time.Time) (int, bool) {
+	if window.ChirpCount < int64(perHour) {
+		return 0, true
+	}
+	retryAfter := window.OldestCreatedAt.Add(time.Hour).Sub(now)
+	return int(math.Max(1, math.Ceil(retryAfter.Seconds()))), false
 }
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestMediaValidation(t *testing.T) {
+	cfg := &ApiConfig{}
+
+	tests := []struct {
+		name           string
+		media          []string
+		maxAttachments int
+		wantStatus     int
+	}{
+		{"No media", nil, 0, 0},
+		{"No media on a plan with media", nil, 4, 0},
+		{"Media on a plan without media", []string{"https://example.com/a.png"}, 0, http.StatusForbidden},
+		{"Within the limit", []string{"https://example.com/a.png", "https://cdn.example.com/b.gif?size=large"}, 4, 0},
+		{"At the limit", []string{"https://example.com/1.png", "https://example.com/2.png"}, 2, 0},
+		{"Over the limit", []string{"https://example.com/1.png", "https://example.com/2.png", "https://example.com/3.png"}, 2, http.StatusBadRequest},
+		{"HTTP", []string{"http://example.com/a.png"}, 4, http.StatusBadRequest},
+		{"No host", []string{"https:///a.png"}, 4, http.StatusBadRequest},
+		{"Relative", []string{"/uploads/a.png"}, 4, http.StatusBadRequest},
+		{"Data URL", []string{"data:image/png;base64,iVBORw0KGgo="}, 4, http.StatusBadRequest},
+		{"Javascript", []string{"javascript:alert(1)"}, 4, http.StatusBadRequest},
+		{"Empty", []string{""}, 4, http.StatusBadRequest},
+		{"Unparseable", []string{"https://example.com/%zz"}, 4, http.StatusBadRequest},
+		{"Longest allowed", []string{"https://example.com/" + strings.Repeat("a", maxMediaURLLength-len("https://example.com/"))}, 4, 0},
+		{"Too long", []string{"https://example.com/" + strings.Repeat("a", maxMediaURLLength)}, 4, http.StatusBadRequest},
+		{"One invalid among valid ones", []string{"https://example.com/a.png", "ftp://example.com/b.png"}, 4, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, err := cfg.MediaValidation(tt.media, tt.maxAttachments)
+			if status != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d (%v)", tt.wantStatus, status, err)
+			}
+			if (err == nil) != (tt.wantStatus == 0) {
+				t.Errorf("Expected error only with a status, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChirpRateRetryAfter(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		count          int64
+		oldest         time.Time
+		perHour        int
+		wantOK         bool
+		wantRetryAfter int
+	}{
+		{"No chirps", 0, time.Time{}, 30, true, 0},
+		{"Below the limit", 29, now.Add(-30 * time.Minute), 30, true, 0},
+		{"At the limit", 30, now.Add(-30 * time.Minute), 30, false, 30 * 60},
+		{"Over the limit after a plan change", 45, now.Add(-59 * time.Minute), 30, false, 60},
+		{"Partial seconds round up", 30, now.Add(-time.Hour + 1500*time.Millisecond), 30, false, 2},
+		{"Oldest chirp just leaving the window", 30, now.Add(-time.Hour + time.Millisecond), 30, false, 1},
+		{"Oldest chirp already out of the window", 30, now.Add(-time.Hour - time.Second), 30, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window := database.GetChirpRateWindowRow{ChirpCount: tt.count, OldestCreatedAt: tt.oldest}
+			retryAfter, ok := chirpRateRetryAfter(window, tt.perHour, now)
+			if ok != tt.wantOK {
+				t.Errorf("Expected allowed %v, got %v", tt.wantOK, ok)
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("Expected Retry-After %d, got %d", tt.wantRetryAfter, retryAfter)
+			}
+		})
+	}
+}
+
+func TestChirpRateLimitUnlimited(t *testing.T) {
+	cfg := &ApiConfig{}
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", nil)
+
+	for _, perHour := range []int{0, -1} {
+		w := httptest.NewRecorder()
+		// No limit means no lookup in the database
+		if !cfg.chirpRateLimit(w, req, uuid.New(), perHour) {
+			t.Errorf("Expected a limit of %d to allow the chirp, got status %d", perHour, w.Code)
+		}
+		if retryAfter := w.Header().Get("Retry-After"); retryAfter != "" {
+			t.Errorf("Expected no Retry-After, got %q", retryAfter)
+		}
+	}
+}
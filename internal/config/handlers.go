@@ -3,9 +3,11 @@ package config
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"text/template"
@@ -14,6 +16,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/vmilasin/chirpy/internal/auth"
 	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/mailer"
 )
 
 type CreateUserParamsInput struct {
@@ -40,16 +43,39 @@ type loginResponse struct {
 	Token        string    `json:"token"`
 	RefreshToken string    `json:"refresh_token"`
 	ChirpyRed    bool      `json:"is_chirpy_red"`
+	Role         string    `json:"role"`
 }
 
 type UpdateUserInfo struct {
-	Email    *string `json:"email"`
-	Password *string `json:"password"`
+	Email           *string `json:"email"`
+	Password        *string `json:"password"`
+	ProfanityFilter *bool   `json:"profanity_filter"`
+}
+
+type UpdateUserResponse struct {
+	ID                    uuid.UUID  `json:"id"`
+	Email                 string     `json:"email"`
+	PendingEmail          string     `json:"pending_email,omitempty"`
+	PendingEmailExpiresAt *time.Time `json:"pending_email_expires_at,omitempty"`
+	ProfanityFilter       *bool      `json:"profanity_filter,omitempty"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type DeleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+type DeleteUserResponse struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
 }
 
 type CreateChirpRequest struct {
-	Body string    `json:"body"`
-	ID   uuid.UUID `json:"user_id"`
+	Body  string    `json:"body"`
+	ID    uuid.UUID `json:"user_id"`
+	Media []string  `json:"media"`
 }
 
 type CreateChirpResponse struct {
@@ -58,17 +84,21 @@ type CreateChirpResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	UserID    uuid.UUID `json:"user_id"`
+	Media     []string  `json:"media"`
+}
+
+type UpdateChirpRequest struct {
+	Body string `json:"body"`
 }
 
 type RefreshTokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
-type EnableChirpyRedRequest struct {
-	Event string `json:"event"`
-	Data  struct {
-		UserID uuid.UUID `json:"user_id"`
-	}
+type ProfanityReloadResponse struct {
+	Languages []string `json:"languages"`
+	Terms     int      `json:"terms"`
 }
 
 // Health check
@@ -136,6 +166,33 @@ func (cfg *ApiConfig) HandlerMetricsReset(w http.ResponseWriter, r *http.Request
 	w.Write([]byte(output))
 }
 
+// Public keys used to verify access tokens
+func (cfg *ApiConfig) HandlerJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	cfg.respondWithJSON(w, http.StatusOK, cfg.TokenConfig.Keys.JWKS())
+}
+
+// Reload the profanity dictionaries from disk, e.g. after editing them
+func (cfg *ApiConfig) HandlerProfanityReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := cfg.Profanity.Reload(); err != nil {
+			output := func() {
+				log.Printf("An error occured while reloading the profanity dictionaries: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SystemLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while reloading the profanity dictionaries, the current ones stay in use: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, ProfanityReloadResponse{
+			Languages: cfg.Profanity.Languages(),
+			Terms:     cfg.Profanity.Len(),
+		})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
 // USER HANDLERS
 // Register a new user
 func (cfg *ApiConfig) HandlerUserRegistration(w http.ResponseWriter, r *http.Request) {
@@ -165,7 +222,7 @@ func (cfg *ApiConfig) HandlerUserRegistration(w http.ResponseWriter, r *http.Req
 		}*/
 
 		// Create a new password hash from the provided PW
-		newPwHash, err := auth.CreatePasswordHash(newUserInput.Password)
+		newPwHash, err := auth.CreatePasswordHash(newUserInput.Password, cfg.PasswordParams)
 		if err != nil {
 			output := func() {
 				log.Printf("Failed to create password hash for new user '%s': %s.", newUserInput.Email, err)
@@ -196,7 +253,7 @@ func (cfg *ApiConfig) HandlerUserRegistration(w http.ResponseWriter, r *http.Req
 			CreatedAt:   createdUser.CreatedAt,
 			UpdatedAt:   createdUser.UpdatedAt,
 			Email:       createdUser.Email,
-			IsChirpyRed: createdUser.IsChirpyRed,
+			IsChirpyRed: false, // New accounts start without a subscription
 		}
 
 		// Respond with JSON
@@ -224,14 +281,18 @@ func (cfg *ApiConfig) HandlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Log in to the desired user
-		loginUser, httpStatus, err := cfg.UserAuth(r.Context(), loginReq.Email, loginReq.Password)
+		loginUser, httpStatus, err := cfg.UserAuth(r.Context(), loginReq.Email, loginReq.Password, clientIP(r))
 		if err != nil {
+			var throttled *LoginThrottledError
+			if errors.As(err, &throttled) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			}
 			cfg.respondWithError(w, httpStatus, err.Error())
 			return
 		}
 
 		// Create a new access token
-		accessTokenString, err := auth.CreateAccessToken(loginUser.ID, cfg.JWTSecret)
+		accessTokenString, err := auth.CreateAccessToken(loginUser.ID, loginUser.Role, cfg.TokenConfig)
 		if err != nil {
 			output := func() {
 				log.Printf("An error ocurred while creating a new access token: %v", err)
@@ -242,7 +303,7 @@ func (cfg *ApiConfig) HandlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Create a new refresh token
-		refreshTokenString, tokenExpiration, err := auth.CreateRefreshToken()
+		refreshTokenString, tokenExpiration, err := auth.CreateRefreshToken(cfg.TokenConfig.RefreshTokenTTL)
 		if err != nil {
 			output := func() {
 				log.Printf("An error ocurred while creating a new refresh token: %v", err)
@@ -253,9 +314,12 @@ func (cfg *ApiConfig) HandlerUserLogin(w http.ResponseWriter, r *http.Request) {
 		}
 
 		newRefreshToken := database.CreateRefreshTokenParams{
-			UserID:       loginUser.ID,
-			RefreshToken: refreshTokenString,
-			ExpiresAt:    tokenExpiration,
+			UserID:    loginUser.ID,
+			TokenHash: auth.HashToken(refreshTokenString),
+			ExpiresAt: tokenExpiration,
+			UserAgent: r.UserAgent(),
+			IpAddress: clientIP(r),
+			FamilyID:  uuid.New(),
 		}
 		if _, err := cfg.Queries.CreateRefreshToken(r.Context(), newRefreshToken); err != nil {
 			output := func() {
@@ -282,6 +346,7 @@ func (cfg *ApiConfig) HandlerUserLogin(w http.ResponseWriter, r *http.Request) {
 			Token:        accessTokenString,
 			RefreshToken: refreshTokenString,
 			ChirpyRed:    isChirpyRed,
+			Role:         loginUser.Role,
 		}
 
 		cfg.respondWithJSON(w, http.StatusOK, returnResponse)
@@ -292,6 +357,9 @@ func (cfg *ApiConfig) HandlerUserLogin(w http.ResponseWriter, r *http.Request) {
 
 func (cfg *ApiConfig) HandlerUserUpdate(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPut {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
 		userID := r.Context().Value(ctxUserID).(uuid.UUID)
 
 		body, err := io.ReadAll(r.Body)
@@ -305,11 +373,19 @@ func (cfg *ApiConfig) HandlerUserUpdate(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		// Credentials can only be changed from a login - a token that may edit the profile can't take over the account
+		if updateInfo.Email != nil || updateInfo.Password != nil {
+			if !cfg.requireUserSession(w, r) {
+				return
+			}
+		}
+
+		// Every check runs before anything is written, so a rejected request changes nothing
 		if updateInfo.Email != nil {
-			// Validate email
 			httpStatus, err := cfg.EmailValidation(r.Context(), *updateInfo.Email)
 			if err != nil {
 				cfg.respondWithError(w, httpStatus, err.Error())
+				return
 			}
 		}
 
@@ -321,7 +397,7 @@ func (cfg *ApiConfig) HandlerUserUpdate(w http.ResponseWriter, r *http.Request)
 				cfg.respondWithError(w, httpStatus, err.Error())
 			}*/
 			// Create a new PW hash
-			newPwHash, err = auth.CreatePasswordHash(*updateInfo.Password)
+			newPwHash, err = auth.CreatePasswordHash(*updateInfo.Password, cfg.PasswordParams)
 			if err != nil {
 				output := func() {
 					log.Printf("Failed to create password hash for existing user '%s': %s.", userID, err)
@@ -332,17 +408,248 @@ func (cfg *ApiConfig) HandlerUserUpdate(w http.ResponseWriter, r *http.Request)
 			}
 		}
 
-		newParameters := database.UpdateUserParams{
-			Column1: updateInfo.Email,
-			Column2: newPwHash,
-			ID:      userID,
+		updatedUser, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user info update '%s'", err))
+			return
+		}
+
+		response := UpdateUserResponse{
+			ID:              updatedUser.ID,
+			Email:           updatedUser.Email,
+			ProfanityFilter: updateInfo.ProfanityFilter,
 		}
-		updatedUser, err := cfg.Queries.UpdateUser(r.Context(), newParameters)
+
+		// A new e-mail address only takes effect once it's confirmed - the confirmation is sent before
+		// anything else changes, as it's the step most likely to fail
+		if updateInfo.Email != nil {
+			expiresAt, httpStatus, err := cfg.requestEmailChange(r.Context(), updatedUser.ID, updatedUser.Email, *updateInfo.Email)
+			if err != nil {
+				cfg.respondWithError(w, httpStatus, err.Error())
+				return
+			}
+			response.PendingEmail = *updateInfo.Email
+			response.PendingEmailExpiresAt = &expiresAt
+		}
+
+		// A new password signs out every session and token issued under the old one
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			if updateInfo.Password != nil {
+				params := database.UpdatePasswordHashParams{
+					PasswordHash: newPwHash,
+					ID:           userID,
+				}
+				if err := tx.UpdatePasswordHash(r.Context(), params); err != nil {
+					return err
+				}
+				if err := tx.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+					return err
+				}
+				if err := tx.RevokeAllPersonalAccessTokensForUser(r.Context(), userID); err != nil {
+					return err
+				}
+				if err := tx.RevokeAllOAuthRefreshTokensForUser(r.Context(), userID); err != nil {
+					return err
+				}
+			}
+
+			// Whether messages shown to the user are run through the profanity filter
+			if updateInfo.ProfanityFilter != nil {
+				params := database.UpdateUserProfanityFilterParams{
+					ProfanityFilter: *updateInfo.ProfanityFilter,
+					ID:              userID,
+				}
+				if err := tx.UpdateUserProfanityFilter(r.Context(), params); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 		if err != nil {
+			if updateInfo.Email != nil {
+				cfg.Queries.DeletePendingEmailChangeRequests(r.Context(), userID)
+			}
 			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user info update '%s'", err))
 			return
 		}
-		cfg.respondWithJSON(w, http.StatusOK, updatedUser)
+
+		if updateInfo.Password != nil {
+			output := func() {
+				log.Printf("Password changed for user %s from %s, all tokens revoked.", userID, clientIP(r))
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Confirm an e-mail change with the token sent to the new address
+func (cfg *ApiConfig) HandlerUserEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var confirmReq ConfirmEmailChangeRequest
+		if err := json.Unmarshal(body, &confirmReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+		if confirmReq.Token == "" {
+			cfg.respondWithError(w, http.StatusBadRequest, "Missing confirmation token.")
+			return
+		}
+
+		var oldEmail string
+		var changeReq database.ConfirmEmailChangeRequestRow
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			var err error
+			changeReq, err = tx.ConfirmEmailChangeRequest(r.Context(), auth.HashToken(confirmReq.Token))
+			if err != nil {
+				return err
+			}
+			user, err := tx.GetUserByID(r.Context(), changeReq.UserID)
+			if err != nil {
+				return err
+			}
+			oldEmail = user.Email
+			params := database.UpdateUserEmailParams{
+				Email: changeReq.NewEmail,
+				ID:    changeReq.UserID,
+			}
+			return tx.UpdateUserEmail(r.Context(), params)
+		})
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid or expired confirmation token.")
+			return
+		}
+		if isUniqueViolation(err) {
+			cfg.respondWithError(w, http.StatusConflict, "e-mail address already in use. Please try another one")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while confirming an e-mail change: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while confirming the e-mail change: '%s'", err))
+			return
+		}
+
+		output := func() {
+			log.Printf("User %s changed their e-mail address from '%s' to '%s'.", changeReq.UserID, oldEmail, changeReq.NewEmail)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		cfg.sendMail(r.Context(), mailer.Message{
+			To:      oldEmail,
+			Subject: "Your Chirpy e-mail address was changed",
+			Body: fmt.Sprintf("The e-mail address of your Chirpy account was changed to %s.\n\n"+
+				"If you didn't make this change, please contact support right away.", changeReq.NewEmail),
+		})
+
+		response := UpdateUserResponse{
+			ID:    changeReq.UserID,
+			Email: changeReq.NewEmail,
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Schedule the account for deletion after the grace period and sign it out everywhere.
+// Access tokens aren't tracked and stay valid until they expire.
+func (cfg *ApiConfig) HandlerUserDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var deleteReq DeleteUserRequest
+		if err := json.Unmarshal(body, &deleteReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		// Re-enter the password, a stolen access token alone shouldn't be enough to delete an account
+		user, err := cfg.Queries.GetUserByID(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("Failed user lookup during account deletion: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user lookup: '%s'", err))
+			return
+		}
+		// Failures count towards the login throttle, so the token can't be used to guess the password either
+		ip := clientIP(r)
+		if retryAfter, ok := cfg.LoginThrottle.Allow(user.Email, ip); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			cfg.respondWithError(w, http.StatusTooManyRequests, (&LoginThrottledError{RetryAfter: retryAfter}).Error())
+			return
+		}
+		match, _, err := auth.CheckPasswordHash(deleteReq.Password, user.PasswordHash, cfg.PasswordParams)
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to check the password hash of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		}
+		if !match {
+			cfg.LoginThrottle.RegisterFailure(user.Email, ip)
+			output := func() {
+				log.Printf("Failed password check for account deletion of user %s from %s.", userID, ip)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+			cfg.respondWithError(w, http.StatusUnauthorized, "Incorrect password.")
+			return
+		}
+
+		deletionTime := time.Now().UTC().Add(cfg.AccountDeletionGracePeriod)
+		var scheduledAt sql.NullTime
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			params := database.ScheduleUserDeletionParams{
+				DeletionScheduledAt: sql.NullTime{Time: deletionTime, Valid: true},
+				ID:                  userID,
+			}
+			var err error
+			scheduledAt, err = tx.ScheduleUserDeletion(r.Context(), params)
+			if err != nil {
+				return err
+			}
+			if err := tx.RevokeAllRefreshTokensForUser(r.Context(), userID); err != nil {
+				return err
+			}
+			if err := tx.RevokeAllPersonalAccessTokensForUser(r.Context(), userID); err != nil {
+				return err
+			}
+			return tx.RevokeAllOAuthRefreshTokensForUser(r.Context(), userID)
+		})
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to schedule deletion of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to schedule account deletion: '%s'", err))
+			return
+		}
+
+		output := func() {
+			log.Printf("User %s scheduled for deletion at %s, all tokens revoked.", userID, scheduledAt.Time.Format(time.RFC3339))
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		cfg.respondWithJSON(w, http.StatusAccepted, DeleteUserResponse{DeletionScheduledAt: scheduledAt.Time})
 	} else {
 		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
 	}
@@ -366,6 +673,26 @@ func (cfg *ApiConfig) HandlerChirpsGetAll(w http.ResponseWriter, r *http.Request
 				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to parse given authorID: %s.", err))
 				return
 			}
+			// Signed-in users don't see chirps from users they blocked, were blocked by or muted
+			if viewerID, ok := r.Context().Value(ctxUserID).(uuid.UUID); ok {
+				parameters := database.GetChirpsFromAuthorForViewerParams{
+					AuthorID: parsedAuthorID,
+					ViewerID: viewerID,
+					SortDesc: sortDescending,
+				}
+				chirpsFromAuthor, err := cfg.Queries.GetChirpsFromAuthorForViewer(r.Context(), parameters)
+				if err != nil {
+					output := func() {
+						log.Printf("An error occured while fetching chirps: %s.", err)
+					}
+					cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+					cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching chirps: '%s'", err))
+					return
+				}
+				cfg.respondWithJSON(w, http.StatusOK, chirpsFromAuthor)
+				return
+			}
+
 			parameters := database.GetChirpsFromAuthorParams{
 				UserID:  parsedAuthorID,
 				Column2: sortDescending,
@@ -383,6 +710,24 @@ func (cfg *ApiConfig) HandlerChirpsGetAll(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		if viewerID, ok := r.Context().Value(ctxUserID).(uuid.UUID); ok {
+			parameters := database.GetChirpAllForViewerParams{
+				ViewerID: viewerID,
+				SortDesc: sortDescending,
+			}
+			loadedChirps, err := cfg.Queries.GetChirpAllForViewer(r.Context(), parameters)
+			if err != nil {
+				output := func() {
+					log.Printf("An error occured while fetching chirps: %s.", err)
+				}
+				cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching chirps: '%s'", err))
+				return
+			}
+			cfg.respondWithJSON(w, http.StatusOK, loadedChirps)
+			return
+		}
+
 		// Fetch all chirps from the DB
 		loadedChirps, err := cfg.Queries.GetChirpAll(r.Context(), sortDescending)
 		if err != nil {
@@ -411,8 +756,17 @@ func (cfg *ApiConfig) HandlerChirpsGetByID(w http.ResponseWriter, r *http.Reques
 			return
 		}
 
-		// Fetch the requested chirp from the DB
-		loadedChirp, err := cfg.Queries.GetChirpByID(r.Context(), requestedId)
+		// Fetch the requested chirp from the DB - signed-in users can't see chirps of users they blocked or were blocked by
+		var loadedChirp database.Chirp
+		if viewerID, ok := r.Context().Value(ctxUserID).(uuid.UUID); ok {
+			parameters := database.GetChirpByIDForViewerParams{
+				ID:       requestedId,
+				ViewerID: viewerID,
+			}
+			loadedChirp, err = cfg.Queries.GetChirpByIDForViewer(r.Context(), parameters)
+		} else {
+			loadedChirp, err = cfg.Queries.GetChirpByID(r.Context(), requestedId)
+		}
 		if err != nil {
 			cfg.respondWithError(w, http.StatusNotFound, "Chirp not found.")
 			return
@@ -428,6 +782,9 @@ func (cfg *ApiConfig) HandlerChirpsGetByID(w http.ResponseWriter, r *http.Reques
 // POST a chirp
 func (cfg *ApiConfig) HandlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsWrite) {
+			return
+		}
 		userID := r.Context().Value(ctxUserID).(uuid.UUID)
 
 		// Read the request body
@@ -444,16 +801,38 @@ func (cfg *ApiConfig) HandlerChirpsCreate(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		// Validate chirp
-		cleanChirp := cfg.ChirpValidation(chirp.Body, w, r)
+		// Validate chirp against the limits of the user's plan
+		perks, ok := cfg.entitlementsFor(w, r, userID)
+		if !ok {
+			return
+		}
+		cleanChirp, ok := cfg.ChirpValidation(chirp.Body, perks.MaxChirpLength, w)
+		if !ok {
+			return
+		}
+		if httpStatus, err := cfg.MediaValidation(chirp.Media, perks.MaxMediaAttachments); err != nil {
+			cfg.respondWithError(w, httpStatus, err.Error())
+			return
+		}
+		if !cfg.chirpRateLimit(w, r, userID, perks.ChirpsPerHour) {
+			return
+		}
 
 		newChirpData := database.CreateChirpParams{
-			UserID: userID,
-			Body:   cleanChirp,
+			UserID:    userID,
+			Body:      cleanChirp,
+			MediaUrls: chirpMedia(chirp.Media),
 		}
 
-		// Create chirp in database
-		newChirp, err := cfg.Queries.CreateChirp(r.Context(), newChirpData)
+		// Create chirp in database, along with its chirp.created event
+		var newChirp database.Chirp
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			newChirp, err = tx.CreateChirp(r.Context(), newChirpData)
+			if err != nil {
+				return err
+			}
+			return recordEvent(r.Context(), tx, aggregateChirp, newChirp.ID, eventChirpCreated, chirpResponse(newChirp))
+		})
 		if err != nil {
 			output := func() {
 				log.Printf("An error occured during chirp creation: %s.", err)
@@ -463,16 +842,82 @@ func (cfg *ApiConfig) HandlerChirpsCreate(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		newChirpResponse := CreateChirpResponse{
-			ID:        newChirp.ID,
-			Body:      newChirp.Body,
-			CreatedAt: newChirp.CreatedAt,
-			UpdatedAt: newChirp.UpdatedAt,
-			UserID:    newChirp.UserID,
+		// Respond with JSON
+		cfg.respondWithJSON(w, http.StatusCreated, chirpResponse(newChirp))
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Edit the body of a chirp - only the author can, and only if their plan allows editing
+func (cfg *ApiConfig) HandlerChirpsUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get chirpID from the URL.")
+			return
 		}
 
-		// Respond with JSON
-		cfg.respondWithJSON(w, http.StatusCreated, newChirpResponse)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var update UpdateChirpRequest
+		if err := json.Unmarshal(body, &update); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		chirp, err := cfg.Queries.GetChirpByID(r.Context(), chirpID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				cfg.respondWithError(w, http.StatusNotFound, "Failed to find a chirp with provided ID.")
+				return
+			}
+			output := func() {
+				log.Printf("Failed to find chirp: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find chirp: '%s'", err))
+			return
+		}
+		if chirp.UserID != userID {
+			cfg.respondWithError(w, http.StatusForbidden, "Not authorized to edit other user's chirps.")
+			return
+		}
+
+		perks, ok := cfg.entitlementsFor(w, r, userID)
+		if !ok {
+			return
+		}
+		if !perks.CanEditChirps {
+			cfg.respondWithError(w, http.StatusForbidden, "Your plan doesn't allow editing chirps.")
+			return
+		}
+		cleanChirp, ok := cfg.ChirpValidation(update.Body, perks.MaxChirpLength, w)
+		if !ok {
+			return
+		}
+
+		updatedChirp, err := cfg.Queries.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+			Body: cleanChirp,
+			ID:   chirpID,
+		})
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to edit chirp %s: %s.", chirpID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to edit chirp: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, chirpResponse(updatedChirp))
 	} else {
 		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
 	}
@@ -480,6 +925,9 @@ func (cfg *ApiConfig) HandlerChirpsCreate(w http.ResponseWriter, r *http.Request
 
 func (cfg *ApiConfig) HandlerChirpsDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodDelete {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsWrite) {
+			return
+		}
 		userID := r.Context().Value(ctxUserID).(uuid.UUID)
 		chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 		if err != nil {
@@ -501,12 +949,19 @@ func (cfg *ApiConfig) HandlerChirpsDelete(w http.ResponseWriter, r *http.Request
 			return
 		}
 
-		if chirp.UserID != userID {
+		// Moderators and admins can remove anyone's chirps
+		role := r.Context().Value(ctxUserRole).(string)
+		if chirp.UserID != userID && !auth.RoleAtLeast(role, auth.RoleModerator) {
 			cfg.respondWithError(w, http.StatusForbidden, "Not authorized to delete other user's chirps.")
 			return
 		}
 
-		err = cfg.Queries.DeleteChirp(r.Context(), chirpID)
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			if err := tx.DeleteChirp(r.Context(), chirpID); err != nil {
+				return err
+			}
+			return recordEvent(r.Context(), tx, aggregateChirp, chirpID, eventChirpDeleted, chirpResponse(chirp))
+		})
 		if err != nil {
 			output := func() {
 				log.Printf("Failed to delete chirp: %s.", err)
@@ -516,6 +971,13 @@ func (cfg *ApiConfig) HandlerChirpsDelete(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		if chirp.UserID != userID {
+			output := func() {
+				log.Printf("Chirp %s by user %s removed by %s %s.", chirpID, chirp.UserID, role, userID)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+		}
+
 		cfg.respondWithJSON(w, http.StatusNoContent, nil)
 	} else {
 		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
@@ -524,97 +986,112 @@ func (cfg *ApiConfig) HandlerChirpsDelete(w http.ResponseWriter, r *http.Request
 
 // REFRESH TOKENS
 
-// Refresh - return a new access token if a user provides a valid refresh token
+// Refresh - rotate the provided refresh token and return a new access token alongside the new refresh token
 func (cfg *ApiConfig) HandlerRefreshTokenRefresh(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		userID := r.Context().Value(ctxUserID).(uuid.UUID)
 		revokedAt := r.Context().Value(ctxRefreshTokenRevokedAt).(sql.NullTime)
+		tokenID := r.Context().Value(ctxRefreshTokenID).(int32)
+		familyID := r.Context().Value(ctxRefreshTokenFamilyID).(uuid.UUID)
+
+		if revokedAt.Valid {
+			cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token was revoked.")
+			return
+		}
+
+		newRefreshTokenString, tokenExpiration, err := auth.CreateRefreshToken(cfg.TokenConfig.RefreshTokenTTL)
+		if err != nil {
+			output := func() {
+				log.Printf("An error ocurred while creating a new refresh token: %v", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating a new refresh token: %v", err))
+			return
+		}
 
-		if !revokedAt.Valid {
-			newAuthToken, err := auth.CreateAccessToken(userID, cfg.JWTSecret)
+		// Retire the presented token and chain a new one to the same family
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			rotated, err := tx.RotateRefreshToken(r.Context(), tokenID)
 			if err != nil {
-				output := func() {
-					log.Printf("An error ocurred while creating a new access token: %v", err)
-				}
-				cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
-				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating a new access token: %s", err))
+				return err
+			}
+			// Another request already rotated this token in the meantime
+			if rotated == 0 {
+				return errRefreshTokenReused
+			}
+
+			// The new token continues the session, so the sessions list keeps its sign-in and last use times
+			newRefreshToken := database.CreateRotatedRefreshTokenParams{
+				TokenHash: auth.HashToken(newRefreshTokenString),
+				ExpiresAt: tokenExpiration,
+				UserAgent: r.UserAgent(),
+				IpAddress: clientIP(r),
+				ParentID:  tokenID,
+			}
+			_, err = tx.CreateRotatedRefreshToken(r.Context(), newRefreshToken)
+			return err
+		})
+		if err != nil {
+			if errors.Is(err, errRefreshTokenReused) {
+				cfg.revokeRefreshTokenFamily(r, familyID, userID)
+				cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token was revoked.")
 				return
 			}
-			response := RefreshTokenResponse{
-				Token: newAuthToken,
+			output := func() {
+				log.Printf("An error ocurred while rotating the refresh token: %v", err)
 			}
-			cfg.respondWithJSON(w, http.StatusOK, response)
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while rotating the refresh token: %s", err))
 			return
 		}
-		cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token was revoked.")
-
-	} else {
-		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
-	}
-}
 
-// Revoke a refresh token
-func (cfg *ApiConfig) HandlerRefreshTokenRevoke(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodPost {
-		refreshToken := r.Context().Value(ctxRefreshToken).(string)
+		// Pick up role changes made since the last refresh
+		role, err := cfg.Queries.GetUserRole(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured during user role lookup: %v", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user role lookup: %s", err))
+			return
+		}
 
-		err := cfg.Queries.RevokeRefreshToken(r.Context(), refreshToken)
+		newAuthToken, err := auth.CreateAccessToken(userID, role, cfg.TokenConfig)
 		if err != nil {
 			output := func() {
-				log.Printf("An error ocurred while revoking the refresh token in the database: %v", err)
+				log.Printf("An error ocurred while creating a new access token: %v", err)
 			}
 			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
-			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while revoking the refresh token in the database: %s", err))
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating a new access token: %s", err))
 			return
 		}
 
-		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+		response := RefreshTokenResponse{
+			Token:        newAuthToken,
+			RefreshToken: newRefreshTokenString,
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
 	} else {
 		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
 	}
 }
 
-// WEBHOOKS
-
-// Enable chirpy red for a user - Polka webhook
-func (cfg *ApiConfig) HandlerWebhooksPolkaEnableChirpyRed(w http.ResponseWriter, r *http.Request) {
+// Revoke a refresh token
+func (cfg *ApiConfig) HandlerRefreshTokenRevoke(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
-			return
-		}
+		refreshTokenHash := r.Context().Value(ctxRefreshTokenHash).(string)
 
-		var enableChirpyRedRequest EnableChirpyRedRequest
-		if err := json.Unmarshal(body, &enableChirpyRedRequest); err != nil {
-			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
-			return
-		}
-
-		if enableChirpyRedRequest.Event != "user.upgraded" {
-			cfg.respondWithError(w, http.StatusNoContent, "Invalid event.")
-			return
-		}
-		if enableChirpyRedRequest.Event == "user.upgraded" {
-			id, err := cfg.Queries.EnableChirpyRed(r.Context(), enableChirpyRedRequest.Data.UserID)
-			if err != nil {
-				if err == sql.ErrNoRows {
-					cfg.respondWithError(w, http.StatusNotFound, fmt.Sprintf("User %v not found.", id))
-					return
-				}
-
-				output := func() {
-					log.Printf("An error occured when trying to update user's %v ChirpyRed value: %s", id, err)
-				}
-				cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
-				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured when trying to update user's %v ChirpyRed value: %s", id, err))
-				return
+		err := cfg.Queries.RevokeRefreshToken(r.Context(), refreshTokenHash)
+		if err != nil {
+			output := func() {
+				log.Printf("An error ocurred while revoking the refresh token in the database: %v", err)
 			}
-			cfg.respondWithJSON(w, http.StatusNoContent, nil)
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while revoking the refresh token in the database: %s", err))
 			return
 		}
 
-		cfg.respondWithError(w, http.StatusBadRequest, "Something went wrong, please check your request.")
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
 	} else {
 		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
 	}
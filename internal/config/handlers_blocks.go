@@ -0,0 +1,270 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+type BlockedUserResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MutedUserResponse struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BLOCKS
+
+// Block a user - neither user sees the other's chirps until the block is removed
+func (cfg *ApiConfig) HandlerUserBlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		targetID, ok := cfg.targetUserFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		params := database.CreateUserBlockParams{
+			BlockerID: userID,
+			BlockedID: targetID,
+		}
+		if err := cfg.Queries.CreateUserBlock(r.Context(), params); err != nil {
+			output := func() {
+				log.Printf("An error occured while user %s was blocking user %s: %s.", userID, targetID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while blocking the user: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Remove a block
+func (cfg *ApiConfig) HandlerUserUnblock(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		targetID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get userID from the URL.")
+			return
+		}
+
+		params := database.DeleteUserBlockParams{
+			BlockerID: userID,
+			BlockedID: targetID,
+		}
+		deleted, err := cfg.Queries.DeleteUserBlock(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while user %s was unblocking user %s: %s.", userID, targetID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while unblocking the user: '%s'", err))
+			return
+		}
+		if deleted == 0 {
+			cfg.respondWithError(w, http.StatusNotFound, "Block not found.")
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the users the requesting user has blocked
+func (cfg *ApiConfig) HandlerUserBlocksGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		blocks, err := cfg.Queries.GetUserBlocks(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching blocks for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching blocks: '%s'", err))
+			return
+		}
+
+		response := make([]BlockedUserResponse, 0, len(blocks))
+		for _, block := range blocks {
+			response = append(response, BlockedUserResponse{
+				UserID:    block.BlockedID,
+				CreatedAt: block.CreatedAt,
+			})
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// MUTES
+
+// Mute a user - only hides their chirps from the requesting user, the muted user isn't affected
+func (cfg *ApiConfig) HandlerUserMute(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		targetID, ok := cfg.targetUserFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		params := database.CreateUserMuteParams{
+			MuterID: userID,
+			MutedID: targetID,
+		}
+		if err := cfg.Queries.CreateUserMute(r.Context(), params); err != nil {
+			output := func() {
+				log.Printf("An error occured while user %s was muting user %s: %s.", userID, targetID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while muting the user: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Remove a mute
+func (cfg *ApiConfig) HandlerUserUnmute(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		targetID, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get userID from the URL.")
+			return
+		}
+
+		params := database.DeleteUserMuteParams{
+			MuterID: userID,
+			MutedID: targetID,
+		}
+		deleted, err := cfg.Queries.DeleteUserMute(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while user %s was unmuting user %s: %s.", userID, targetID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while unmuting the user: '%s'", err))
+			return
+		}
+		if deleted == 0 {
+			cfg.respondWithError(w, http.StatusNotFound, "Mute not found.")
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the users the requesting user has muted
+func (cfg *ApiConfig) HandlerUserMutesGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		mutes, err := cfg.Queries.GetUserMutes(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching mutes for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching mutes: '%s'", err))
+			return
+		}
+
+		response := make([]MutedUserResponse, 0, len(mutes))
+		for _, mute := range mutes {
+			response = append(response, MutedUserResponse{
+				UserID:    mute.MutedID,
+				CreatedAt: mute.CreatedAt,
+			})
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// BLOCK AND MUTE HELPERS
+
+// Parse the {userID} path value of a block or mute request and make sure it names another, existing user.
+// On failure the error response has already been written.
+func (cfg *ApiConfig) targetUserFromPath(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID := r.Context().Value(ctxUserID).(uuid.UUID)
+	targetID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		cfg.respondWithError(w, http.StatusBadRequest, "Failed to get userID from the URL.")
+		return uuid.Nil, false
+	}
+	if targetID == userID {
+		cfg.respondWithError(w, http.StatusBadRequest, "You can't block or mute yourself.")
+		return uuid.Nil, false
+	}
+
+	if _, err := cfg.Queries.GetUserByID(r.Context(), targetID); err != nil {
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "User not found.")
+			return uuid.Nil, false
+		}
+		output := func() {
+			log.Printf("An error occured during user lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user lookup: %s.", err))
+		return uuid.Nil, false
+	}
+
+	return targetID, true
+}
+
+// Report if either user has blocked the other. Features that let one user reach another
+// (follows, replies, mentions, messages) must refuse when this is true.
+func (cfg *ApiConfig) usersBlocked(ctx context.Context, userA, userB uuid.UUID) (bool, error) {
+	params := database.IsBlockedEitherWayParams{
+		UserA: userA,
+		UserB: userB,
+	}
+	return cfg.Queries.IsBlockedEitherWay(ctx, params)
+}
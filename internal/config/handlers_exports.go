@@ -0,0 +1,394 @@
+package config
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+// Longest an export is allowed to take before it is marked as failed
+const dataExportTimeout = 30 * time.Minute
+
+type DataExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	Status      string     `json:"status"`
+	DownloadURL string     `json:"download_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// DATA EXPORTS
+
+// Start building an archive of the user's data. The download link is only returned in this response
+// and starts working once the export is ready.
+func (cfg *ApiConfig) HandlerDataExportCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		// An export older than the timeout was interrupted by a restart and is never going to finish
+		_, err := cfg.Queries.GetPendingDataExportForUser(r.Context(), database.GetPendingDataExportForUserParams{
+			UserID:       userID,
+			StartedAfter: time.Now().UTC().Add(-dataExportTimeout),
+		})
+		if err == nil {
+			cfg.respondWithError(w, http.StatusConflict, "An export is already being prepared.")
+			return
+		}
+		if err != sql.ErrNoRows {
+			output := func() {
+				log.Printf("An error occured while checking pending exports for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while checking pending exports: '%s'", err))
+			return
+		}
+
+		token, err := auth.CreateRandomToken(32)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating the download token: %s", err))
+			return
+		}
+
+		newExport := database.CreateDataExportParams{
+			UserID:            userID,
+			DownloadTokenHash: auth.HashToken(token),
+			ExpiresAt:         time.Now().UTC().Add(dataExportTimeout + cfg.DataExportLinkTTL),
+		}
+		createdExport, err := cfg.Queries.CreateDataExport(r.Context(), newExport)
+		if err != nil {
+			output := func() {
+				log.Printf("Could not create data export for user %s: %s", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, "Could not create data export.")
+			return
+		}
+
+		go cfg.runDataExport(createdExport.ID, userID)
+
+		response := DataExportResponse{
+			ID:          createdExport.ID,
+			Status:      createdExport.Status,
+			DownloadURL: "/api/exports/" + token,
+			CreatedAt:   createdExport.CreatedAt,
+			ExpiresAt:   createdExport.ExpiresAt,
+		}
+		cfg.respondWithJSON(w, http.StatusAccepted, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Check the status of a data export
+func (cfg *ApiConfig) HandlerDataExportGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		exportID, err := uuid.Parse(r.PathValue("exportID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get exportID from the URL.")
+			return
+		}
+
+		params := database.GetDataExportForUserParams{
+			ID:     exportID,
+			UserID: userID,
+		}
+		dataExport, err := cfg.Queries.GetDataExportForUser(r.Context(), params)
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "Data export not found.")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching data export %s: %s.", exportID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching the data export: '%s'", err))
+			return
+		}
+
+		response := DataExportResponse{
+			ID:          dataExport.ID,
+			Status:      dataExport.Status,
+			CreatedAt:   dataExport.CreatedAt,
+			CompletedAt: nullTimeToPtr(dataExport.CompletedAt),
+			ExpiresAt:   dataExport.ExpiresAt,
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Download a finished export - the token in the link is the only credential, so the link can be opened in a browser
+func (cfg *ApiConfig) HandlerDataExportDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		dataExport, err := cfg.Queries.GetDataExportByTokenHash(r.Context(), auth.HashToken(r.PathValue("token")))
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "Data export not found.")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured during data export lookup: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during data export lookup: '%s'", err))
+			return
+		}
+
+		if time.Now().UTC().After(dataExport.ExpiresAt) {
+			cfg.respondWithError(w, http.StatusGone, "The download link has expired.")
+			return
+		}
+		switch dataExport.Status {
+		case "pending":
+			w.Header().Set("Retry-After", "60")
+			cfg.respondWithError(w, http.StatusConflict, "The export is still being prepared.")
+			return
+		case "failed":
+			cfg.respondWithError(w, http.StatusGone, "The export failed, please request a new one.")
+			return
+		}
+
+		file, err := os.Open(dataExport.FilePath.String)
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to open data export %s: %s.", dataExport.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, "Failed to open the export archive.")
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, "Failed to open the export archive.")
+			return
+		}
+
+		output := func() {
+			log.Printf("Data export %s of user %s downloaded from %s.", dataExport.ID, dataExport.UserID, clientIP(r))
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		fileName := fmt.Sprintf("chirpy-export-%s.zip", info.ModTime().UTC().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+		w.Header().Set("Cache-Control", "no-store")
+		http.ServeContent(w, r, fileName, info.ModTime(), file)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// DATA EXPORT HELPERS
+
+// Build the export archive in the background and record the result
+func (cfg *ApiConfig) runDataExport(exportID, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+	defer cancel()
+
+	archivePath := filepath.Join(cfg.DataExportDir, exportID.String()+".zip")
+	err := cfg.writeDataExportFile(ctx, archivePath, userID)
+	if err != nil {
+		output := func() {
+			log.Printf("Data export %s for user %s failed: %s.", exportID, userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		if err := cfg.Queries.FailDataExport(context.Background(), exportID); err != nil {
+			output := func() {
+				log.Printf("Failed to mark data export %s as failed: %s.", exportID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		}
+		return
+	}
+
+	params := database.CompleteDataExportParams{
+		ID:        exportID,
+		FilePath:  sql.NullString{String: archivePath, Valid: true},
+		ExpiresAt: time.Now().UTC().Add(cfg.DataExportLinkTTL),
+	}
+	if err := cfg.Queries.CompleteDataExport(context.Background(), params); err != nil {
+		output := func() {
+			log.Printf("Failed to mark data export %s as ready: %s.", exportID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		os.Remove(archivePath)
+		return
+	}
+
+	output := func() {
+		log.Printf("Data export %s for user %s is ready.", exportID, userID)
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+}
+
+// Write the archive to a temporary file first, so a half-written archive can never be downloaded
+func (cfg *ApiConfig) writeDataExportFile(ctx context.Context, archivePath string, userID uuid.UUID) error {
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0700); err != nil {
+		return err
+	}
+	tmpPath := archivePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = cfg.writeDataExport(ctx, file, userID)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, archivePath)
+}
+
+// Write every piece of a user's data to a zip archive, one JSON file per kind
+func (cfg *ApiConfig) writeDataExport(ctx context.Context, w io.Writer, userID uuid.UUID) error {
+	archive := zip.NewWriter(w)
+
+	profile, err := cfg.getExportProfile(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+	profileFile, err := archive.Create("profile.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(profileFile)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(profile); err != nil {
+		return fmt.Errorf("profile: %w", err)
+	}
+
+	err = writeExportArray(archive, "chirps.json", func(emit func(ExportChirp) error) error {
+		return cfg.streamExportChirps(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "scheduled_chirps.json", func(emit func(ExportScheduledChirp) error) error {
+		return cfg.streamExportScheduledChirps(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "sessions.json", func(emit func(ExportSession) error) error {
+		return cfg.streamExportSessions(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "personal_access_tokens.json", func(emit func(ExportPersonalAccessToken) error) error {
+		return cfg.streamExportPersonalAccessTokens(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "oauth_clients.json", func(emit func(ExportOAuthClient) error) error {
+		return cfg.streamExportOAuthClients(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "oauth_authorizations.json", func(emit func(ExportOAuthGrant) error) error {
+		return cfg.streamExportOAuthGrants(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "blocks.json", func(emit func(ExportUserRelation) error) error {
+		return cfg.streamExportBlocks(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "mutes.json", func(emit func(ExportUserRelation) error) error {
+		return cfg.streamExportMutes(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "messages.json", func(emit func(ExportMessage) error) error {
+		return cfg.streamExportMessages(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "subscriptions.json", func(emit func(ExportSubscription) error) error {
+		return cfg.streamExportSubscriptions(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+	err = writeExportArray(archive, "webhook_endpoints.json", func(emit func(ExportWebhookEndpoint) error) error {
+		return cfg.streamExportWebhookEndpoints(ctx, userID, emit)
+	})
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// Write a JSON array to the archive one element at a time, as the rows come in from the DB
+func writeExportArray[T any](archive *zip.Writer, name string, stream func(emit func(T) error) error) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, "["); err != nil {
+		return err
+	}
+
+	first := true
+	err = stream(func(item T) error {
+		dat, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		separator := ",\n  "
+		if first {
+			separator = "\n  "
+			first = false
+		}
+		if _, err := io.WriteString(file, separator); err != nil {
+			return err
+		}
+		_, err = file.Write(dat)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	closing := "\n]\n"
+	if first {
+		closing = "]\n"
+	}
+	_, err = io.WriteString(file, closing)
+	return err
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteExportArray(t *testing.T) {
+	type item struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name  string
+		items []item
+		want  string
+	}{
+		{
+			name:  "No rows",
+			items: nil,
+			want:  "[]\n",
+		},
+		{
+			name:  "One row",
+			items: []item{{ID: 1, Name: "a"}},
+			want:  "[\n  {\"id\":1,\"name\":\"a\"}\n]\n",
+		},
+		{
+			name:  "Several rows",
+			items: []item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}},
+			want:  "[\n  {\"id\":1,\"name\":\"a\"},\n  {\"id\":2,\"name\":\"b\"},\n  {\"id\":3,\"name\":\"c\"}\n]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			archive := zip.NewWriter(&buf)
+			err := writeExportArray(archive, "items.json", func(emit func(item) error) error {
+				for _, i := range tt.items {
+					if err := emit(i); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := archive.Close(); err != nil {
+				t.Fatalf("Expected archive to close, got %v", err)
+			}
+
+			got := readArchiveFile(t, buf.Bytes(), "items.json")
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+
+			var decoded []item
+			if err := json.Unmarshal([]byte(got), &decoded); err != nil {
+				t.Fatalf("Expected valid JSON, got %v", err)
+			}
+			if len(decoded) != len(tt.items) {
+				t.Errorf("Expected %d items, got %d", len(tt.items), len(decoded))
+			}
+		})
+	}
+}
+
+func TestWriteExportArrayStreamError(t *testing.T) {
+	streamErr := errors.New("connection reset")
+
+	archive := zip.NewWriter(io.Discard)
+	err := writeExportArray(archive, "items.json", func(emit func(int) error) error {
+		if err := emit(1); err != nil {
+			return err
+		}
+		return streamErr
+	})
+	if !errors.Is(err, streamErr) {
+		t.Fatalf("Expected %v, got %v", streamErr, err)
+	}
+	if !strings.HasPrefix(err.Error(), "items.json: ") {
+		t.Errorf("Expected the error to name the file, got %q", err.Error())
+	}
+}
+
+func readArchiveFile(t *testing.T, dat []byte, name string) string {
+	t.Helper()
+	reader, err := zip.NewReader(bytes.NewReader(dat), int64(len(dat)))
+	if err != nil {
+		t.Fatalf("Expected a valid archive, got %v", err)
+	}
+	file, err := reader.Open(name)
+	if err != nil {
+		t.Fatalf("Expected %s in the archive, got %v", name, err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("Expected to read %s, got %v", name, err)
+	}
+	return string(content)
+}
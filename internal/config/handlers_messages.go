@@ -0,0 +1,505 @@
+package config
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+const (
+	maxMessageLength       = 1000
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
+type CreateConversationRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+type ConversationResponse struct {
+	ID            uuid.UUID  `json:"id"`
+	OtherUserID   uuid.UUID  `json:"other_user_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastMessageAt *time.Time `json:"last_message_at"`
+	UnreadCount   int64      `json:"unread_count"`
+}
+
+type SendMessageRequest struct {
+	Body string `json:"body"`
+}
+
+type MessageResponse struct {
+	ID             uuid.UUID  `json:"id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+type MarkConversationReadResponse struct {
+	MarkedRead int64 `json:"marked_read"`
+}
+
+type UnreadMessagesResponse struct {
+	UnreadCount int64 `json:"unread_count"`
+}
+
+// CONVERSATIONS
+
+// Start a conversation with another user, or return the existing one
+func (cfg *ApiConfig) HandlerConversationsCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var convReq CreateConversationRequest
+		if err := json.Unmarshal(body, &convReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+		if convReq.UserID == uuid.Nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Missing user_id.")
+			return
+		}
+		if convReq.UserID == userID {
+			cfg.respondWithError(w, http.StatusBadRequest, "You can't start a conversation with yourself.")
+			return
+		}
+
+		if _, err := cfg.Queries.GetUserByID(r.Context(), convReq.UserID); err != nil {
+			if err == sql.ErrNoRows {
+				cfg.respondWithError(w, http.StatusNotFound, "User not found.")
+				return
+			}
+			output := func() {
+				log.Printf("An error occured during user lookup: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user lookup: %s.", err))
+			return
+		}
+		if !cfg.checkNotBlocked(w, r, userID, convReq.UserID) {
+			return
+		}
+
+		// The pair is stored with the smaller ID first, so each pair of users has a single conversation
+		userA, userB := userID, convReq.UserID
+		if userB.String() < userA.String() {
+			userA, userB = userB, userA
+		}
+		created := true
+		conversation, err := cfg.Queries.CreateConversation(r.Context(), database.CreateConversationParams{
+			UserA: userA,
+			UserB: userB,
+		})
+		if err == sql.ErrNoRows {
+			created = false
+			conversation, err = cfg.Queries.GetConversationBetween(r.Context(), database.GetConversationBetweenParams{
+				UserA: userA,
+				UserB: userB,
+			})
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while creating a conversation between %s and %s: %s.", userID, convReq.UserID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while creating the conversation: '%s'", err))
+			return
+		}
+
+		response := ConversationResponse{
+			ID:            conversation.ID,
+			OtherUserID:   convReq.UserID,
+			CreatedAt:     conversation.CreatedAt,
+			LastMessageAt: nullTimeToPtr(conversation.LastMessageAt),
+		}
+		if created {
+			cfg.respondWithJSON(w, http.StatusCreated, response)
+			return
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the requesting user's conversations, most recently active first, with their unread counts
+func (cfg *ApiConfig) HandlerConversationsGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		conversations, err := cfg.Queries.GetConversationsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching conversations for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching conversations: '%s'", err))
+			return
+		}
+
+		response := make([]ConversationResponse, 0, len(conversations))
+		for _, conversation := range conversations {
+			response = append(response, ConversationResponse{
+				ID:            conversation.ID,
+				OtherUserID:   conversation.OtherUserID,
+				CreatedAt:     conversation.CreatedAt,
+				LastMessageAt: nullTimeToPtr(conversation.LastMessageAt),
+				UnreadCount:   conversation.UnreadCount,
+			})
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Mark every message the other user sent in a conversation as read
+func (cfg *ApiConfig) HandlerConversationRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		conversation, ok := cfg.conversationFromPath(w, r, userID)
+		if !ok {
+			return
+		}
+
+		params := database.MarkConversationReadParams{
+			ConversationID: conversation.ID,
+			ReaderID:       userID,
+		}
+		marked, err := cfg.Queries.MarkConversationRead(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while marking conversation %s as read: %s.", conversation.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while marking the conversation as read: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, MarkConversationReadResponse{MarkedRead: marked})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Total number of unread messages across all of the requesting user's conversations
+func (cfg *ApiConfig) HandlerMessagesUnread(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		count, err := cfg.Queries.GetUnreadMessageCount(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while counting unread messages for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while counting unread messages: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, UnreadMessagesResponse{UnreadCount: count})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// MESSAGES
+
+// Send a message to the other participant of a conversation
+func (cfg *ApiConfig) HandlerMessagesCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		conversation, ok := cfg.conversationFromPath(w, r, userID)
+		if !ok {
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var msgReq SendMessageRequest
+		if err := json.Unmarshal(body, &msgReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+		if msgReq.Body == "" {
+			cfg.respondWithError(w, http.StatusBadRequest, "Message body can't be empty.")
+			return
+		}
+		if len(msgReq.Body) > maxMessageLength {
+			cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Message is too long, the limit is %d characters.", maxMessageLength))
+			return
+		}
+
+		// A block placed after the conversation started still stops new messages
+		recipientID := conversation.UserA
+		if recipientID == userID {
+			recipientID = conversation.UserB
+		}
+		if !cfg.checkNotBlocked(w, r, userID, recipientID) {
+			return
+		}
+
+		var message database.Message
+		err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+			var err error
+			message, err = tx.CreateMessage(r.Context(), database.CreateMessageParams{
+				ConversationID: conversation.ID,
+				SenderID:       userID,
+				Body:           msgReq.Body,
+			})
+			if err != nil {
+				return err
+			}
+			return tx.TouchConversation(r.Context(), database.TouchConversationParams{
+				ID:            conversation.ID,
+				LastMessageAt: sql.NullTime{Time: message.CreatedAt, Valid: true},
+			})
+		})
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while user %s was sending a message to conversation %s: %s.", userID, conversation.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while sending the message: '%s'", err))
+			return
+		}
+
+		filter, ok := cfg.profanityFilterFor(w, r, userID)
+		if !ok {
+			return
+		}
+		cfg.respondWithJSON(w, http.StatusCreated, cfg.messageResponse(message, filter))
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the messages in a conversation, newest first. When there may be older messages, the response carries
+// a Link header to the next page, whose ?before=<cursor> continues after the last message.
+func (cfg *ApiConfig) HandlerMessagesGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeMessagesRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		params := database.GetMessagesParams{
+			BeforeCreatedAt: time.Now().UTC().Add(time.Minute),
+			BeforeID:        uuid.Max,
+			MaxMessages:     defaultMessagePageSize,
+		}
+		if before := r.URL.Query().Get("before"); before != "" {
+			createdAt, id, err := parseMessageCursor(before)
+			if err != nil {
+				cfg.respondWithError(w, http.StatusBadRequest, "Invalid 'before', expected a cursor from a previous page or an RFC 3339 timestamp.")
+				return
+			}
+			params.BeforeCreatedAt, params.BeforeID = createdAt, id
+		}
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			parsedLimit, err := strconv.Atoi(limit)
+			if err != nil || parsedLimit < 1 || parsedLimit > maxMessagePageSize {
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit', expected a number between 1 and %d.", maxMessagePageSize))
+				return
+			}
+			params.MaxMessages = int32(parsedLimit)
+		}
+
+		conversation, ok := cfg.conversationFromPath(w, r, userID)
+		if !ok {
+			return
+		}
+		params.ConversationID = conversation.ID
+
+		messages, err := cfg.Queries.GetMessages(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching messages for conversation %s: %s.", conversation.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching messages: '%s'", err))
+			return
+		}
+
+		filter, ok := cfg.profanityFilterFor(w, r, userID)
+		if !ok {
+			return
+		}
+		response := make([]MessageResponse, 0, len(messages))
+		for _, message := range messages {
+			response = append(response, cfg.messageResponse(message, filter))
+		}
+
+		if len(messages) == int(params.MaxMessages) {
+			w.Header().Set("Link", nextMessagePageLink(r.URL, messages[len(messages)-1]))
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// MESSAGE HELPERS
+
+// Cursor of the page after a message - its creation time and ID, with the ID breaking ties between messages sent at once
+func encodeMessageCursor(message database.Message) string {
+	cursor := message.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + message.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(cursor))
+}
+
+// Parse the 'before' parameter - a cursor from a previous page, or a plain RFC 3339 timestamp
+// for everything sent before that time
+func parseMessageCursor(before string) (time.Time, uuid.UUID, error) {
+	if createdAt, err := time.Parse(time.RFC3339Nano, before); err == nil {
+		return createdAt, uuid.Nil, nil
+	}
+
+	dat, err := base64.RawURLEncoding.DecodeString(before)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid message cursor")
+	}
+	rawCreatedAt, rawID, ok := strings.Cut(string(dat), ",")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("invalid message cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, rawCreatedAt)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid message cursor")
+	}
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return time.Time{}, uuid.Nil, errors.New("invalid message cursor")
+	}
+	return createdAt, id, nil
+}
+
+// Link header value pointing to the page after the last message of this one, keeping the other query parameters
+func nextMessagePageLink(current *url.URL, last database.Message) string {
+	next := *current
+	query := next.Query()
+	query.Set("before", encodeMessageCursor(last))
+	next.RawQuery = query.Encode()
+	return fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI())
+}
+
+// Load the conversation named by the {conversationID} path value, if the user takes part in it.
+// On failure the error response has already been written.
+func (cfg *ApiConfig) conversationFromPath(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Conversation, bool) {
+	conversationID, err := uuid.Parse(r.PathValue("conversationID"))
+	if err != nil {
+		cfg.respondWithError(w, http.StatusBadRequest, "Failed to get conversationID from the URL.")
+		return database.Conversation{}, false
+	}
+
+	params := database.GetConversationForUserParams{
+		ID:     conversationID,
+		UserID: userID,
+	}
+	conversation, err := cfg.Queries.GetConversationForUser(r.Context(), params)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "Conversation not found.")
+			return database.Conversation{}, false
+		}
+		output := func() {
+			log.Printf("An error occured during conversation lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during conversation lookup: %s.", err))
+		return database.Conversation{}, false
+	}
+
+	return conversation, true
+}
+
+// Refuse with 403 if either user has blocked the other
+func (cfg *ApiConfig) checkNotBlocked(w http.ResponseWriter, r *http.Request, userID, otherUserID uuid.UUID) bool {
+	blocked, err := cfg.usersBlocked(r.Context(), userID, otherUserID)
+	if err != nil {
+		output := func() {
+			log.Printf("An error occured while checking blocks between %s and %s: %s.", userID, otherUserID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while checking blocks: %s.", err))
+		return false
+	}
+	if blocked {
+		cfg.respondWithError(w, http.StatusForbidden, "You can't message this user.")
+		return false
+	}
+	return true
+}
+
+// Whether the user wants message bodies run through the profanity filter.
+// On failure the error response has already been written.
+func (cfg *ApiConfig) profanityFilterFor(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (bool, bool) {
+	filter, err := cfg.Queries.GetUserProfanityFilter(r.Context(), userID)
+	if err != nil && err != sql.ErrNoRows {
+		output := func() {
+			log.Printf("An error occured while loading the profanity filter setting for user %s: %s.", userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while loading user settings: %s.", err))
+		return false, false
+	}
+	// A user deleted in the meantime gets the default
+	if err == sql.ErrNoRows {
+		return true, true
+	}
+	return filter, true
+}
+
+// Messages are stored as sent, the reader's profanity filter setting is applied on the way out
+func (cfg *ApiConfig) messageResponse(message database.Message, filter bool) MessageResponse {
+	body := message.Body
+	if filter {
+		body = cfg.Profanity.Check(body)
+	}
+	return MessageResponse{
+		ID:             message.ID,
+		ConversationID: message.ConversationID,
+		SenderID:       message.SenderID,
+		Body:           body,
+		CreatedAt:      message.CreatedAt,
+		ReadAt:         nullTimeToPtr(message.ReadAt),
+	}
+}
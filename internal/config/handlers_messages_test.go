@@ -0,0 +1,218 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestMessageCursorRoundTrip(t *testing.T) {
+	id := uuid.New()
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+	}{
+		{"Whole seconds", time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)},
+		{"Microseconds", time.Date(2024, 6, 15, 12, 0, 0, 123456000, time.UTC)},
+		{"Other time zone", time.Date(2024, 6, 15, 14, 0, 0, 1000, time.FixedZone("CEST", 2*60*60))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := encodeMessageCursor(database.Message{ID: id, CreatedAt: tt.createdAt})
+			if strings.ContainsAny(cursor, "+/=&?") {
+				t.Errorf("Expected a URL safe cursor, got %q", cursor)
+			}
+
+			createdAt, gotID, err := parseMessageCursor(cursor)
+			if err != nil {
+				t.Fatalf("Expected cursor to parse, got %v", err)
+			}
+			if !createdAt.Equal(tt.createdAt) {
+				t.Errorf("Expected created_at %v, got %v", tt.createdAt, createdAt)
+			}
+			if gotID != id {
+				t.Errorf("Expected ID %s, got %s", id, gotID)
+			}
+		})
+	}
+}
+
+func TestMessageCursorPagesThroughTies(t *testing.T) {
+	// Messages sent in the same transaction share created_at
+	sentAt := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	messages := []database.Message{{ID: uuid.New(), CreatedAt: sentAt.Add(time.Second)}}
+	for i := 0; i < 5; i++ {
+		messages = append(messages, database.Message{ID: uuid.New(), CreatedAt: sentAt})
+	}
+	messages = append(messages, database.Message{ID: uuid.New(), CreatedAt: sentAt.Add(-time.Second)})
+
+	// The GetMessages order and predicate - (created_at, id) before the cursor, newest first
+	before := func(m database.Message, createdAt time.Time, id uuid.UUID) bool {
+		if !m.CreatedAt.Equal(createdAt) {
+			return m.CreatedAt.Before(createdAt)
+		}
+		return bytes.Compare(m.ID[:], id[:]) < 0
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return before(messages[j], messages[i].CreatedAt, messages[i].ID)
+	})
+	page := func(createdAt time.Time, id uuid.UUID) []database.Message {
+		var result []database.Message
+		for _, m := range messages {
+			if before(m, createdAt, id) && len(result) < 2 {
+				result = append(result, m)
+			}
+		}
+		return result
+	}
+
+	var seen []uuid.UUID
+	createdAt, id, err := parseMessageCursor(sentAt.Add(time.Hour).Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("Expected timestamp to parse, got %v", err)
+	}
+	for {
+		result := page(createdAt, id)
+		for _, m := range result {
+			seen = append(seen, m.ID)
+		}
+		if len(result) < 2 {
+			break
+		}
+		createdAt, id, err = parseMessageCursor(encodeMessageCursor(result[len(result)-1]))
+		if err != nil {
+			t.Fatalf("Expected cursor to parse, got %v", err)
+		}
+	}
+
+	if len(seen) != len(messages) {
+		t.Fatalf("Expected %d messages across the pages, got %d", len(messages), len(seen))
+	}
+	for i, m := range messages {
+		if seen[i] != m.ID {
+			t.Errorf("Expected message %d to be %s, got %s", i, m.ID, seen[i])
+		}
+	}
+}
+
+func TestParseMessageCursor(t *testing.T) {
+	timestamp := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name          string
+		before        string
+		wantCreatedAt time.Time
+		wantID        uuid.UUID
+		wantErr       bool
+	}{
+		{"RFC 3339 timestamp", "2024-06-15T12:00:00Z", timestamp, uuid.Nil, false},
+		{"RFC 3339 timestamp with an offset", "2024-06-15T14:00:00+02:00", timestamp, uuid.Nil, false},
+		{"Not base64", "not a cursor!", time.Time{}, uuid.Nil, true},
+		{"No separator", encode("2024-06-15T12:00:00Z"), time.Time{}, uuid.Nil, true},
+		{"Invalid time", encode("yesterday," + uuid.Nil.String()), time.Time{}, uuid.Nil, true},
+		{"Invalid ID", encode("2024-06-15T12:00:00Z,42"), time.Time{}, uuid.Nil, true},
+		{"Date only", "2024-06-15", time.Time{}, uuid.Nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			createdAt, id, err := parseMessageCursor(tt.before)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected %q to be rejected", tt.before)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected %q to parse, got %v", tt.before, err)
+			}
+			if !createdAt.Equal(tt.wantCreatedAt) || id != tt.wantID {
+				t.Errorf("Expected (%v, %s), got (%v, %s)", tt.wantCreatedAt, tt.wantID, createdAt, id)
+			}
+		})
+	}
+}
+
+func TestNextMessagePageLink(t *testing.T) {
+	last := database.Message{ID: uuid.New(), CreatedAt: time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)}
+	current, err := url.Parse("/api/conversations/abc/messages?limit=2&before=2024-06-16T00:00:00Z")
+	if err != nil {
+		t.Fatalf("Expected URL to parse, got %v", err)
+	}
+
+	link := nextMessagePageLink(current, last)
+	target, ok := strings.CutPrefix(link, "<")
+	if !ok || !strings.HasSuffix(target, `>; rel="next"`) {
+		t.Fatalf("Expected a next link, got %q", link)
+	}
+	next, err := url.Parse(strings.TrimSuffix(target, `>; rel="next"`))
+	if err != nil {
+		t.Fatalf("Expected link target to parse, got %v", err)
+	}
+
+	if next.Path != current.Path {
+		t.Errorf("Expected path %s, got %s", current.Path, next.Path)
+	}
+	if limit := next.Query().Get("limit"); limit != "2" {
+		t.Errorf("Expected limit to be kept, got %q", limit)
+	}
+	createdAt, id, err := parseMessageCursor(next.Query().Get("before"))
+	if err != nil {
+		t.Fatalf("Expected the link to carry a valid cursor, got %v", err)
+	}
+	if !createdAt.Equal(last.CreatedAt) || id != last.ID {
+		t.Errorf("Expected cursor of the last message, got (%v, %s)", createdAt, id)
+	}
+}
+
+func TestMessagesGetAllRejectsInvalidParameters(t *testing.T) {
+	cfg := &ApiConfig{}
+
+	tests := []struct {
+		name       string
+		method     string
+		query      string
+		scopes     []string
+		wantStatus int
+	}{
+		{"Wrong method", http.MethodPut, "", nil, http.StatusMethodNotAllowed},
+		{"Missing scope", http.MethodGet, "", []string{auth.ScopeChirpsRead}, http.StatusForbidden},
+		{"Invalid cursor", http.MethodGet, "?before=not-a-cursor", nil, http.StatusBadRequest},
+		{"Limit too low", http.MethodGet, "?limit=0", nil, http.StatusBadRequest},
+		{"Limit too high", http.MethodGet, "?limit=101", nil, http.StatusBadRequest},
+		{"Limit not a number", http.MethodGet, "?limit=all", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejected before the database is needed
+			req := httptest.NewRequest(tt.method, "/api/conversations/"+uuid.NewString()+"/messages"+tt.query, nil)
+			ctx := context.WithValue(req.Context(), ctxUserID, uuid.New())
+			if tt.scopes != nil {
+				ctx = context.WithValue(ctx, ctxTokenScopes, tt.scopes)
+			}
+			w := httptest.NewRecorder()
+
+			cfg.HandlerMessagesGetAll(w, req.WithContext(ctx))
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,665 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+// How long an authorization code can be exchanged for tokens
+const oauthCodeTTL = 10 * time.Minute
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+}
+
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Parameters of an authorization request, carried through the consent form
+type oauthAuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+type oauthConsentPage struct {
+	ClientName          string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	Scopes              []string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Email               string
+	Error               string
+}
+
+// OAUTH
+
+// Register a third-party client application
+func (cfg *ApiConfig) HandlerOAuthClientsCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var clientReq CreateOAuthClientRequest
+		if err := json.Unmarshal(body, &clientReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		if clientReq.Name == "" {
+			cfg.respondWithError(w, http.StatusBadRequest, "Client name is required.")
+			return
+		}
+		if len(clientReq.RedirectURIs) == 0 {
+			cfg.respondWithError(w, http.StatusBadRequest, "At least one redirect URI is required.")
+			return
+		}
+		for _, redirectURI := range clientReq.RedirectURIs {
+			if err := validateRedirectURI(redirectURI); err != nil {
+				cfg.respondWithError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+
+		clientID, err := auth.CreateRandomToken(16)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating the client ID: %s", err))
+			return
+		}
+		// Public clients (mobile or browser apps) can't keep a secret and rely on PKCE alone
+		var clientSecret string
+		secretHash := sql.NullString{}
+		if clientReq.Confidential {
+			clientSecret, err = auth.CreateRandomToken(32)
+			if err != nil {
+				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating the client secret: %s", err))
+				return
+			}
+			secretHash = sql.NullString{String: auth.HashToken(clientSecret), Valid: true}
+		}
+
+		newClient := database.CreateOAuthClientParams{
+			ID:           clientID,
+			SecretHash:   secretHash,
+			Name:         clientReq.Name,
+			RedirectUris: clientReq.RedirectURIs,
+			OwnerID:      userID,
+		}
+		createdClient, err := cfg.Queries.CreateOAuthClient(r.Context(), newClient)
+		if err != nil {
+			output := func() {
+				log.Printf("Failed to register OAuth client '%s' for user %s: %s.", clientReq.Name, userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to register client: '%s'", err))
+			return
+		}
+
+		response := OAuthClientResponse{
+			ClientID:     createdClient.ID,
+			ClientSecret: clientSecret,
+			Name:         createdClient.Name,
+			RedirectURIs: createdClient.RedirectUris,
+			CreatedAt:    createdClient.CreatedAt,
+		}
+		cfg.respondWithJSON(w, http.StatusCreated, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Show the consent screen for an authorization request
+func (cfg *ApiConfig) HandlerOAuthAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		authReq := parseAuthorizeRequest(r.URL.Query())
+
+		client, scopes, ok := cfg.validateAuthorizeRequest(w, r, &authReq)
+		if !ok {
+			return
+		}
+
+		page := oauthConsentPage{
+			ClientName:          client.Name,
+			ClientID:            client.ID,
+			RedirectURI:         authReq.RedirectURI,
+			Scope:               strings.Join(scopes, " "),
+			Scopes:              scopes,
+			State:               authReq.State,
+			CodeChallenge:       authReq.CodeChallenge,
+			CodeChallengeMethod: authReq.CodeChallengeMethod,
+		}
+		cfg.renderConsentPage(w, http.StatusOK, page)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Handle the consent form - log the user in and redirect back to the client with an authorization code
+func (cfg *ApiConfig) HandlerOAuthAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid form.")
+			return
+		}
+		authReq := parseAuthorizeRequest(r.PostForm)
+
+		client, scopes, ok := cfg.validateAuthorizeRequest(w, r, &authReq)
+		if !ok {
+			return
+		}
+
+		if r.PostForm.Get("decision") != "approve" {
+			redirectWithParams(w, r, authReq.RedirectURI, url.Values{
+				"error": {"access_denied"},
+				"state": {authReq.State},
+			})
+			return
+		}
+
+		email := r.PostForm.Get("email")
+		loginUser, httpStatus, err := cfg.UserAuth(r.Context(), email, r.PostForm.Get("password"), clientIP(r))
+		if err != nil {
+			page := oauthConsentPage{
+				ClientName:          client.Name,
+				ClientID:            client.ID,
+				RedirectURI:         authReq.RedirectURI,
+				Scope:               strings.Join(scopes, " "),
+				Scopes:              scopes,
+				State:               authReq.State,
+				CodeChallenge:       authReq.CodeChallenge,
+				CodeChallengeMethod: authReq.CodeChallengeMethod,
+				Email:               email,
+				Error:               err.Error(),
+			}
+			cfg.renderConsentPage(w, httpStatus, page)
+			return
+		}
+
+		code, err := auth.CreateRandomToken(32)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating the authorization code: %s", err))
+			return
+		}
+		newCode := database.CreateOAuthAuthorizationCodeParams{
+			CodeHash:            auth.HashToken(code),
+			ClientID:            client.ID,
+			UserID:              loginUser.ID,
+			RedirectUri:         authReq.RedirectURI,
+			Scopes:              scopes,
+			CodeChallenge:       authReq.CodeChallenge,
+			CodeChallengeMethod: authReq.CodeChallengeMethod,
+			ExpiresAt:           time.Now().UTC().Add(oauthCodeTTL),
+		}
+		if err := cfg.Queries.CreateOAuthAuthorizationCode(r.Context(), newCode); err != nil {
+			output := func() {
+				log.Printf("Could not save authorization code for client %s: %s", client.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			redirectWithParams(w, r, authReq.RedirectURI, url.Values{
+				"error": {"server_error"},
+				"state": {authReq.State},
+			})
+			return
+		}
+
+		output := func() {
+			log.Printf("User %s authorized OAuth client %s for scopes '%s'.", loginUser.ID, client.ID, strings.Join(scopes, " "))
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		redirectWithParams(w, r, authReq.RedirectURI, url.Values{
+			"code":  {code},
+			"state": {authReq.State},
+		})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Token endpoint - exchange an authorization code or a refresh token for new tokens
+func (cfg *ApiConfig) HandlerOAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form.")
+			return
+		}
+
+		client, ok := cfg.authenticateOAuthClient(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			cfg.oauthAuthorizationCodeGrant(w, r, client)
+		case "refresh_token":
+			cfg.oauthRefreshTokenGrant(w, r, client)
+		default:
+			cfg.respondWithOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Supported grant types are authorization_code and refresh_token.")
+		}
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Revocation endpoint (RFC 7009) - responds with 200 whether or not the token existed
+func (cfg *ApiConfig) HandlerOAuthRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid form.")
+			return
+		}
+
+		client, ok := cfg.authenticateOAuthClient(w, r)
+		if !ok {
+			return
+		}
+
+		token := r.PostForm.Get("token")
+		if token == "" {
+			cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing token.")
+			return
+		}
+
+		// Access tokens are short-lived JWTs and expire on their own, only refresh tokens are revocable
+		params := database.RevokeOAuthRefreshTokenParams{
+			TokenHash: auth.HashToken(token),
+			ClientID:  client.ID,
+		}
+		if _, err := cfg.Queries.RevokeOAuthRefreshToken(r.Context(), params); err != nil {
+			output := func() {
+				log.Printf("An error ocurred while revoking an OAuth token for client %s: %v", client.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "Token could not be revoked.")
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// OAUTH HELPERS
+
+func (cfg *ApiConfig) oauthAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, client database.GetOAuthClientRow) {
+	code := r.PostForm.Get("code")
+	if code == "" {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing authorization code.")
+		return
+	}
+
+	// Codes are single-use - consuming it up front means a replayed code fails even if the checks below do too
+	authCode, err := cfg.Queries.ConsumeOAuthAuthorizationCode(r.Context(), auth.HashToken(code))
+	if err == sql.ErrNoRows {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code is invalid, expired or already used.")
+		return
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed authorization code lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	if authCode.ClientID != client.ID || authCode.RedirectUri != r.PostForm.Get("redirect_uri") {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client or redirect URI.")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), authCode.CodeChallenge, authCode.CodeChallengeMethod) {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code verifier.")
+		return
+	}
+
+	response, err := cfg.createOAuthTokens(r.Context(), cfg.Queries, client.ID, authCode.UserID, authCode.Scopes)
+	if err != nil {
+		output := func() {
+			log.Printf("An error ocurred while issuing OAuth tokens for client %s: %v", client.ID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	cfg.respondWithTokens(w, response)
+}
+
+func (cfg *ApiConfig) oauthRefreshTokenGrant(w http.ResponseWriter, r *http.Request, client database.GetOAuthClientRow) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_request", "Missing refresh token.")
+		return
+	}
+
+	tokenHash := auth.HashToken(refreshToken)
+	storedToken, err := cfg.Queries.GetOAuthRefreshToken(r.Context(), tokenHash)
+	if err == sql.ErrNoRows || (err == nil && storedToken.ClientID != client.ID) {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid refresh token.")
+		return
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed OAuth refresh token lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if storedToken.RevokedAt.Valid || time.Now().UTC().After(storedToken.ExpiresAt) {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked or expired.")
+		return
+	}
+
+	// Rotate the refresh token - the old one is revoked in the same transaction the new one is saved in
+	var response OAuthTokenResponse
+	err = cfg.TransactionalQuery(r.Context(), func(tx *database.Queries) error {
+		params := database.RevokeOAuthRefreshTokenParams{
+			TokenHash: tokenHash,
+			ClientID:  client.ID,
+		}
+		revoked, err := tx.RevokeOAuthRefreshToken(r.Context(), params)
+		if err != nil {
+			return err
+		}
+		if revoked == 0 {
+			return errRefreshTokenReused
+		}
+		response, err = cfg.createOAuthTokens(r.Context(), tx, client.ID, storedToken.UserID, storedToken.Scopes)
+		return err
+	})
+	if err == errRefreshTokenReused {
+		cfg.respondWithOAuthError(w, http.StatusBadRequest, "invalid_grant", "Refresh token is revoked or expired.")
+		return
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("An error ocurred while rotating an OAuth refresh token for client %s: %v", client.ID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	cfg.respondWithTokens(w, response)
+}
+
+// Create an access token and save a new refresh token for a client
+func (cfg *ApiConfig) createOAuthTokens(ctx context.Context, queries *database.Queries, clientID string, userID uuid.UUID, scopes []string) (OAuthTokenResponse, error) {
+	accessToken, err := auth.CreateClientAccessToken(userID, clientID, scopes, cfg.TokenConfig)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+	refreshToken, expiresAt, err := auth.CreateRefreshToken(cfg.TokenConfig.RefreshTokenTTL)
+	if err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	newToken := database.CreateOAuthRefreshTokenParams{
+		TokenHash: auth.HashToken(refreshToken),
+		ClientID:  clientID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := queries.CreateOAuthRefreshToken(ctx, newToken); err != nil {
+		return OAuthTokenResponse{}, err
+	}
+
+	return OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(cfg.TokenConfig.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// Token responses must never be cached
+func (cfg *ApiConfig) respondWithTokens(w http.ResponseWriter, response OAuthTokenResponse) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	cfg.respondWithJSON(w, http.StatusOK, response)
+}
+
+// Authenticate the client calling the token or revocation endpoint - HTTP Basic auth or form parameters
+func (cfg *ApiConfig) authenticateOAuthClient(w http.ResponseWriter, r *http.Request) (database.GetOAuthClientRow, bool) {
+	clientID, clientSecret, hasBasicAuth := r.BasicAuth()
+	if !hasBasicAuth {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+	if clientID == "" {
+		cfg.respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Missing client ID.")
+		return database.GetOAuthClientRow{}, false
+	}
+
+	client, err := cfg.Queries.GetOAuthClient(r.Context(), clientID)
+	if err == sql.ErrNoRows {
+		cfg.respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Unknown client.")
+		return database.GetOAuthClientRow{}, false
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed OAuth client lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		cfg.respondWithOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return database.GetOAuthClientRow{}, false
+	}
+
+	if client.SecretHash.Valid && !auth.SecretMatchesHash(clientSecret, client.SecretHash.String) {
+		output := func() {
+			log.Printf("Failed OAuth client authentication for client %s from %s.", clientID, clientIP(r))
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+		cfg.respondWithOAuthError(w, http.StatusUnauthorized, "invalid_client", "Invalid client credentials.")
+		return database.GetOAuthClientRow{}, false
+	}
+
+	return client, true
+}
+
+// Validate an authorization request. Errors about the client or the redirect URI are shown to the user,
+// everything else is reported back to the client through the redirect URI.
+func (cfg *ApiConfig) validateAuthorizeRequest(w http.ResponseWriter, r *http.Request, authReq *oauthAuthorizeRequest) (database.GetOAuthClientRow, []string, bool) {
+	client, err := cfg.lookupOAuthClient(r.Context(), authReq.ClientID)
+	if err != nil {
+		cfg.respondWithError(w, http.StatusBadRequest, err.Error())
+		return client, nil, false
+	}
+
+	redirectURI, registered := matchRedirectURI(client.RedirectUris, authReq.RedirectURI)
+	if !registered {
+		cfg.respondWithError(w, http.StatusBadRequest, "Redirect URI is not registered for this client.")
+		return client, nil, false
+	}
+	authReq.RedirectURI = redirectURI
+
+	redirectError := func(code, description string) {
+		redirectWithParams(w, r, authReq.RedirectURI, url.Values{
+			"error":             {code},
+			"error_description": {description},
+			"state":             {authReq.State},
+		})
+	}
+	if authReq.ResponseType != "code" {
+		redirectError("unsupported_response_type", "Only the authorization code flow is supported.")
+		return client, nil, false
+	}
+	scopes, ok := auth.ParseScopes(authReq.Scope)
+	if !ok || len(scopes) == 0 {
+		redirectError("invalid_scope", "Unknown or missing scope.")
+		return client, nil, false
+	}
+	if authReq.CodeChallenge == "" || authReq.CodeChallengeMethod != auth.PKCEMethodS256 {
+		redirectError("invalid_request", "PKCE with code_challenge_method S256 is required.")
+		return client, nil, false
+	}
+
+	return client, scopes, true
+}
+
+func (cfg *ApiConfig) lookupOAuthClient(ctx context.Context, clientID string) (database.GetOAuthClientRow, error) {
+	if clientID == "" {
+		return database.GetOAuthClientRow{}, fmt.Errorf("missing client_id")
+	}
+	client, err := cfg.Queries.GetOAuthClient(ctx, clientID)
+	if err == sql.ErrNoRows {
+		return client, fmt.Errorf("unknown client")
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("Failed OAuth client lookup: %s.", err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		return client, fmt.Errorf("an error occured during client lookup: %s", err)
+	}
+	return client, nil
+}
+
+// Render the consent screen template
+func (cfg *ApiConfig) renderConsentPage(w http.ResponseWriter, code int, page oauthConsentPage) {
+	consentTemplate := "assets/html_templates/oauth_consent.gohtml"
+
+	t, err := template.ParseFiles(consentTemplate)
+	if err != nil {
+		output := func() {
+			log.Printf("There was an error while trying to parse template %s: %s.", consentTemplate, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+		cfg.respondWithError(w, http.StatusInternalServerError, "Failed to render the consent page.")
+		return
+	}
+
+	// The consent screen must not be framed by other sites (clickjacking)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+
+	if err := t.Execute(w, page); err != nil {
+		output := func() {
+			log.Printf("There was an error while trying to execute template %s: %s.", consentTemplate, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+	}
+}
+
+// OAuth error response (RFC 6749 section 5.2)
+func (cfg *ApiConfig) respondWithOAuthError(w http.ResponseWriter, code int, errorCode, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	cfg.respondWithJSON(w, code, oauthErrorResponse{
+		Error:            errorCode,
+		ErrorDescription: description,
+	})
+}
+
+func parseAuthorizeRequest(values url.Values) oauthAuthorizeRequest {
+	return oauthAuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+// Redirect to a registered redirect URI, adding the query parameters to the ones it already has
+func redirectWithParams(w http.ResponseWriter, r *http.Request, redirectURI string, params url.Values) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "Invalid redirect URI.", http.StatusBadRequest)
+		return
+	}
+	query := target.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	target.RawQuery = query.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// Find the requested redirect URI among the registered ones - only exact matches count, and it can be omitted
+// only if the client registered exactly one
+func matchRedirectURI(registered []string, requested string) (string, bool) {
+	if requested == "" && len(registered) == 1 {
+		return registered[0], true
+	}
+	for _, redirectURI := range registered {
+		if redirectURI == requested {
+			return redirectURI, true
+		}
+	}
+	return "", false
+}
+
+// Redirect URIs must be absolute, without a fragment, and use HTTPS unless they point to the local machine
+func validateRedirectURI(redirectURI string) error {
+	parsed, err := url.Parse(redirectURI)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("invalid redirect URI '%s'", redirectURI)
+	}
+	if parsed.Fragment != "" {
+		return fmt.Errorf("redirect URI '%s' must not contain a fragment", redirectURI)
+	}
+	host := parsed.Hostname()
+	isLocal := host == "localhost" || host == "127.0.0.1" || host == "::1"
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLocal) {
+		return fmt.Errorf("redirect URI '%s' must use HTTPS", redirectURI)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import "testing"
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{"https://app.example.com/callback", "http://localhost:8080/callback"}
+
+	tests := []struct {
+		name       string
+		registered []string
+		requested  string
+		want       string
+		wantOK     bool
+	}{
+		{"Exact match", registered, "https://app.example.com/callback", "https://app.example.com/callback", true},
+		{"Exact match of another registered URI", registered, "http://localhost:8080/callback", "http://localhost:8080/callback", true},
+		{"Omitted with a single registered URI", registered[:1], "", "https://app.example.com/callback", true},
+		{"Omitted with several registered URIs", registered, "", "", false},
+		{"Extra path", registered, "https://app.example.com/callback/../../evil", "", false},
+		{"Extra path segment", registered, "https://app.example.com/callback/extra", "", false},
+		{"Prefix of a registered URI", registered, "https://app.example.com/call", "", false},
+		{"Registered URI as a prefix of the host", registered, "https://app.example.com.evil.com/callback", "", false},
+		{"Extra query", registered, "https://app.example.com/callback?next=https://evil.com", "", false},
+		{"Trailing slash", registered, "https://app.example.com/callback/", "", false},
+		{"Different scheme", registered, "http://app.example.com/callback", "", false},
+		{"Different port", registered, "http://localhost:9090/callback", "", false},
+		{"Different case", registered, "https://APP.example.com/callback", "", false},
+		{"Userinfo", registered, "https://app.example.com@evil.com/callback", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchRedirectURI(tt.registered, tt.requested)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("Expected (%q, %v), got (%q, %v)", tt.want, tt.wantOK, got, ok)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+		wantErr     bool
+	}{
+		{"HTTPS", "https://app.example.com/callback", false},
+		{"HTTPS with a query", "https://app.example.com/callback?source=chirpy", false},
+		{"HTTP on localhost", "http://localhost:8080/callback", false},
+		{"HTTP on 127.0.0.1", "http://127.0.0.1/callback", false},
+		{"HTTP on ::1", "http://[::1]:8080/callback", false},
+		{"HTTP elsewhere", "http://app.example.com/callback", true},
+		{"HTTP on a host starting with localhost", "http://localhost.evil.com/callback", true},
+		{"Fragment", "https://app.example.com/callback#token", true},
+		{"Relative", "/callback", true},
+		{"No host", "https:///callback", true},
+		{"Custom scheme", "chirpy-app://callback", true},
+		{"Javascript", "javascript:alert(1)", true},
+		{"Empty", "", true},
+		{"Unparseable", "https://app.example.com/%zz", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRedirectURI(tt.redirectURI)
+			if tt.wantErr && err == nil {
+				t.Errorf("Expected %q to be rejected", tt.redirectURI)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Expected %q to be accepted, got %v", tt.redirectURI, err)
+			}
+		})
+	}
+}
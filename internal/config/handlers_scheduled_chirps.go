@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+// How far ahead a chirp can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+type CreateScheduledChirpRequest struct {
+	Body      string    `json:"body"`
+	Media     []string  `json:"media"`
+	PublishAt time.Time `json:"publish_at"`
+}
+
+type ScheduledChirpResponse struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	Media     []string  `json:"media"`
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SCHEDULED CHIRPS
+
+// Schedule a chirp to be published later - how many can wait at once depends on the user's plan
+func (cfg *ApiConfig) HandlerScheduledChirpsCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var chirp CreateScheduledChirpRequest
+		if err := json.Unmarshal(body, &chirp); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		now := time.Now().UTC()
+		publishAt := chirp.PublishAt.UTC()
+		if !publishAt.After(now) || publishAt.Sub(now) > maxScheduleAhead {
+			cfg.respondWithError(w, http.StatusBadRequest, "publish_at must be in the future, at most a year from now.")
+			return
+		}
+
+		perks, ok := cfg.entitlementsFor(w, r, userID)
+		if !ok {
+			return
+		}
+		cleanChirp, ok := cfg.ChirpValidation(chirp.Body, perks.MaxChirpLength, w)
+		if !ok {
+			return
+		}
+		if httpStatus, err := cfg.MediaValidation(chirp.Media, perks.MaxMediaAttachments); err != nil {
+			cfg.respondWithError(w, httpStatus, err.Error())
+			return
+		}
+
+		scheduled, err := cfg.Queries.CountScheduledChirpsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while counting scheduled chirps of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while counting scheduled chirps: '%s'", err))
+			return
+		}
+		if scheduled >= int64(perks.MaxScheduledChirps) {
+			cfg.respondWithError(w, http.StatusForbidden, fmt.Sprintf("Your plan allows %d scheduled chirps at a time.", perks.MaxScheduledChirps))
+			return
+		}
+
+		params := database.CreateScheduledChirpParams{
+			UserID:    userID,
+			Body:      cleanChirp,
+			MediaUrls: chirpMedia(chirp.Media),
+			PublishAt: publishAt,
+		}
+		scheduledChirp, err := cfg.Queries.CreateScheduledChirp(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while scheduling a chirp for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to schedule chirp: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusCreated, scheduledChirpResponse(scheduledChirp))
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the requesting user's chirps waiting to be published
+func (cfg *ApiConfig) HandlerScheduledChirpsGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		scheduledChirps, err := cfg.Queries.GetScheduledChirpsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching scheduled chirps of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching scheduled chirps: '%s'", err))
+			return
+		}
+
+		response := make([]ScheduledChirpResponse, 0, len(scheduledChirps))
+		for _, scheduledChirp := range scheduledChirps {
+			response = append(response, scheduledChirpResponse(scheduledChirp))
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Cancel a scheduled chirp before it's published
+func (cfg *ApiConfig) HandlerScheduledChirpsDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireScope(w, r, auth.ScopeChirpsWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		scheduledID, err := uuid.Parse(r.PathValue("scheduledID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get scheduledID from the URL.")
+			return
+		}
+
+		params := database.DeleteScheduledChirpParams{
+			ID:     scheduledID,
+			UserID: userID,
+		}
+		deleted, err := cfg.Queries.DeleteScheduledChirp(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while deleting scheduled chirp %s: %s.", scheduledID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.ChirpLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete scheduled chirp: '%s'", err))
+			return
+		}
+		// Other users' scheduled chirps look the same as ones that don't exist
+		if deleted == 0 {
+			cfg.respondWithError(w, http.StatusNotFound, "Scheduled chirp not found.")
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// SCHEDULED CHIRP HELPERS
+
+func scheduledChirpResponse(scheduledChirp database.ScheduledChirp) ScheduledChirpResponse {
+	return ScheduledChirpResponse{
+		ID:        scheduledChirp.ID,
+		Body:      scheduledChirp.Body,
+		Media:     scheduledChirp.MediaUrls,
+		PublishAt: scheduledChirp.PublishAt,
+		CreatedAt: scheduledChirp.CreatedAt,
+	}
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+// A session is a refresh token family - its ID stays the same when the refresh token is rotated
+type SessionResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  *time.Time `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+type RevokedSessionsResponse struct {
+	Revoked int `json:"revoked"`
+}
+
+// SESSIONS
+
+// List all active sessions (refresh tokens) of a user
+func (cfg *ApiConfig) HandlerSessionsGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		sessions, err := cfg.Queries.GetSessionsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching sessions for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching sessions: '%s'", err))
+			return
+		}
+
+		response := make([]SessionResponse, 0, len(sessions))
+		for _, session := range sessions {
+			response = append(response, SessionResponse{
+				ID:         session.FamilyID,
+				UserAgent:  session.UserAgent,
+				IPAddress:  session.IpAddress,
+				CreatedAt:  nullTimeToPtr(session.CreatedAt),
+				LastUsedAt: nullTimeToPtr(session.LastUsedAt),
+				ExpiresAt:  session.ExpiresAt,
+			})
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Revoke a single session of a user
+func (cfg *ApiConfig) HandlerSessionsDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get sessionID from the URL.")
+			return
+		}
+
+		params := database.GetSessionForUserParams{
+			FamilyID: sessionID,
+			UserID:   userID,
+		}
+		revokedAt, err := cfg.Queries.GetSessionForUser(r.Context(), params)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				cfg.respondWithError(w, http.StatusNotFound, "Session not found.")
+				return
+			}
+			output := func() {
+				log.Printf("Failed to find session %s: %s.", sessionID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find session: '%s'", err))
+			return
+		}
+
+		if !revokedAt.Valid {
+			if err := cfg.Queries.RevokeRefreshTokenFamily(r.Context(), sessionID); err != nil {
+				output := func() {
+					log.Printf("An error ocurred while revoking session %s: %v", sessionID, err)
+				}
+				cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while revoking the session: %s", err))
+				return
+			}
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Log out everywhere else - revoke all sessions except the one whose refresh token was provided
+func (cfg *ApiConfig) HandlerSessionsRevokeOthers(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		refreshTokenHash := r.Context().Value(ctxRefreshTokenHash).(string)
+		revokedAt := r.Context().Value(ctxRefreshTokenRevokedAt).(sql.NullTime)
+
+		if revokedAt.Valid {
+			cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token was revoked.")
+			return
+		}
+
+		params := database.GetOtherActiveRefreshTokensParams{
+			UserID:    userID,
+			TokenHash: refreshTokenHash,
+		}
+		otherTokens, err := cfg.Queries.GetOtherActiveRefreshTokens(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching sessions for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching sessions: '%s'", err))
+			return
+		}
+
+		for _, tokenHash := range otherTokens {
+			if err := cfg.Queries.RevokeRefreshToken(r.Context(), tokenHash); err != nil {
+				output := func() {
+					log.Printf("An error ocurred while revoking sessions for user %s: %v", userID, err)
+				}
+				cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+				cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while revoking sessions: %s", err))
+				return
+			}
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, RevokedSessionsResponse{Revoked: len(otherTokens)})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Convert a nullable DB timestamp into a pointer, so it's marshaled as null when missing
+func nullTimeToPtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+// Plan a subscription is created with when the payment provider doesn't name one
+const defaultSubscriptionPlan = "chirpy_red"
+
+// Subscription statuses - cancelled subscriptions stay in effect until the end of the paid period
+const (
+	subscriptionActive    = "active"
+	subscriptionCancelled = "cancelled"
+	subscriptionExpired   = "expired"
+)
+
+// End of the period of Chirpy Red upgrades from before subscriptions existed - the latest time that
+// still encodes as JSON
+var subscriptionNeverEnds = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+
+type SubscriptionResponse struct {
+	Plan               string     `json:"plan"`
+	Status             string     `json:"status"`
+	IsChirpyRed        bool       `json:"is_chirpy_red"`
+	CurrentPeriodStart time.Time  `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time  `json:"current_period_end"`
+	CancelledAt        *time.Time `json:"cancelled_at"`
+}
+
+// SUBSCRIPTIONS
+
+// The requesting user's Chirpy Red subscription
+func (cfg *ApiConfig) HandlerSubscriptionGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		subscription, err := cfg.Queries.GetSubscriptionByUser(r.Context(), userID)
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "No subscription found.")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching the subscription of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching the subscription: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, SubscriptionResponse{
+			Plan:               subscription.Plan,
+			Status:             subscription.Status,
+			IsChirpyRed:        subscriptionInEffect(subscription, time.Now().UTC()),
+			CurrentPeriodStart: subscription.CurrentPeriodStart,
+			CurrentPeriodEnd:   subscription.CurrentPeriodEnd,
+			CancelledAt:        nullTimeToPtr(subscription.CancelledAt),
+		})
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// The limits and perks of the requesting user's plan
+func (cfg *ApiConfig) HandlerEntitlementsGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileRead) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		perks, ok := cfg.entitlementsFor(w, r, userID)
+		if !ok {
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, perks)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// SUBSCRIPTION HELPERS
+
+// Start or extend a paid period - for upgrades and renewals alike, so a payment made while a period is
+// still running doesn't lose the time left. periodEnd is the end of the period as reported by the payment
+// provider, if it did.
+func (cfg *ApiConfig) activateSubscription(ctx context.Context, queries *database.Queries, userID uuid.UUID, plan string, periodEnd *time.Time) (database.Subscription, error) {
+	var current *database.Subscription
+	subscription, err := queries.GetSubscriptionByUser(ctx, userID)
+	if err == nil {
+		current = &subscription
+	} else if err != sql.ErrNoRows {
+		return database.Subscription{}, err
+	}
+
+	params := nextSubscriptionPeriod(current, plan, periodEnd, time.Now().UTC(), cfg.SubscriptionPeriod)
+	params.UserID = userID
+	return queries.ActivateSubscription(ctx, params)
+}
+
+// Extend a subscription by a period
+func (cfg *ApiConfig) renewSubscription(ctx context.Context, userID uuid.UUID, plan string, periodEnd *time.Time) (database.Subscription, error) {
+	return cfg.activateSubscription(ctx, cfg.Queries, userID, plan, periodEnd)
+}
+
+// The plan and period a payment buys, given the user's current subscription if they have one.
+// A payment before the current period ends continues from its end, so paying early doesn't lose any time,
+// otherwise a new period starts now. A reported period never cuts the current one short.
+func nextSubscriptionPeriod(current *database.Subscription, plan string, periodEnd *time.Time, now time.Time, period time.Duration) database.ActivateSubscriptionParams {
+	if current == nil || !subscriptionInEffect(*current, now) {
+		if plan == "" {
+			plan = defaultSubscriptionPlan
+		}
+		end := now.Add(period)
+		if periodEnd != nil {
+			end = periodEnd.UTC()
+		}
+		return database.ActivateSubscriptionParams{
+			Plan:               plan,
+			CurrentPeriodStart: now,
+			CurrentPeriodEnd:   end,
+		}
+	}
+
+	if plan == "" {
+		plan = current.Plan
+	}
+	start := current.CurrentPeriodEnd
+	end := start.Add(period)
+	if periodEnd != nil {
+		end = periodEnd.UTC()
+	}
+	if end.After(subscriptionNeverEnds) {
+		end = subscriptionNeverEnds
+	}
+	// Providers that report the period also send updates within one, e.g. for an undone cancellation -
+	// those don't start a new period, and neither do payments for a subscription that never ends
+	if !end.After(current.CurrentPeriodEnd) {
+		start = current.CurrentPeriodStart
+		end = current.CurrentPeriodEnd
+	}
+	return database.ActivateSubscriptionParams{
+		Plan:               plan,
+		CurrentPeriodStart: start,
+		CurrentPeriodEnd:   end,
+	}
+}
+
+// Whether a subscription currently grants Chirpy Red - the same rule as the CheckChirpyRed query
+func subscriptionInEffect(subscription database.Subscription, now time.Time) bool {
+	inEffect := subscription.Status == subscriptionActive || subscription.Status == subscriptionCancelled
+	return inEffect && subscription.CurrentPeriodEnd.After(now)
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/billing"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestSubscriptionInEffect(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		status    string
+		periodEnd time.Time
+		want      bool
+	}{
+		{"Active within the period", subscriptionActive, now.Add(time.Hour), true},
+		{"Active after the period", subscriptionActive, now.Add(-time.Hour), false},
+		{"Active at the end of the period", subscriptionActive, now, false},
+		{"Cancelled within the period", subscriptionCancelled, now.Add(time.Hour), true},
+		{"Cancelled after the period", subscriptionCancelled, now.Add(-time.Hour), false},
+		{"Expired within the period", subscriptionExpired, now.Add(time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := database.Subscription{
+				Status:           tt.status,
+				CurrentPeriodEnd: tt.periodEnd,
+			}
+			if got := subscriptionInEffect(subscription, now); got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNextSubscriptionPeriod(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	period := 30 * 24 * time.Hour
+	periodEnd := now.Add(10 * 24 * time.Hour)
+	lapsedEnd := now.Add(-5 * 24 * time.Hour)
+	reportedEnd := periodEnd.Add(period)
+	reportedWithinPeriod := periodEnd
+	legacyEnd := subscriptionNeverEnds
+
+	subscription := func(plan, status string, end time.Time) *database.Subscription {
+		return &database.Subscription{
+			Plan:               plan,
+			Status:             status,
+			CurrentPeriodStart: end.Add(-period),
+			CurrentPeriodEnd:   end,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		current   *database.Subscription
+		plan      string
+		periodEnd *time.Time
+		wantPlan  string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "First upgrade",
+			current:   nil,
+			wantPlan:  defaultSubscriptionPlan,
+			wantStart: now,
+			wantEnd:   now.Add(period),
+		},
+		{
+			name:      "First upgrade with a reported period",
+			current:   nil,
+			plan:      "chirpy_red_yearly",
+			periodEnd: &reportedEnd,
+			wantPlan:  "chirpy_red_yearly",
+			wantStart: now,
+			wantEnd:   reportedEnd,
+		},
+		{
+			name:      "Early renewal continues from the end of the period",
+			current:   subscription("chirpy_red", subscriptionActive, periodEnd),
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd,
+			wantEnd:   periodEnd.Add(period),
+		},
+		{
+			name:      "Renewal after a lapse starts from now",
+			current:   subscription("chirpy_red", subscriptionActive, lapsedEnd),
+			wantPlan:  defaultSubscriptionPlan,
+			wantStart: now,
+			wantEnd:   now.Add(period),
+		},
+		{
+			name:      "Renewal of an expired subscription starts from now",
+			current:   subscription("chirpy_red", subscriptionExpired, periodEnd),
+			wantPlan:  defaultSubscriptionPlan,
+			wantStart: now,
+			wantEnd:   now.Add(period),
+		},
+		{
+			name:      "Renewal after cancelling within the period keeps the paid time",
+			current:   subscription("chirpy_red", subscriptionCancelled, periodEnd),
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd,
+			wantEnd:   periodEnd.Add(period),
+		},
+		{
+			name:      "Renewal after a cancelled period ran out starts from now",
+			current:   subscription("chirpy_red", subscriptionCancelled, lapsedEnd),
+			wantPlan:  defaultSubscriptionPlan,
+			wantStart: now,
+			wantEnd:   now.Add(period),
+		},
+		{
+			name:      "Undone cancellation reported within the period doesn't start a new one",
+			current:   subscription("chirpy_red", subscriptionCancelled, periodEnd),
+			periodEnd: &reportedWithinPeriod,
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd.Add(-period),
+			wantEnd:   periodEnd,
+		},
+		{
+			name:      "Early renewal with a reported period",
+			current:   subscription("chirpy_red", subscriptionActive, periodEnd),
+			periodEnd: &reportedEnd,
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd,
+			wantEnd:   reportedEnd,
+		},
+		{
+			name:      "Upgrade while active keeps the later end",
+			current:   subscription("chirpy_red", subscriptionActive, periodEnd),
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd,
+			wantEnd:   periodEnd.Add(period),
+		},
+		{
+			name:      "Upgrade of a pre-subscription account with a reported period keeps the later end",
+			current:   subscription("chirpy_red", subscriptionActive, legacyEnd),
+			periodEnd: &reportedEnd,
+			wantPlan:  "chirpy_red",
+			wantStart: legacyEnd.Add(-period),
+			wantEnd:   legacyEnd,
+		},
+		{
+			name:      "Upgrade of a pre-subscription account keeps the period",
+			current:   subscription("chirpy_red", subscriptionActive, legacyEnd),
+			wantPlan:  "chirpy_red",
+			wantStart: legacyEnd.Add(-period),
+			wantEnd:   legacyEnd,
+		},
+		{
+			name:      "Downgrade takes effect from the end of the paid period",
+			current:   subscription("chirpy_red_plus", subscriptionActive, periodEnd),
+			plan:      "chirpy_red",
+			wantPlan:  "chirpy_red",
+			wantStart: periodEnd,
+			wantEnd:   periodEnd.Add(period),
+		},
+		{
+			name:      "Downgrade after a lapse starts from now",
+			current:   subscription("chirpy_red_plus", subscriptionActive, lapsedEnd),
+			plan:      "chirpy_red",
+			wantPlan:  "chirpy_red",
+			wantStart: now,
+			wantEnd:   now.Add(period),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextSubscriptionPeriod(tt.current, tt.plan, tt.periodEnd, now, period)
+			if got.Plan != tt.wantPlan {
+				t.Errorf("Expected plan %q, got %q", tt.wantPlan, got.Plan)
+			}
+			if !got.CurrentPeriodStart.Equal(tt.wantStart) {
+				t.Errorf("Expected period start %v, got %v", tt.wantStart, got.CurrentPeriodStart)
+			}
+			if !got.CurrentPeriodEnd.Equal(tt.wantEnd) {
+				t.Errorf("Expected period end %v, got %v", tt.wantEnd, got.CurrentPeriodEnd)
+			}
+		})
+	}
+}
+
+func TestProcessSubscriptionEventIgnoresUnknownKinds(t *testing.T) {
+	cfg := &ApiConfig{}
+
+	status, err := cfg.processSubscriptionEvent(context.Background(), billing.Event{Kind: billing.KindIgnored, Type: "customer.created"})
+	if err != errWebhookEventIgnored {
+		t.Errorf("Expected %v, got %v", errWebhookEventIgnored, err)
+	}
+	if status != http.StatusNoContent {
+		t.Errorf("Expected status %d, got %d", http.StatusNoContent, status)
+	}
+}
+
+func TestSubscriptionRoutesRequireProfileReadScope(t *testing.T) {
+	sqlDB := sql.OpenDB(&fakeDB{})
+	cfg := &ApiConfig{DB: sqlDB, Queries: database.New(sqlDB), AppLogs: newTestLogs(t)}
+
+	routes := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"Subscription", "/api/users/me/subscription", cfg.HandlerSubscriptionGet},
+		{"Entitlements", "/api/users/me/entitlements", cfg.HandlerEntitlementsGet},
+	}
+	tokens := []struct {
+		name          string
+		scopes        []string
+		wantForbidden bool
+	}{
+		{"Token without a profile scope", []string{auth.ScopeChirpsRead}, true},
+		{"Token that can only read the profile", []string{auth.ScopeProfileRead}, false},
+	}
+
+	for _, route := range routes {
+		for _, token := range tokens {
+			t.Run(route.name+"/"+token.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodGet, route.path, nil)
+				ctx := context.WithValue(req.Context(), ctxUserID, uuid.New())
+				ctx = context.WithValue(ctx, ctxTokenScopes, token.scopes)
+				w := httptest.NewRecorder()
+
+				route.handler(w, req.WithContext(ctx))
+				if forbidden := w.Code == http.StatusForbidden; forbidden != token.wantForbidden {
+					t.Errorf("Expected forbidden %v, got status %d: %s", token.wantForbidden, w.Code, w.Body.String())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestHandlerUserUpdateCredentials(t *testing.T) {
+	userID := uuid.New()
+	revocations := []string{"RevokeAllRefreshTokensForUser", "RevokeAllPersonalAccessTokensForUser", "RevokeAllOAuthRefreshTokensForUser"}
+
+	tests := []struct {
+		name        string
+		body        string
+		scopes      []string
+		wantStatus  int
+		wantWritten bool
+	}{
+		{"Password change from a login", `{"password":"new-password"}`, nil, http.StatusOK, true},
+		{"Password change with a personal access token", `{"password":"new-password"}`, []string{auth.ScopeProfileWrite}, http.StatusForbidden, false},
+		{"E-mail change with a personal access token", `{"email":"new@example.com"}`, []string{auth.ScopeProfileWrite}, http.StatusForbidden, false},
+		// The e-mail change request can't be saved, so the new password must not be either
+		{"Password and failed e-mail change", `{"password":"new-password","email":"new@example.com"}`, nil, http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{results: map[string]fakeRows{
+				"GetUserByID": {
+					columns: []string{"id", "email", "password_hash"},
+					rows:    [][]driver.Value{{userID.String(), "user@example.com", []byte("hash")}},
+				},
+			}}
+			sqlDB := sql.OpenDB(db)
+			cfg := &ApiConfig{
+				DB:             sqlDB,
+				Queries:        database.New(sqlDB),
+				AppLogs:        newTestLogs(t),
+				PasswordParams: &auth.PasswordParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+			}
+
+			ctx := context.WithValue(context.Background(), ctxUserID, userID)
+			if tt.scopes != nil {
+				ctx = context.WithValue(ctx, ctxTokenScopes, tt.scopes)
+			}
+			req := httptest.NewRequest(http.MethodPut, "/api/users", strings.NewReader(tt.body)).WithContext(ctx)
+			w := httptest.NewRecorder()
+			cfg.HandlerUserUpdate(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if got := db.hasRun("UpdatePasswordHash"); got != tt.wantWritten {
+				t.Errorf("Expected password written %v, got %v", tt.wantWritten, got)
+			}
+			for _, name := range revocations {
+				if got := db.hasRun(name); got != tt.wantWritten {
+					t.Errorf("Expected %s run %v, got %v", name, tt.wantWritten, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerChirpsGetByIDHidesBlocked(t *testing.T) {
+	chirpID := uuid.New()
+	authorID := uuid.New()
+	chirpRow := fakeRows{
+		columns: []string{"id", "user_id", "body", "created_at", "updated_at", "media_urls"},
+		rows:    [][]driver.Value{{chirpID.String(), authorID.String(), "Hello", time.Now(), time.Now(), "{}"}},
+	}
+
+	tests := []struct {
+		name       string
+		viewer     bool
+		results    map[string]fakeRows
+		wantStatus int
+	}{
+		{"Anonymous viewer", false, map[string]fakeRows{"GetChirpByID": chirpRow}, http.StatusOK},
+		{"Viewer without a block", true, map[string]fakeRows{"GetChirpByIDForViewer": chirpRow}, http.StatusOK},
+		// The query finds nothing when either user blocked the other
+		{"Viewer with a block", true, map[string]fakeRows{"GetChirpByID": chirpRow}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &ApiConfig{Queries: database.New(sql.OpenDB(&fakeDB{results: tt.results}))}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps/"+chirpID.String(), nil)
+			req.SetPathValue("chirpID", chirpID.String())
+			if tt.viewer {
+				req = req.WithContext(context.WithValue(req.Context(), ctxUserID, uuid.New()))
+			}
+			w := httptest.NewRecorder()
+			cfg.HandlerChirpsGetByID(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
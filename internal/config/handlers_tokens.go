@@ -0,0 +1,190 @@
+package config
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type PersonalAccessTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// PERSONAL ACCESS TOKENS
+
+// Create a new personal access token - the token itself is only returned in this response
+func (cfg *ApiConfig) HandlerPersonalAccessTokensCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var tokenReq CreatePersonalAccessTokenRequest
+		if err := json.Unmarshal(body, &tokenReq); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		// Validate the token name, scopes and expiration
+		if tokenReq.Name == "" {
+			cfg.respondWithError(w, http.StatusBadRequest, "Token name is required.")
+			return
+		}
+		if len(tokenReq.Scopes) == 0 {
+			cfg.respondWithError(w, http.StatusBadRequest, "At least one scope is required.")
+			return
+		}
+		for _, scope := range tokenReq.Scopes {
+			if !auth.ValidScope(scope) {
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown scope '%s'.", scope))
+				return
+			}
+		}
+		expiresAt := sql.NullTime{}
+		if tokenReq.ExpiresAt != nil {
+			if tokenReq.ExpiresAt.Before(time.Now()) {
+				cfg.respondWithError(w, http.StatusBadRequest, "Token expiration must be in the future.")
+				return
+			}
+			expiresAt = sql.NullTime{Time: tokenReq.ExpiresAt.UTC(), Valid: true}
+		}
+
+		token, err := auth.CreatePersonalAccessToken()
+		if err != nil {
+			output := func() {
+				log.Printf("An error ocurred while creating a new personal access token: %v", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while creating a new personal access token: %s", err))
+			return
+		}
+
+		newToken := database.CreatePersonalAccessTokenParams{
+			UserID:    userID,
+			Name:      tokenReq.Name,
+			TokenHash: auth.HashToken(token),
+			Scopes:    tokenReq.Scopes,
+			ExpiresAt: expiresAt,
+		}
+		createdToken, err := cfg.Queries.CreatePersonalAccessToken(r.Context(), newToken)
+		if err != nil {
+			output := func() {
+				log.Printf("Could not save personal access token for user %s: %s", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, "Could not save personal access token.")
+			return
+		}
+
+		response := PersonalAccessTokenResponse{
+			ID:        createdToken.ID,
+			Name:      createdToken.Name,
+			Scopes:    createdToken.Scopes,
+			Token:     token,
+			CreatedAt: createdToken.CreatedAt,
+			ExpiresAt: nullTimeToPtr(createdToken.ExpiresAt),
+		}
+		cfg.respondWithJSON(w, http.StatusCreated, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List a user's personal access tokens
+func (cfg *ApiConfig) HandlerPersonalAccessTokensGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		tokens, err := cfg.Queries.GetPersonalAccessTokensForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching personal access tokens for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching personal access tokens: '%s'", err))
+			return
+		}
+
+		response := make([]PersonalAccessTokenResponse, 0, len(tokens))
+		for _, token := range tokens {
+			response = append(response, PersonalAccessTokenResponse{
+				ID:         token.ID,
+				Name:       token.Name,
+				Scopes:     token.Scopes,
+				CreatedAt:  token.CreatedAt,
+				ExpiresAt:  nullTimeToPtr(token.ExpiresAt),
+				LastUsedAt: nullTimeToPtr(token.LastUsedAt),
+			})
+		}
+
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Revoke a personal access token
+func (cfg *ApiConfig) HandlerPersonalAccessTokensDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireUserSession(w, r) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get tokenID from the URL.")
+			return
+		}
+
+		params := database.RevokePersonalAccessTokenParams{
+			ID:     tokenID,
+			UserID: userID,
+		}
+		revoked, err := cfg.Queries.RevokePersonalAccessToken(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error ocurred while revoking personal access token %s: %v", tokenID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error ocurred while revoking the personal access token: %s", err))
+			return
+		}
+		if revoked == 0 {
+			cfg.respondWithError(w, http.StatusNotFound, "Personal access token not found.")
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
@@ -0,0 +1,444 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/events"
+	"github.com/vmilasin/chirpy/internal/webhook"
+)
+
+// Events sent to registered webhook endpoints
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserUpgraded = "user.upgraded"
+)
+
+var outgoingEventTypes = []string{eventChirpCreated, eventChirpDeleted, eventUserUpgraded}
+
+// Delivery statuses in the outbox
+const (
+	webhookDeliveryPending   = "pending"
+	webhookDeliveryDelivered = "delivered"
+	webhookDeliveryDead      = "dead"
+)
+
+const (
+	maxWebhookEndpointsPerUser = 10
+	webhookSecretPrefix        = "whsec_"
+
+	// Deliveries a dispatcher run takes on, and how long they're reserved for it
+	webhookDeliveryBatchSize = 25
+	webhookDeliveryLease     = 10 * time.Minute
+)
+
+type CreateWebhookEndpointRequest struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events"`
+	AllUsers bool     `json:"all_users"`
+}
+
+type WebhookEndpointResponse struct {
+	ID        uuid.UUID `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	AllUsers  bool      `json:"all_users"`
+	CreatedAt time.Time `json:"created_at"`
+	// Only returned when the endpoint is created
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDeliveryResponse struct {
+	ID             uuid.UUID       `json:"id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	LastStatusCode *int32          `json:"last_status_code"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+}
+
+// Body of every event sent to an endpoint
+type OutgoingEvent struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type UserUpgradedEventData struct {
+	UserID           uuid.UUID `json:"user_id"`
+	Plan             string    `json:"plan"`
+	CurrentPeriodEnd time.Time `json:"current_period_end"`
+}
+
+// WEBHOOK ENDPOINTS
+
+// Register an endpoint for signed events. Admins can register endpoints receiving events about every user.
+func (cfg *ApiConfig) HandlerWebhookEndpointsCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+		var request CreateWebhookEndpointRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+
+		if httpStatus, err := cfg.WebhookEndpointValidation(request); err != nil {
+			cfg.respondWithError(w, httpStatus, err.Error())
+			return
+		}
+		if request.AllUsers && r.Context().Value(ctxUserRole).(string) != auth.RoleAdmin {
+			cfg.respondWithError(w, http.StatusForbidden, "Only admins can receive events about all users.")
+			return
+		}
+
+		endpoints, err := cfg.Queries.GetWebhookEndpointsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching webhook endpoints of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching webhook endpoints: '%s'", err))
+			return
+		}
+		if len(endpoints) >= maxWebhookEndpointsPerUser {
+			cfg.respondWithError(w, http.StatusConflict, fmt.Sprintf("At most %d webhook endpoints can be registered.", maxWebhookEndpointsPerUser))
+			return
+		}
+
+		// The receiver needs the secret itself to check signatures, so it's stored as is
+		secret, err := auth.CreateRandomToken(32)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, "Failed to create a webhook secret.")
+			return
+		}
+
+		params := database.CreateWebhookEndpointParams{
+			UserID:     userID,
+			Url:        request.URL,
+			Secret:     webhookSecretPrefix + secret,
+			EventTypes: request.Events,
+			AllUsers:   request.AllUsers,
+		}
+		endpoint, err := cfg.Queries.CreateWebhookEndpoint(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while registering a webhook endpoint for user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to register the webhook endpoint: '%s'", err))
+			return
+		}
+
+		output := func() {
+			log.Printf("User %s registered webhook endpoint %s for %v (all users: %t).", userID, endpoint.ID, endpoint.EventTypes, endpoint.AllUsers)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		response := webhookEndpointResponse(endpoint)
+		response.Secret = endpoint.Secret
+		cfg.respondWithJSON(w, http.StatusCreated, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// List the requesting user's webhook endpoints
+func (cfg *ApiConfig) HandlerWebhookEndpointsGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+
+		endpoints, err := cfg.Queries.GetWebhookEndpointsForUser(r.Context(), userID)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching webhook endpoints of user %s: %s.", userID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching webhook endpoints: '%s'", err))
+			return
+		}
+
+		response := make([]WebhookEndpointResponse, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			response = append(response, webhookEndpointResponse(endpoint))
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Remove a webhook endpoint, along with its pending deliveries and delivery log
+func (cfg *ApiConfig) HandlerWebhookEndpointsDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get endpointID from the URL.")
+			return
+		}
+
+		params := database.DeleteWebhookEndpointParams{
+			ID:     endpointID,
+			UserID: userID,
+		}
+		deleted, err := cfg.Queries.DeleteWebhookEndpoint(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while deleting webhook endpoint %s: %s.", endpointID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete the webhook endpoint: '%s'", err))
+			return
+		}
+		if deleted == 0 {
+			cfg.respondWithError(w, http.StatusNotFound, "Webhook endpoint not found.")
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// WEBHOOK DELIVERIES
+
+// Delivery log of an endpoint, newest first, optionally filtered with ?status=
+func (cfg *ApiConfig) HandlerWebhookDeliveriesGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		endpoint, ok := cfg.webhookEndpointFromPath(w, r)
+		if !ok {
+			return
+		}
+
+		params := database.GetWebhookDeliveriesForEndpointParams{
+			EndpointID:    endpoint.ID,
+			MaxDeliveries: defaultWebhookEventPageSize,
+		}
+		if status := r.URL.Query().Get("status"); status != "" {
+			switch status {
+			case webhookDeliveryPending, webhookDeliveryDelivered, webhookDeliveryDead:
+				params.Status = sql.NullString{String: status, Valid: true}
+			default:
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown webhook delivery status '%s'.", status))
+				return
+			}
+		}
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			parsedLimit, err := strconv.Atoi(limit)
+			if err != nil || parsedLimit < 1 || parsedLimit > maxWebhookEventPageSize {
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit', expected a number between 1 and %d.", maxWebhookEventPageSize))
+				return
+			}
+			params.MaxDeliveries = int32(parsedLimit)
+		}
+
+		deliveries, err := cfg.Queries.GetWebhookDeliveriesForEndpoint(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching deliveries of webhook endpoint %s: %s.", endpoint.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching webhook deliveries: '%s'", err))
+			return
+		}
+
+		response := make([]WebhookDeliveryResponse, 0, len(deliveries))
+		for _, delivery := range deliveries {
+			response = append(response, webhookDeliveryResponse(delivery))
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Send a dead delivery again, with a fresh set of attempts
+func (cfg *ApiConfig) HandlerWebhookDeliveryRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		if !cfg.requireScope(w, r, auth.ScopeProfileWrite) {
+			return
+		}
+		endpoint, ok := cfg.webhookEndpointFromPath(w, r)
+		if !ok {
+			return
+		}
+		deliveryID, err := uuid.Parse(r.PathValue("deliveryID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get deliveryID from the URL.")
+			return
+		}
+
+		params := database.RetryDeadWebhookDeliveryParams{
+			ID:         deliveryID,
+			EndpointID: endpoint.ID,
+		}
+		delivery, err := cfg.Queries.RetryDeadWebhookDelivery(r.Context(), params)
+		if err == sql.ErrNoRows {
+			cfg.respondWithError(w, http.StatusNotFound, "No dead delivery with the provided ID.")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while retrying webhook delivery %s: %s.", deliveryID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to retry the webhook delivery: '%s'", err))
+			return
+		}
+
+		cfg.respondWithJSON(w, http.StatusAccepted, webhookDeliveryResponse(delivery))
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// WEBHOOK ENDPOINT HELPERS
+
+// Check the URL and event types of a new endpoint
+func (cfg *ApiConfig) WebhookEndpointValidation(request CreateWebhookEndpointRequest) (httpStatus int, err error) {
+	endpointURL, err := url.Parse(request.URL)
+	if err != nil || endpointURL.Host == "" || len(request.URL) > maxMediaURLLength {
+		return http.StatusBadRequest, fmt.Errorf("Invalid webhook URL '%s'.", request.URL)
+	}
+	// Plain http is only good enough for receivers on a dev machine
+	if endpointURL.Scheme != "https" && !(cfg.Platform == "dev" && endpointURL.Scheme == "http") {
+		return http.StatusBadRequest, fmt.Errorf("Webhook URL '%s' must use https.", request.URL)
+	}
+	// No requests to our own network - the delivery log would hand the responses back to the caller
+	if err := webhook.CheckHost(endpointURL.Hostname()); err != nil && cfg.Platform != "dev" {
+		return http.StatusBadRequest, fmt.Errorf("Webhook URL '%s' must point to a public address.", request.URL)
+	}
+
+	if len(request.Events) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("At least one event is required, available events: %v.", outgoingEventTypes)
+	}
+	for _, eventType := range request.Events {
+		if !slices.Contains(outgoingEventTypes, eventType) {
+			return http.StatusBadRequest, fmt.Errorf("Unknown event '%s', available events: %v.", eventType, outgoingEventTypes)
+		}
+	}
+	return 0, nil
+}
+
+// Load the webhook endpoint named in the URL - other users' endpoints are reported as not found
+func (cfg *ApiConfig) webhookEndpointFromPath(w http.ResponseWriter, r *http.Request) (database.WebhookEndpoint, bool) {
+	userID := r.Context().Value(ctxUserID).(uuid.UUID)
+	endpointID, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		cfg.respondWithError(w, http.StatusBadRequest, "Failed to get endpointID from the URL.")
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err := cfg.Queries.GetWebhookEndpointForUser(r.Context(), database.GetWebhookEndpointForUserParams{
+		ID:     endpointID,
+		UserID: userID,
+	})
+	if err == sql.ErrNoRows {
+		cfg.respondWithError(w, http.StatusNotFound, "Webhook endpoint not found.")
+		return database.WebhookEndpoint{}, false
+	}
+	if err != nil {
+		cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching the webhook endpoint: '%s'", err))
+		return database.WebhookEndpoint{}, false
+	}
+	return endpoint, true
+}
+
+// Domain event subscriber queueing the event for every endpoint subscribed to it. Endpoints get events about
+// the user named in the payload - running it again for a retried event doesn't queue duplicates.
+func (cfg *ApiConfig) queueWebhookDeliveries(ctx context.Context, event events.Event) error {
+	var subject struct {
+		UserID uuid.UUID `json:"user_id"`
+	}
+	if err := json.Unmarshal(event.Payload, &subject); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(OutgoingEvent{
+		ID:        event.ID,
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		Data:      event.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = cfg.Queries.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   event.ID,
+		EventType: event.Type,
+		Payload:   payload,
+		UserID:    subject.UserID,
+	})
+	return err
+}
+
+func webhookEndpointResponse(endpoint database.WebhookEndpoint) WebhookEndpointResponse {
+	return WebhookEndpointResponse{
+		ID:        endpoint.ID,
+		URL:       endpoint.Url,
+		Events:    endpoint.EventTypes,
+		AllUsers:  endpoint.AllUsers,
+		CreatedAt: endpoint.CreatedAt,
+	}
+}
+
+func webhookDeliveryResponse(delivery database.WebhookDelivery) WebhookDeliveryResponse {
+	response := WebhookDeliveryResponse{
+		ID:            delivery.ID,
+		EventID:       delivery.EventID,
+		EventType:     delivery.EventType,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		LastAttemptAt: nullTimeToPtr(delivery.LastAttemptAt),
+		LastError:     delivery.LastError.String,
+		CreatedAt:     delivery.CreatedAt,
+		DeliveredAt:   nullTimeToPtr(delivery.DeliveredAt),
+	}
+	if delivery.Status == webhookDeliveryPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.LastStatusCode.Valid {
+		response.LastStatusCode = &delivery.LastStatusCode.Int32
+	}
+	return response
+}
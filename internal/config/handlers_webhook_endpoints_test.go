@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWebhookEndpointsCreateRejectsPrivateAddresses(t *testing.T) {
+	cfg := &ApiConfig{}
+
+	for _, endpointURL := range []string{"https://127.0.0.1/", "https://localhost:8443/hooks", "https://169.254.169.254/latest/meta-data", "https://[::1]/", "https://10.1.2.3/"} {
+		body := `{"url":"` + endpointURL + `","events":["chirp.created"]}`
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), ctxUserID, uuid.New()))
+		w := httptest.NewRecorder()
+
+		// Rejected before the database is needed
+		cfg.HandlerWebhookEndpointsCreate(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Registering %s: expected status %d, got %d: %s", endpointURL, http.StatusBadRequest, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestWebhookEndpointValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		platform string
+		request  CreateWebhookEndpointRequest
+		wantOK   bool
+	}{
+		{name: "public https", request: CreateWebhookEndpointRequest{URL: "https://example.com/hooks", Events: []string{eventChirpCreated}}, wantOK: true},
+		{name: "plain http", request: CreateWebhookEndpointRequest{URL: "http://example.com/hooks", Events: []string{eventChirpCreated}}},
+		{name: "loopback", request: CreateWebhookEndpointRequest{URL: "https://127.0.0.1/", Events: []string{eventChirpCreated}}},
+		{name: "loopback on a dev machine", platform: "dev", request: CreateWebhookEndpointRequest{URL: "http://127.0.0.1:9000/", Events: []string{eventChirpCreated}}, wantOK: true},
+		{name: "unknown event", request: CreateWebhookEndpointRequest{URL: "https://example.com/hooks", Events: []string{"follow.created"}}},
+		{name: "no events", request: CreateWebhookEndpointRequest{URL: "https://example.com/hooks"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &ApiConfig{Platform: tc.platform}
+			httpStatus, err := cfg.WebhookEndpointValidation(tc.request)
+			if tc.wantOK && err != nil {
+				t.Errorf("Expected the endpoint to be accepted, got %d: %s", httpStatus, err)
+			}
+			if !tc.wantOK && httpStatus != http.StatusBadRequest {
+				t.Errorf("Expected status %d, got %d", http.StatusBadRequest, httpStatus)
+			}
+		})
+	}
+}
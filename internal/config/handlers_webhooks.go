@@ -0,0 +1,373 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/billing"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+const (
+	defaultWebhookEventPageSize = 50
+	maxWebhookEventPageSize     = 200
+)
+
+// Webhook event statuses in the ledger
+const (
+	webhookEventProcessing = "processing"
+	webhookEventProcessed  = "processed"
+	webhookEventIgnored    = "ignored"
+	webhookEventFailed     = "failed"
+)
+
+// How long an event can be processing before retries and replays may take it over - processing takes
+// seconds, so an older claim was interrupted by a crash or restart
+const webhookEventLease = 5 * time.Minute
+
+// Returned by event processors for event types we don't act on
+var errWebhookEventIgnored = errors.New("event type not handled")
+
+type WebhookEventResponse struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+}
+
+// WEBHOOKS
+
+// Subscription webhooks of a payment provider, authenticated by PaymentProviderMiddleware. Every delivery is
+// recorded in the event ledger first, so a retried delivery of an event we already processed is acknowledged
+// without running it again.
+func (cfg *ApiConfig) HandlerBillingWebhooks(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		provider := r.Context().Value(ctxPaymentProvider).(billing.Provider)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
+			return
+		}
+
+		billingEvent, err := provider.Parse(r.Header, body)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		event, proceed, err := cfg.recordWebhookEvent(r.Context(), provider.Name(), billingEvent.ID, billingEvent.Type, billingEvent.DuplicateWindow, body)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while recording %s webhook event '%s': %s.", provider.Name(), billingEvent.ID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while recording the webhook event: %s.", err))
+			return
+		}
+		if !proceed {
+			cfg.respondWithJSON(w, http.StatusNoContent, nil)
+			return
+		}
+
+		httpStatus, err := cfg.runWebhookEvent(r.Context(), event)
+		if err != nil {
+			cfg.respondWithError(w, httpStatus, err.Error())
+			return
+		}
+		cfg.respondWithJSON(w, http.StatusNoContent, nil)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// ADMIN
+
+// List recorded webhook events, newest first, optionally filtered with ?status=
+func (cfg *ApiConfig) HandlerAdminWebhookEventsGetAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		params := database.ListWebhookEventsParams{
+			MaxEvents: defaultWebhookEventPageSize,
+		}
+		if status := r.URL.Query().Get("status"); status != "" {
+			switch status {
+			case webhookEventProcessing, webhookEventProcessed, webhookEventIgnored, webhookEventFailed:
+				params.Status = sql.NullString{String: status, Valid: true}
+			default:
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown webhook event status '%s'.", status))
+				return
+			}
+		}
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			parsedLimit, err := strconv.Atoi(limit)
+			if err != nil || parsedLimit < 1 || parsedLimit > maxWebhookEventPageSize {
+				cfg.respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid 'limit', expected a number between 1 and %d.", maxWebhookEventPageSize))
+				return
+			}
+			params.MaxEvents = int32(parsedLimit)
+		}
+
+		events, err := cfg.Queries.ListWebhookEvents(r.Context(), params)
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while fetching webhook events: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching webhook events: '%s'", err))
+			return
+		}
+
+		response := make([]WebhookEventResponse, 0, len(events))
+		for _, event := range events {
+			response = append(response, webhookEventResponse(event))
+		}
+		cfg.respondWithJSON(w, http.StatusOK, response)
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// Process a failed webhook event again from its stored payload
+func (cfg *ApiConfig) HandlerAdminWebhookEventReplay(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		adminID := r.Context().Value(ctxUserID).(uuid.UUID)
+		eventID, err := uuid.Parse(r.PathValue("eventID"))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Failed to get eventID from the URL.")
+			return
+		}
+
+		event, err := cfg.Queries.ClaimWebhookEvent(r.Context(), database.ClaimWebhookEventParams{
+			ID:          eventID,
+			StaleBefore: time.Now().UTC().Add(-webhookEventLease),
+		})
+		if err == sql.ErrNoRows {
+			if _, err := cfg.Queries.GetWebhookEventByID(r.Context(), eventID); err == sql.ErrNoRows {
+				cfg.respondWithError(w, http.StatusNotFound, "Webhook event not found.")
+				return
+			}
+			cfg.respondWithError(w, http.StatusConflict, "Only failed webhook events, or ones stuck processing, can be replayed.")
+			return
+		}
+		if err != nil {
+			output := func() {
+				log.Printf("An error occured while claiming webhook event %s for replay: %s.", eventID, err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while replaying the webhook event: '%s'", err))
+			return
+		}
+
+		output := func() {
+			log.Printf("Admin %s replayed %s webhook event %s (attempt %d).", adminID, event.Provider, event.EventID, event.Attempts)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+
+		// The outcome is recorded on the event, which is returned either way
+		cfg.runWebhookEvent(r.Context(), event)
+
+		event, err = cfg.Queries.GetWebhookEventByID(r.Context(), eventID)
+		if err != nil {
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured while fetching the webhook event: '%s'", err))
+			return
+		}
+		cfg.respondWithJSON(w, http.StatusOK, webhookEventResponse(event))
+	} else {
+		cfg.respondWithError(w, http.StatusMethodNotAllowed, "Invalid request method.")
+	}
+}
+
+// WEBHOOK HELPERS
+
+// Record a delivery in the event ledger. proceed is false for duplicates of events that were already
+// processed, ignored or are being processed right now - failed events, and ones whose processing was
+// interrupted longer than a lease ago, are taken up again. With a duplicate window, an event ID only marks a
+// duplicate if the ledger received it within the window - an older event with the ID was a different event.
+func (cfg *ApiConfig) recordWebhookEvent(ctx context.Context, provider, eventID, eventType string, duplicateWindow time.Duration, payload []byte) (event database.WebhookEvent, proceed bool, err error) {
+	params := database.CreateWebhookEventParams{
+		Provider:  provider,
+		EventID:   eventID,
+		EventType: eventType,
+		Payload:   payload,
+	}
+	event, err = cfg.Queries.CreateWebhookEvent(ctx, params)
+	if err == sql.ErrNoRows && duplicateWindow > 0 {
+		var retired int64
+		retired, err = cfg.Queries.RetireWebhookEventID(ctx, database.RetireWebhookEventIDParams{
+			Provider:   provider,
+			EventID:    eventID,
+			ReceivedAt: time.Now().UTC().Add(-duplicateWindow),
+		})
+		if err != nil {
+			return database.WebhookEvent{}, false, err
+		}
+		err = sql.ErrNoRows
+		// Once freed, the ID can only be taken again by this delivery or a concurrent retry of it
+		if retired > 0 {
+			event, err = cfg.Queries.CreateWebhookEvent(ctx, params)
+		}
+	}
+	if err == nil {
+		return event, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return database.WebhookEvent{}, false, err
+	}
+
+	existing, err := cfg.Queries.GetWebhookEvent(ctx, database.GetWebhookEventParams{
+		Provider: provider,
+		EventID:  eventID,
+	})
+	if err != nil {
+		return database.WebhookEvent{}, false, err
+	}
+	skip := func() (database.WebhookEvent, bool, error) {
+		output := func() {
+			log.Printf("Skipped duplicate %s webhook event '%s' (%s).", provider, eventID, existing.Status)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+		return existing, false, nil
+	}
+	if existing.Status != webhookEventFailed && existing.Status != webhookEventProcessing {
+		return skip()
+	}
+
+	// A retry of an event that failed on our side, or whose processing was interrupted - claim it, unless it's
+	// being processed right now or a concurrent retry got there first
+	event, err = cfg.Queries.ClaimWebhookEvent(ctx, database.ClaimWebhookEventParams{
+		ID:          existing.ID,
+		StaleBefore: time.Now().UTC().Add(-webhookEventLease),
+	})
+	if err == sql.ErrNoRows {
+		return skip()
+	}
+	if err != nil {
+		return database.WebhookEvent{}, false, err
+	}
+	return event, true, nil
+}
+
+// Run a recorded event through its provider's processor and store the outcome on the event
+func (cfg *ApiConfig) runWebhookEvent(ctx context.Context, event database.WebhookEvent) (int, error) {
+	var httpStatus int
+	var err error
+	if provider, ok := cfg.PaymentProviders[event.Provider]; ok {
+		var billingEvent billing.Event
+		billingEvent, err = provider.Parse(nil, event.Payload)
+		if err == nil {
+			httpStatus, err = cfg.processSubscriptionEvent(ctx, billingEvent)
+		} else {
+			httpStatus = http.StatusBadRequest
+		}
+	} else {
+		httpStatus, err = http.StatusInternalServerError, fmt.Errorf("unknown webhook provider '%s'", event.Provider)
+	}
+
+	finish := database.FinishWebhookEventParams{
+		ID:     event.ID,
+		Status: webhookEventProcessed,
+	}
+	switch {
+	case err == errWebhookEventIgnored:
+		finish.Status = webhookEventIgnored
+		httpStatus, err = http.StatusNoContent, nil
+	case err != nil:
+		finish.Status = webhookEventFailed
+		finish.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+
+	// Record the outcome even if the provider hung up, or the event would be stuck as processing
+	if finishErr := cfg.Queries.FinishWebhookEvent(context.WithoutCancel(ctx), finish); finishErr != nil {
+		output := func() {
+			log.Printf("An error occured while recording the outcome of %s webhook event '%s': %s.", event.Provider, event.EventID, finishErr)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.HandlerLog, output)
+	}
+	return httpStatus, err
+}
+
+// Act on a subscription event of any payment provider - retried deliveries were already filtered out by the event ledger
+func (cfg *ApiConfig) processSubscriptionEvent(ctx context.Context, event billing.Event) (int, error) {
+	userID := event.UserID
+
+	var subscription database.Subscription
+	var err error
+	switch event.Kind {
+	case billing.KindActivated:
+		if _, err := cfg.Queries.GetUserByID(ctx, userID); err == sql.ErrNoRows {
+			return http.StatusNotFound, fmt.Errorf("User %v not found.", userID)
+		}
+		// The upgrade and its user.upgraded event are committed together
+		err = cfg.TransactionalQuery(ctx, func(tx *database.Queries) error {
+			var err error
+			subscription, err = cfg.activateSubscription(ctx, tx, userID, event.Plan, event.PeriodEnd)
+			if err != nil {
+				return err
+			}
+			return recordEvent(ctx, tx, aggregateUser, userID, eventUserUpgraded, UserUpgradedEventData{
+				UserID:           userID,
+				Plan:             subscription.Plan,
+				CurrentPeriodEnd: subscription.CurrentPeriodEnd,
+			})
+		})
+	case billing.KindRenewed:
+		if _, err := cfg.Queries.GetUserByID(ctx, userID); err == sql.ErrNoRows {
+			return http.StatusNotFound, fmt.Errorf("User %v not found.", userID)
+		}
+		subscription, err = cfg.renewSubscription(ctx, userID, event.Plan, event.PeriodEnd)
+	case billing.KindCancelled:
+		// Stays in effect until the end of the paid period
+		subscription, err = cfg.Queries.CancelSubscription(ctx, userID)
+	case billing.KindEnded:
+		// Ends immediately
+		subscription, err = cfg.Queries.ExpireSubscription(ctx, userID)
+	default:
+		return http.StatusNoContent, errWebhookEventIgnored
+	}
+	// Cancelling or ending a subscription that is already cancelled, expired or doesn't exist changes nothing
+	if err == sql.ErrNoRows {
+		return http.StatusNoContent, nil
+	}
+	if err != nil {
+		output := func() {
+			log.Printf("An error occured while handling '%s' for user %v: %s", event.Type, userID, err)
+		}
+		cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+		return http.StatusInternalServerError, fmt.Errorf("An error occured while updating the subscription of user %v: %s", userID, err)
+	}
+
+	output := func() {
+		log.Printf("Chirpy Red subscription of user %s is %s until %s after '%s'.", userID, subscription.Status, subscription.CurrentPeriodEnd.Format(time.RFC3339), event.Type)
+	}
+	cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+	return http.StatusNoContent, nil
+}
+
+func webhookEventResponse(event database.WebhookEvent) WebhookEventResponse {
+	return WebhookEventResponse{
+		ID:          event.ID,
+		Provider:    event.Provider,
+		EventID:     event.EventID,
+		EventType:   event.EventType,
+		Payload:     event.Payload,
+		Status:      event.Status,
+		Error:       event.Error.String,
+		Attempts:    event.Attempts,
+		ReceivedAt:  event.ReceivedAt,
+		ProcessedAt: nullTimeToPtr(event.ProcessedAt),
+	}
+}
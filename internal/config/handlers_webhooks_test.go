@@ -0,0 +1,69 @@
+package config
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestRecordWebhookEventDuplicateWindow(t *testing.T) {
+	const eventID = "sha256:f5ef0577550466543ea7e576dde65ed92c7b9c55b75d6769633921416a6bfa65"
+	payload := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+	eventRow := func(status string) fakeRows {
+		return fakeRows{
+			columns: []string{"id", "provider", "event_id", "event_type", "payload", "status", "error", "attempts", "received_at", "processed_at", "claimed_at"},
+			rows:    [][]driver.Value{{uuid.New().String(), "polka", eventID, "user.upgraded", payload, status, nil, int64(1), time.Now(), nil, time.Now()}},
+		}
+	}
+	conflict := fakeRows{err: sql.ErrNoRows}
+	retired := fakeRows{rows: [][]driver.Value{{}}}
+
+	tests := []struct {
+		name        string
+		window      time.Duration
+		creates     []fakeRows
+		retire      fakeRows
+		wantProceed bool
+		wantCreates int
+	}{
+		{"First delivery", time.Hour, []fakeRows{eventRow(webhookEventProcessing)}, fakeRows{}, true, 1},
+		// The ledger received the body within the window, whichever side of an hour the retry falls on
+		{"Retry within the window", time.Hour, []fakeRows{conflict}, fakeRows{}, false, 1},
+		{"Same body after the window", time.Hour, []fakeRows{conflict, eventRow(webhookEventProcessing)}, retired, true, 2},
+		// A concurrent retry of the later delivery took the freed ID
+		{"Same body after the window, recorded concurrently", time.Hour, []fakeRows{conflict, conflict}, retired, false, 2},
+		{"Retry of an event with a unique ID", 0, []fakeRows{conflict}, retired, false, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{
+				results: map[string]fakeRows{
+					"GetWebhookEvent":      eventRow(webhookEventProcessed),
+					"RetireWebhookEventID": tt.retire,
+				},
+				sequences: map[string][]fakeRows{"CreateWebhookEvent": tt.creates},
+			}
+			cfg := &ApiConfig{Queries: database.New(sql.OpenDB(db)), AppLogs: newTestLogs(t)}
+
+			_, proceed, err := cfg.recordWebhookEvent(context.Background(), "polka", eventID, "user.upgraded", tt.window, payload)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if proceed != tt.wantProceed {
+				t.Errorf("Expected proceed %v, got %v", tt.wantProceed, proceed)
+			}
+			if got := db.timesRun("CreateWebhookEvent"); got != tt.wantCreates {
+				t.Errorf("Expected %d inserts, got %d", tt.wantCreates, got)
+			}
+			if tt.window == 0 && db.hasRun("RetireWebhookEventID") {
+				t.Error("Expected the ID of an event without a window never to be retired")
+			}
+		})
+	}
+}
@@ -1,23 +1,33 @@
 package config
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/billing"
 )
 
 type contextKey string
 
 const (
 	ctxUserID                contextKey = "userID"
-	ctxRefreshToken          contextKey = "refreshToken"
+	ctxUserRole              contextKey = "userRole"
+	ctxTokenScopes           contextKey = "tokenScopes"
+	ctxRefreshTokenHash      contextKey = "refreshTokenHash"
+	ctxRefreshTokenID        contextKey = "refreshTokenID"
+	ctxRefreshTokenFamilyID  contextKey = "refreshTokenFamilyID"
 	ctxRefreshTokenRevokedAt contextKey = "refreshTokenRevokedAt"
+	ctxPaymentProvider       contextKey = "paymentProvider"
 )
 
 /* MIDDLEWARE: */
@@ -38,17 +48,104 @@ func (cfg *ApiConfig) AuthTokenMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := auth.AccessTokenAuth(tokenString, cfg.JWTSecret)
-		if err != nil {
-			cfg.resolveAuthTokenError(w, err)
+		ctx, fail := cfg.authenticateToken(r, tokenString)
+		if fail != nil {
+			fail(w)
 			return
 		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		ctx := context.WithValue(r.Context(), ctxUserID, userID)
+// Public routes whose response depends on who is asking - requests with a valid token are authenticated the same way
+// as in AuthTokenMiddleware, requests without one, or with one that doesn't check out, pass through anonymously
+func (cfg *ApiConfig) OptionalAuthTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenString := r.Header.Get("Authorization")
+		if tokenString == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, fail := cfg.authenticateToken(r, tokenString)
+		if fail != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// Validate an access token and return the request context carrying its user, role and scopes.
+// On failure it returns the function writing the error response instead.
+func (cfg *ApiConfig) authenticateToken(r *http.Request, tokenString string) (context.Context, func(http.ResponseWriter)) {
+	// Personal access tokens are opaque and looked up in the DB, everything else is a JWT
+	if bearer, err := auth.GetBearerToken(tokenString); err == nil && auth.IsPersonalAccessToken(bearer) {
+		userID, scopes, httpStatus, err := cfg.PersonalAccessTokenAuth(r.Context(), bearer)
+		if err != nil {
+			return nil, func(w http.ResponseWriter) {
+				cfg.respondWithError(w, httpStatus, err.Error())
+			}
+		}
+
+		// Personal access tokens never carry elevated roles
+		ctx := context.WithValue(r.Context(), ctxUserID, userID)
+		ctx = context.WithValue(ctx, ctxUserRole, auth.RoleUser)
+		ctx = context.WithValue(ctx, ctxTokenScopes, scopes)
+		return ctx, nil
+	}
+
+	claims, userID, err := auth.ParseAccessToken(tokenString, cfg.TokenConfig)
+	if err != nil {
+		return nil, func(w http.ResponseWriter) {
+			cfg.resolveAuthTokenError(w, err)
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), ctxUserID, userID)
+	ctx = context.WithValue(ctx, ctxUserRole, claims.UserRole())
+	// Tokens issued to third-party clients are limited to the scopes the user consented to
+	if scopes := claims.Scopes(); scopes != nil {
+		ctx = context.WithValue(ctx, ctxTokenScopes, scopes)
+	}
+	return ctx, nil
+}
+
+// Admin-only routes - the role claim is checked first, then confirmed against the DB so demotions apply immediately
+func (cfg *ApiConfig) AdminMiddleware(next http.Handler) http.Handler {
+	return cfg.AuthTokenMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value(ctxUserID).(uuid.UUID)
+		if role := r.Context().Value(ctxUserRole).(string); role != auth.RoleAdmin {
+			output := func() {
+				log.Printf("User %s with role '%s' denied access to %s %s.", userID, role, r.Method, r.URL.Path)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+			cfg.respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		role, err := cfg.Queries.GetUserRole(r.Context(), userID)
+		if err != nil && err != sql.ErrNoRows {
+			output := func() {
+				log.Printf("An error occured during user role lookup: %s.", err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.UserLog, output)
+			cfg.respondWithError(w, http.StatusInternalServerError, fmt.Sprintf("An error occured during user role lookup: %s.", err))
+			return
+		}
+		if role != auth.RoleAdmin {
+			output := func() {
+				log.Printf("User %s presented an admin token but is no longer an admin, denied access to %s %s.", userID, r.Method, r.URL.Path)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+			cfg.respondWithError(w, http.StatusForbidden, "Forbidden")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}))
+}
+
 func (cfg *ApiConfig) RefreshTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		tokenString := r.Header.Get("Authorization")
@@ -63,12 +160,15 @@ func (cfg *ApiConfig) RefreshTokenMiddleware(next http.Handler) http.Handler {
 			token = strings.TrimSpace(token)
 		} else {
 			cfg.respondWithError(w, http.StatusUnauthorized, "Invalid or missing Authorization header.")
+			return
 		}
 
-		returnedToken, err := cfg.Queries.CheckRefreshTokenValidity(r.Context(), token)
+		tokenHash := auth.HashToken(token)
+		returnedToken, err := cfg.Queries.CheckRefreshTokenValidity(r.Context(), tokenHash)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				cfg.respondWithError(w, http.StatusUnauthorized, "No refresh token found.")
+				return
 			} else {
 				output := func() {
 					log.Printf("An error occured during refresh token validation: %s.", err)
@@ -79,35 +179,61 @@ func (cfg *ApiConfig) RefreshTokenMiddleware(next http.Handler) http.Handler {
 			}
 		}
 
-		ctx := context.WithValue(r.Context(), ctxRefreshToken, token)
+		// A rotated token should never be presented again - if it is, it was most likely stolen
+		if returnedToken.RotatedAt.Valid {
+			cfg.revokeRefreshTokenFamily(r, returnedToken.FamilyID, returnedToken.UserID)
+			cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token was revoked.")
+			return
+		}
+
+		if time.Now().UTC().After(returnedToken.ExpiresAt) {
+			cfg.respondWithError(w, http.StatusUnauthorized, "The provided refresh token has expired.")
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ctxRefreshTokenHash, tokenHash)
+		ctx = context.WithValue(ctx, ctxRefreshTokenID, returnedToken.ID)
+		ctx = context.WithValue(ctx, ctxRefreshTokenFamilyID, returnedToken.FamilyID)
 		ctx = context.WithValue(ctx, ctxUserID, returnedToken.UserID)
 		ctx = context.WithValue(ctx, ctxRefreshTokenRevokedAt, returnedToken.RevokedAt)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (cfg *ApiConfig) PolkaMiddleware(next http.Handler) http.Handler {
+// Largest webhook body read for signature verification
+const maxWebhookBodySize = 1 << 20
+
+// Billing webhooks - the payment provider named in the URL authenticates the request. Signatures cover the
+// raw body, so it's read here and handed on to the handler untouched.
+func (cfg *ApiConfig) PaymentProviderMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		providedPolkaKey := r.Header.Get("Authorization")
-		if providedPolkaKey == "" {
-			cfg.respondWithError(w, http.StatusUnauthorized, "Invalid or missing Polka key.")
+		providerName := r.PathValue("provider")
+		if providerName == "" {
+			// The original /api/polka/webhooks route
+			providerName = billing.ProviderPolka
+		}
+		provider, ok := cfg.PaymentProviders[providerName]
+		if !ok {
+			cfg.respondWithError(w, http.StatusNotFound, "Unknown payment provider.")
 			return
 		}
 
-		var key string
-		if strings.HasPrefix(providedPolkaKey, "ApiKey ") {
-			key = strings.TrimPrefix(providedPolkaKey, "ApiKey ")
-			key = strings.TrimSpace(key)
-		} else {
-			cfg.respondWithError(w, http.StatusUnauthorized, "Invalid Polka key.")
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+		if err != nil {
+			cfg.respondWithError(w, http.StatusBadRequest, "Invalid request body.")
 			return
 		}
-
-		if key != cfg.PolkaKey {
-			cfg.respondWithError(w, http.StatusUnauthorized, "Invalid Polka key.")
+		if err := provider.Authenticate(r.Header, body); err != nil {
+			output := func() {
+				log.Printf("Rejected %s webhook from %s: %s.", providerName, clientIP(r), err)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+			cfg.respondWithError(w, http.StatusUnauthorized, "Invalid webhook signature or key.")
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		ctx := context.WithValue(r.Context(), ctxPaymentProvider, provider)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/database"
+)
+
+func TestOptionalAuthTokenMiddleware(t *testing.T) {
+	keys, err := auth.LoadKeySet("", "", []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("Expected key set to load, got %v", err)
+	}
+	otherKeys, err := auth.LoadKeySet("", "", []byte("another-secret"))
+	if err != nil {
+		t.Fatalf("Expected key set to load, got %v", err)
+	}
+	cfg := &ApiConfig{TokenConfig: auth.DefaultTokenConfig(keys)}
+
+	userID := uuid.New()
+	validToken, err := auth.CreateAccessToken(userID, auth.RoleUser, cfg.TokenConfig)
+	if err != nil {
+		t.Fatalf("Expected token to be created, got %v", err)
+	}
+	forgedToken, err := auth.CreateAccessToken(userID, auth.RoleUser, auth.DefaultTokenConfig(otherKeys))
+	if err != nil {
+		t.Fatalf("Expected token to be created, got %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		header        string
+		wantUser      bool
+		wantStrict401 bool
+	}{
+		{"No token", "", false, true},
+		{"Valid token", "Bearer " + validToken, true, false},
+		{"Token signed with another key", "Bearer " + forgedToken, false, true},
+		{"Malformed token", "Bearer not-a-token", false, true},
+		{"Not a bearer token", "Basic dXNlcjpwYXNz", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reached, gotUser bool
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				id, ok := r.Context().Value(ctxUserID).(uuid.UUID)
+				gotUser = ok && id == userID
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			cfg.OptionalAuthTokenMiddleware(next).ServeHTTP(w, req)
+
+			if !reached {
+				t.Fatalf("Expected the request to pass through, got status %d: %s", w.Code, w.Body.String())
+			}
+			if gotUser != tt.wantUser {
+				t.Errorf("Expected authenticated user %v, got %v", tt.wantUser, gotUser)
+			}
+
+			// The same token on a route that requires one
+			reached = false
+			w = httptest.NewRecorder()
+			cfg.AuthTokenMiddleware(next).ServeHTTP(w, req)
+			if tt.wantStrict401 && (reached || w.Code != http.StatusUnauthorized) {
+				t.Errorf("Expected status %d from the required middleware, got %d", http.StatusUnauthorized, w.Code)
+			}
+			if !tt.wantStrict401 && !reached {
+				t.Errorf("Expected the required middleware to let the request through, got status %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenMiddlewareReuse(t *testing.T) {
+	userID := uuid.New()
+	familyID := uuid.New()
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name       string
+		rotatedAt  driver.Value
+		expiresAt  time.Time
+		wantRevoke bool
+		wantStatus int
+	}{
+		// Rotated 3 days into a session - the cleanup job keeps it while the session is alive
+		{"Rotated token after the cleanup window", now.Add(-3 * 24 * time.Hour), now.Add(24 * time.Hour), true, http.StatusUnauthorized},
+		{"Rotated token that has expired", now.Add(-3 * 24 * time.Hour), now.Add(-time.Hour), true, http.StatusUnauthorized},
+		{"Current token of an old session", nil, now.Add(24 * time.Hour), false, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &fakeDB{results: map[string]fakeRows{
+				"CheckRefreshTokenValidity": {
+					columns: []string{"id", "revoked_at", "user_id", "expires_at", "family_id", "rotated_at", "user_agent"},
+					rows:    [][]driver.Value{{int64(1), tt.rotatedAt, userID.String(), tt.expiresAt, familyID.String(), tt.rotatedAt, "test"}},
+				},
+			}}
+			cfg := &ApiConfig{Queries: database.New(sql.OpenDB(db)), AppLogs: newTestLogs(t)}
+
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			req := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+			req.Header.Set("Authorization", "Bearer stolen-token")
+			w := httptest.NewRecorder()
+			cfg.RefreshTokenMiddleware(next).ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if got := db.hasRun("RevokeRefreshTokenFamily"); got != tt.wantRevoke {
+				t.Errorf("Expected family revocation %v, got %v", tt.wantRevoke, got)
+			}
+		})
+	}
+}
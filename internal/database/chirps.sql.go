@@ -10,21 +10,23 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (user_id, body)
-VALUES ($1, $2)
-RETURNING id, user_id, body, created_at, updated_at
+INSERT INTO chirps (user_id, body, media_urls)
+VALUES ($1, $2, $3)
+RETURNING id, user_id, body, created_at, updated_at, media_urls
 `
 
 type CreateChirpParams struct {
-	UserID uuid.UUID `json:"user_id"`
-	Body   string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	MediaUrls []string  `json:"media_urls"`
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.UserID, arg.Body, pq.Array(arg.MediaUrls))
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -32,6 +34,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.Body,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		pq.Array(&i.MediaUrls),
 	)
 	return i, err
 }
@@ -52,7 +55,8 @@ SELECT
     body AS "body", --json:"body"
     user_id AS "user_id", --json:"user_id"
     created_at AS "created_at", --json:"created_at"
-    updated_at AS "updated_at" --json:"updated_at"
+    updated_at AS "updated_at", --json:"updated_at"
+    media_urls AS "media_urls" --json:"media_urls"
 FROM chirps
 ORDER BY 
     CASE WHEN $1 THEN created_at END DESC,
@@ -65,6 +69,7 @@ type GetChirpAllRow struct {
 	UserID    uuid.UUID `json:"user_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	MediaUrls []string  `json:"media_urls"`
 }
 
 func (q *Queries) GetChirpAll(ctx context.Context, dollar_1 interface{}) ([]GetChirpAllRow, error) {
@@ -82,6 +87,76 @@ func (q *Queries) GetChirpAll(ctx context.Context, dollar_1 interface{}) ([]GetC
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			pq.Array(&i.MediaUrls),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpAllForViewer = `-- name: GetChirpAllForViewer :many
+SELECT
+    c.id AS "id", --json:"id"
+    c.body AS "body", --json:"body"
+    c.user_id AS "user_id", --json:"user_id"
+    c.created_at AS "created_at", --json:"created_at"
+    c.updated_at AS "updated_at", --json:"updated_at"
+    c.media_urls AS "media_urls" --json:"media_urls"
+FROM chirps c
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = $1 AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = $1)
+    )
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_mutes m
+        WHERE m.muter_id = $1 AND m.muted_id = c.user_id
+    )
+ORDER BY
+    CASE WHEN $2::BOOLEAN THEN c.created_at END DESC,
+    CASE WHEN NOT $2::BOOLEAN THEN c.created_at END ASC
+`
+
+type GetChirpAllForViewerParams struct {
+	ViewerID uuid.UUID `json:"viewer_id"`
+	SortDesc bool      `json:"sort_desc"`
+}
+
+type GetChirpAllForViewerRow struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	MediaUrls []string  `json:"media_urls"`
+}
+
+func (q *Queries) GetChirpAllForViewer(ctx context.Context, arg GetChirpAllForViewerParams) ([]GetChirpAllForViewerRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAllForViewer, arg.ViewerID, arg.SortDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpAllForViewerRow
+	for rows.Next() {
+		var i GetChirpAllForViewerRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			pq.Array(&i.MediaUrls),
 		); err != nil {
 			return nil, err
 		}
@@ -97,7 +172,7 @@ func (q *Queries) GetChirpAll(ctx context.Context, dollar_1 interface{}) ([]GetC
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, user_id, body, created_at, updated_at
+SELECT id, user_id, body, created_at, updated_at, media_urls
 FROM chirps
 WHERE id = $1
 `
@@ -111,17 +186,77 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.Body,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		pq.Array(&i.MediaUrls),
+	)
+	return i, err
+}
+
+const getChirpByIDForViewer = `-- name: GetChirpByIDForViewer :one
+SELECT c.id, c.user_id, c.body, c.created_at, c.updated_at, c.media_urls
+FROM chirps c
+WHERE c.id = $1
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = $2 AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = $2)
+    )
+`
+
+type GetChirpByIDForViewerParams struct {
+	ID       uuid.UUID `json:"id"`
+	ViewerID uuid.UUID `json:"viewer_id"`
+}
+
+// A chirp is hidden from a signed-in viewer if either of them blocked the other
+func (q *Queries) GetChirpByIDForViewer(ctx context.Context, arg GetChirpByIDForViewerParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDForViewer, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		pq.Array(&i.MediaUrls),
 	)
 	return i, err
 }
 
+const getChirpRateWindow = `-- name: GetChirpRateWindow :one
+SELECT
+    COUNT(*) AS chirp_count,
+    COALESCE(MIN(created_at), NOW())::TIMESTAMP AS oldest_created_at
+FROM chirps
+WHERE user_id = $1 AND created_at > $2
+`
+
+type GetChirpRateWindowParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GetChirpRateWindowRow struct {
+	ChirpCount      int64     `json:"chirp_count"`
+	OldestCreatedAt time.Time `json:"oldest_created_at"`
+}
+
+// How many chirps a user posted since a point in time, and when the oldest of them was posted
+func (q *Queries) GetChirpRateWindow(ctx context.Context, arg GetChirpRateWindowParams) (GetChirpRateWindowRow, error) {
+	row := q.db.QueryRowContext(ctx, getChirpRateWindow, arg.UserID, arg.CreatedAt)
+	var i GetChirpRateWindowRow
+	err := row.Scan(&i.ChirpCount, &i.OldestCreatedAt)
+	return i, err
+}
+
 const getChirpsFromAuthor = `-- name: GetChirpsFromAuthor :many
 SELECT
     id AS "id", --json:"id"
     body AS "body", --json:"body"
     user_id AS "user_id", --json:"user_id"
     created_at AS "created_at", --json:"created_at"
-    updated_at AS "updated_at" --json:"updated_at"
+    updated_at AS "updated_at", --json:"updated_at"
+    media_urls AS "media_urls" --json:"media_urls"
 FROM chirps
 WHERE user_id = $1
 ORDER BY 
@@ -140,6 +275,7 @@ type GetChirpsFromAuthorRow struct {
 	UserID    uuid.UUID `json:"user_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	MediaUrls []string  `json:"media_urls"`
 }
 
 func (q *Queries) GetChirpsFromAuthor(ctx context.Context, arg GetChirpsFromAuthorParams) ([]GetChirpsFromAuthorRow, error) {
@@ -157,6 +293,7 @@ func (q *Queries) GetChirpsFromAuthor(ctx context.Context, arg GetChirpsFromAuth
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			pq.Array(&i.MediaUrls),
 		); err != nil {
 			return nil, err
 		}
@@ -170,3 +307,102 @@ func (q *Queries) GetChirpsFromAuthor(ctx context.Context, arg GetChirpsFromAuth
 	}
 	return items, nil
 }
+
+const getChirpsFromAuthorForViewer = `-- name: GetChirpsFromAuthorForViewer :many
+SELECT
+    c.id AS "id", --json:"id"
+    c.body AS "body", --json:"body"
+    c.user_id AS "user_id", --json:"user_id"
+    c.created_at AS "created_at", --json:"created_at"
+    c.updated_at AS "updated_at", --json:"updated_at"
+    c.media_urls AS "media_urls" --json:"media_urls"
+FROM chirps c
+WHERE c.user_id = $1
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = $2 AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = $2)
+    )
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_mutes m
+        WHERE m.muter_id = $2 AND m.muted_id = c.user_id
+    )
+ORDER BY
+    CASE WHEN $3::BOOLEAN THEN c.created_at END DESC,
+    CASE WHEN NOT $3::BOOLEAN THEN c.created_at END ASC
+`
+
+type GetChirpsFromAuthorForViewerParams struct {
+	AuthorID uuid.UUID `json:"author_id"`
+	ViewerID uuid.UUID `json:"viewer_id"`
+	SortDesc bool      `json:"sort_desc"`
+}
+
+type GetChirpsFromAuthorForViewerRow struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	MediaUrls []string  `json:"media_urls"`
+}
+
+func (q *Queries) GetChirpsFromAuthorForViewer(ctx context.Context, arg GetChirpsFromAuthorForViewerParams) ([]GetChirpsFromAuthorForViewerRow, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsFromAuthorForViewer, arg.AuthorID, arg.ViewerID, arg.SortDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetChirpsFromAuthorForViewerRow
+	for rows.Next() {
+		var i GetChirpsFromAuthorForViewerRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			pq.Array(&i.MediaUrls),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET
+    body = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING id, user_id, body, created_at, updated_at, media_urls
+`
+
+type UpdateChirpBodyParams struct {
+	Body string    `json:"body"`
+	ID   uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		pq.Array(&i.MediaUrls),
+	)
+	return i, err
+}
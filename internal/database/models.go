@@ -6,6 +6,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,23 +18,203 @@ type Chirp struct {
 	Body      string    `json:"body"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	MediaUrls []string  `json:"media_urls"`
+}
+
+type Conversation struct {
+	ID            uuid.UUID    `json:"id"`
+	UserA         uuid.UUID    `json:"user_a"`
+	UserB         uuid.UUID    `json:"user_b"`
+	CreatedAt     time.Time    `json:"created_at"`
+	LastMessageAt sql.NullTime `json:"last_message_at"`
+}
+
+type DataExport struct {
+	ID                uuid.UUID      `json:"id"`
+	UserID            uuid.UUID      `json:"user_id"`
+	Status            string         `json:"status"`
+	DownloadTokenHash string         `json:"download_token_hash"`
+	FilePath          sql.NullString `json:"file_path"`
+	CreatedAt         time.Time      `json:"created_at"`
+	CompletedAt       sql.NullTime   `json:"completed_at"`
+	ExpiresAt         time.Time      `json:"expires_at"`
+}
+
+type DomainEvent struct {
+	ID            uuid.UUID       `json:"id"`
+	Sequence      int64           `json:"sequence"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   uuid.UUID       `json:"aggregate_id"`
+	EventType     string          `json:"event_type"`
+	Payload       json.RawMessage `json:"payload"`
+	Attempts      int32           `json:"attempts"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	LastError     sql.NullString  `json:"last_error"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DispatchedAt  sql.NullTime    `json:"dispatched_at"`
+	DeadAt        sql.NullTime    `json:"dead_at"`
+}
+
+type EmailChangeRequest struct {
+	ID          uuid.UUID    `json:"id"`
+	UserID      uuid.UUID    `json:"user_id"`
+	NewEmail    string       `json:"new_email"`
+	TokenHash   string       `json:"token_hash"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	ConfirmedAt sql.NullTime `json:"confirmed_at"`
+}
+
+type Message struct {
+	ID             uuid.UUID    `json:"id"`
+	ConversationID uuid.UUID    `json:"conversation_id"`
+	SenderID       uuid.UUID    `json:"sender_id"`
+	Body           string       `json:"body"`
+	CreatedAt      time.Time    `json:"created_at"`
+	ReadAt         sql.NullTime `json:"read_at"`
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string       `json:"code_hash"`
+	ClientID            string       `json:"client_id"`
+	UserID              uuid.UUID    `json:"user_id"`
+	RedirectUri         string       `json:"redirect_uri"`
+	Scopes              []string     `json:"scopes"`
+	CodeChallenge       string       `json:"code_challenge"`
+	CodeChallengeMethod string       `json:"code_challenge_method"`
+	CreatedAt           time.Time    `json:"created_at"`
+	ExpiresAt           time.Time    `json:"expires_at"`
+	UsedAt              sql.NullTime `json:"used_at"`
+}
+
+type OauthClient struct {
+	ID           string         `json:"id"`
+	SecretHash   sql.NullString `json:"secret_hash"`
+	Name         string         `json:"name"`
+	RedirectUris []string       `json:"redirect_uris"`
+	OwnerID      uuid.UUID      `json:"owner_id"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+type OauthRefreshToken struct {
+	ID        int32        `json:"id"`
+	TokenHash string       `json:"token_hash"`
+	ClientID  string       `json:"client_id"`
+	UserID    uuid.UUID    `json:"user_id"`
+	Scopes    []string     `json:"scopes"`
+	CreatedAt time.Time    `json:"created_at"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	RevokedAt sql.NullTime `json:"revoked_at"`
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID    `json:"id"`
+	UserID     uuid.UUID    `json:"user_id"`
+	Name       string       `json:"name"`
+	TokenHash  string       `json:"token_hash"`
+	Scopes     []string     `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ExpiresAt  sql.NullTime `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
 }
 
 type RefreshToken struct {
-	ID           int32        `json:"id"`
-	UserID       uuid.UUID    `json:"user_id"`
-	RefreshToken string       `json:"refresh_token"`
-	CreatedAt    sql.NullTime `json:"created_at"`
-	ExpiresAt    time.Time    `json:"expires_at"`
-	RevokedAt    sql.NullTime `json:"revoked_at"`
-	UpdatedAt    time.Time    `json:"updated_at"`
+	ID         int32         `json:"id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	TokenHash  string        `json:"token_hash"`
+	CreatedAt  sql.NullTime  `json:"created_at"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	RevokedAt  sql.NullTime  `json:"revoked_at"`
+	UpdatedAt  time.Time     `json:"updated_at"`
+	UserAgent  string        `json:"user_agent"`
+	IpAddress  string        `json:"ip_address"`
+	LastUsedAt sql.NullTime  `json:"last_used_at"`
+	FamilyID   uuid.UUID     `json:"family_id"`
+	ParentID   sql.NullInt32 `json:"parent_id"`
+	RotatedAt  sql.NullTime  `json:"rotated_at"`
+}
+
+type ScheduledChirp struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Body      string    `json:"body"`
+	MediaUrls []string  `json:"media_urls"`
+	PublishAt time.Time `json:"publish_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Subscription struct {
+	ID                 uuid.UUID    `json:"id"`
+	UserID             uuid.UUID    `json:"user_id"`
+	Plan               string       `json:"plan"`
+	Status             string       `json:"status"`
+	CurrentPeriodStart time.Time    `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time    `json:"current_period_end"`
+	CancelledAt        sql.NullTime `json:"cancelled_at"`
+	CreatedAt          time.Time    `json:"created_at"`
+	UpdatedAt          time.Time    `json:"updated_at"`
 }
 
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	PasswordHash []byte    `json:"password_hash"`
-	IsChirpyRed  bool      `json:"is_chirpy_red"`
+	ID                  uuid.UUID    `json:"id"`
+	CreatedAt           time.Time    `json:"created_at"`
+	UpdatedAt           time.Time    `json:"updated_at"`
+	Email               string       `json:"email"`
+	PasswordHash        []byte       `json:"password_hash"`
+	Role                string       `json:"role"`
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+	ProfanityFilter     bool         `json:"profanity_filter"`
+}
+
+type UserBlock struct {
+	BlockerID uuid.UUID `json:"blocker_id"`
+	BlockedID uuid.UUID `json:"blocked_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserMute struct {
+	MuterID   uuid.UUID `json:"muter_id"`
+	MutedID   uuid.UUID `json:"muted_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID       `json:"id"`
+	EndpointID     uuid.UUID       `json:"endpoint_id"`
+	EventID        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastAttemptAt  sql.NullTime    `json:"last_attempt_at"`
+	LastStatusCode sql.NullInt32   `json:"last_status_code"`
+	LastError      sql.NullString  `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    sql.NullTime    `json:"delivered_at"`
+}
+
+type WebhookEndpoint struct {
+	ID         uuid.UUID `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	Url        string    `json:"url"`
+	Secret     string    `json:"secret"`
+	EventTypes []string  `json:"event_types"`
+	AllUsers   bool      `json:"all_users"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Error       sql.NullString  `json:"error"`
+	Attempts    int32           `json:"attempts"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt sql.NullTime    `json:"processed_at"`
+	ClaimedAt   time.Time       `json:"claimed_at"`
 }
@@ -14,44 +14,133 @@ import (
 )
 
 const checkRefreshTokenValidity = `-- name: CheckRefreshTokenValidity :one
-SELECT revoked_at, user_id
+SELECT id, revoked_at, user_id, expires_at, family_id, rotated_at, user_agent
 FROM refresh_tokens
-where refresh_token =$1
+where token_hash =$1
 `
 
 type CheckRefreshTokenValidityRow struct {
+	ID        int32        `json:"id"`
 	RevokedAt sql.NullTime `json:"revoked_at"`
 	UserID    uuid.UUID    `json:"user_id"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	FamilyID  uuid.UUID    `json:"family_id"`
+	RotatedAt sql.NullTime `json:"rotated_at"`
+	UserAgent string       `json:"user_agent"`
 }
 
-func (q *Queries) CheckRefreshTokenValidity(ctx context.Context, refreshToken string) (CheckRefreshTokenValidityRow, error) {
-	row := q.db.QueryRowContext(ctx, checkRefreshTokenValidity, refreshToken)
+func (q *Queries) CheckRefreshTokenValidity(ctx context.Context, tokenHash string) (CheckRefreshTokenValidityRow, error) {
+	row := q.db.QueryRowContext(ctx, checkRefreshTokenValidity, tokenHash)
 	var i CheckRefreshTokenValidityRow
-	err := row.Scan(&i.RevokedAt, &i.UserID)
+	err := row.Scan(
+		&i.ID,
+		&i.RevokedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.FamilyID,
+		&i.RotatedAt,
+		&i.UserAgent,
+	)
 	return i, err
 }
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (user_id, refresh_token, expires_at)
-VALUES ($1, $2, $3)
-RETURNING refresh_token
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip_address, family_id, parent_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id
 `
 
 type CreateRefreshTokenParams struct {
-	UserID       uuid.UUID `json:"user_id"`
-	RefreshToken string    `json:"refresh_token"`
-	ExpiresAt    time.Time `json:"expires_at"`
+	UserID    uuid.UUID     `json:"user_id"`
+	TokenHash string        `json:"token_hash"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	UserAgent string        `json:"user_agent"`
+	IpAddress string        `json:"ip_address"`
+	FamilyID  uuid.UUID     `json:"family_id"`
+	ParentID  sql.NullInt32 `json:"parent_id"`
+}
+
+func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.UserID,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.FamilyID,
+		arg.ParentID,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createRotatedRefreshToken = `-- name: CreateRotatedRefreshToken :one
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip_address, family_id, parent_id, created_at, last_used_at)
+SELECT user_id, $1, $2, $3, $4, family_id, id, created_at, CURRENT_TIMESTAMP
+FROM refresh_tokens
+WHERE id = $5
+RETURNING id
+`
+
+type CreateRotatedRefreshTokenParams struct {
+	TokenHash string    `json:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IpAddress string    `json:"ip_address"`
+	ParentID  int32     `json:"parent_id"`
 }
 
-func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (string, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.UserID, arg.RefreshToken, arg.ExpiresAt)
-	var refresh_token string
-	err := row.Scan(&refresh_token)
-	return refresh_token, err
+// The successor of a rotated token continues its session - it keeps the family and the sign-in time, and was just used
+func (q *Queries) CreateRotatedRefreshToken(ctx context.Context, arg CreateRotatedRefreshTokenParams) (int32, error) {
+	row := q.db.QueryRowContext(ctx, createRotatedRefreshToken,
+		arg.TokenHash,
+		arg.ExpiresAt,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ParentID,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getOtherActiveRefreshTokens = `-- name: GetOtherActiveRefreshTokens :many
+SELECT token_hash
+FROM refresh_tokens
+WHERE user_id = $1 AND token_hash <> $2 AND revoked_at IS NULL
+`
+
+type GetOtherActiveRefreshTokensParams struct {
+	UserID    uuid.UUID `json:"user_id"`
+	TokenHash string    `json:"token_hash"`
+}
+
+func (q *Queries) GetOtherActiveRefreshTokens(ctx context.Context, arg GetOtherActiveRefreshTokensParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getOtherActiveRefreshTokens, arg.UserID, arg.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var token_hash string
+		if err := rows.Scan(&token_hash); err != nil {
+			return nil, err
+		}
+		items = append(items, token_hash)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getRefreshTokenForUser = `-- name: GetRefreshTokenForUser :one
-SELECT id, user_id, refresh_token, created_at, expires_at, revoked_at, updated_at
+SELECT id, user_id, token_hash, created_at, expires_at, revoked_at, updated_at, user_agent, ip_address, last_used_at, family_id, parent_id, rotated_at
 FROM refresh_tokens
 WHERE user_id = $1 and revoked_at IS NULL
 `
@@ -62,23 +151,137 @@ func (q *Queries) GetRefreshTokenForUser(ctx context.Context, userID uuid.UUID)
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
-		&i.RefreshToken,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.ExpiresAt,
 		&i.RevokedAt,
 		&i.UpdatedAt,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.FamilyID,
+		&i.ParentID,
+		&i.RotatedAt,
 	)
 	return i, err
 }
 
+const getSessionForUser = `-- name: GetSessionForUser :one
+SELECT revoked_at
+FROM refresh_tokens
+WHERE family_id = $1 AND user_id = $2
+ORDER BY id DESC
+LIMIT 1
+`
+
+type GetSessionForUserParams struct {
+	FamilyID uuid.UUID `json:"family_id"`
+	UserID   uuid.UUID `json:"user_id"`
+}
+
+// A session is a refresh token family - its newest token tells whether the session is still active
+func (q *Queries) GetSessionForUser(ctx context.Context, arg GetSessionForUserParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, getSessionForUser, arg.FamilyID, arg.UserID)
+	var revoked_at sql.NullTime
+	err := row.Scan(&revoked_at)
+	return revoked_at, err
+}
+
+const getSessionsForUser = `-- name: GetSessionsForUser :many
+SELECT family_id, user_agent, ip_address, created_at, last_used_at, expires_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY COALESCE(last_used_at, created_at) DESC
+`
+
+type GetSessionsForUserRow struct {
+	FamilyID   uuid.UUID    `json:"family_id"`
+	UserAgent  string       `json:"user_agent"`
+	IpAddress  string       `json:"ip_address"`
+	CreatedAt  sql.NullTime `json:"created_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+}
+
+func (q *Queries) GetSessionsForUser(ctx context.Context, userID uuid.UUID) ([]GetSessionsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessionsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionsForUserRow
+	for rows.Next() {
+		var i GetSessionsForUserRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllRefreshTokensForUser = `-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE user_id = $1
+`
+
+func (q *Queries) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeAllRefreshTokensForUser, userID)
+	return err
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET
     revoked_at = CURRENT_TIMESTAMP
-WHERE refresh_token =$1
+WHERE token_hash =$1
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE family_id = $1
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
-	_, err := q.db.ExecContext(ctx, revokeRefreshToken, refreshToken)
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
 	return err
 }
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET
+    rotated_at = CURRENT_TIMESTAMP,
+    revoked_at = CURRENT_TIMESTAMP,
+    last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+`
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, id int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rotateRefreshToken, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
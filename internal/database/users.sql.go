@@ -7,28 +7,48 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :execrows
+UPDATE users
+SET
+    deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const checkChirpyRed = `-- name: CheckChirpyRed :one
-SELECT is_chirpy_red
-FROM users
-WHERE id = $1
+SELECT EXISTS (
+    SELECT 1
+    FROM subscriptions
+    WHERE user_id = $1
+        AND status IN ('active', 'cancelled')
+        AND current_period_end > NOW()
+)
 `
 
-func (q *Queries) CheckChirpyRed(ctx context.Context, id uuid.UUID) (bool, error) {
-	row := q.db.QueryRowContext(ctx, checkChirpyRed, id)
-	var is_chirpy_red bool
-	err := row.Scan(&is_chirpy_red)
-	return is_chirpy_red, err
+func (q *Queries) CheckChirpyRed(ctx context.Context, userID uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, checkChirpyRed, userID)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
 }
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, password_hash)
 VALUES ($1, $2)
-RETURNING id, email, created_at, updated_at, is_chirpy_red
+RETURNING id, email, created_at, updated_at
 `
 
 type CreateUserParams struct {
@@ -37,11 +57,10 @@ type CreateUserParams struct {
 }
 
 type CreateUserRow struct {
-	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID        uuid.UUID `json:"id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
@@ -52,23 +71,37 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 		&i.Email,
 		&i.CreatedAt,
 		&i.UpdatedAt,
-		&i.IsChirpyRed,
 	)
 	return i, err
 }
 
-const enableChirpyRed = `-- name: EnableChirpyRed :one
-UPDATE users
-SET
-    is_chirpy_red = TRUE
-WHERE id = $1
+const deleteUsersScheduledForDeletion = `-- name: DeleteUsersScheduledForDeletion :many
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1
 RETURNING id
 `
 
-func (q *Queries) EnableChirpyRed(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
-	row := q.db.QueryRowContext(ctx, enableChirpyRed, id)
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) DeleteUsersScheduledForDeletion(ctx context.Context, deletionScheduledAt sql.NullTime) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, deleteUsersScheduledForDeletion, deletionScheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getPWHash = `-- name: GetPWHash :one
@@ -116,29 +149,119 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (GetUserByIDRow
 	return i, err
 }
 
-const updateUser = `-- name: UpdateUser :one
+const getUserProfanityFilter = `-- name: GetUserProfanityFilter :one
+SELECT profanity_filter
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserProfanityFilter(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfanityFilter, id)
+	var profanity_filter bool
+	err := row.Scan(&profanity_filter)
+	return profanity_filter, err
+}
+
+const getUserRole = `-- name: GetUserRole :one
+SELECT role
+FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRowContext(ctx, getUserRole, id)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
 UPDATE users
 SET
-    email = COALESCE(NULLIF($1, ''), email),  -- If email is provided, update it, otherwise keep the existing value
-    password_hash = COALESCE($2::BYTEA, password_hash)  -- If password is provided, update it, otherwise keep the existing value
-WHERE id = $3
-RETURNING id, email
+    deletion_scheduled_at = $1
+WHERE id = $2
+RETURNING deletion_scheduled_at
 `
 
-type UpdateUserParams struct {
-	Column1 interface{} `json:"column_1"`
-	Column2 []byte      `json:"column_2"`
-	ID      uuid.UUID   `json:"id"`
+type ScheduleUserDeletionParams struct {
+	DeletionScheduledAt sql.NullTime `json:"deletion_scheduled_at"`
+	ID                  uuid.UUID    `json:"id"`
 }
 
-type UpdateUserRow struct {
-	ID    uuid.UUID `json:"id"`
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (sql.NullTime, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.DeletionScheduledAt, arg.ID)
+	var deletion_scheduled_at sql.NullTime
+	err := row.Scan(&deletion_scheduled_at)
+	return deletion_scheduled_at, err
+}
+
+const setUserRoleByEmail = `-- name: SetUserRoleByEmail :one
+UPDATE users
+SET
+    role = $1
+WHERE email = $2
+RETURNING id
+`
+
+type SetUserRoleByEmailParams struct {
+	Role  string `json:"role"`
+	Email string `json:"email"`
+}
+
+func (q *Queries) SetUserRoleByEmail(ctx context.Context, arg SetUserRoleByEmailParams) (uuid.UUID, error) {
+	row := q.db.QueryRowContext(ctx, setUserRoleByEmail, arg.Role, arg.Email)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const updatePasswordHash = `-- name: UpdatePasswordHash :exec
+UPDATE users
+SET
+    password_hash = $1
+WHERE id = $2
+`
+
+type UpdatePasswordHashParams struct {
+	PasswordHash []byte    `json:"password_hash"`
+	ID           uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdatePasswordHash(ctx context.Context, arg UpdatePasswordHashParams) error {
+	_, err := q.db.ExecContext(ctx, updatePasswordHash, arg.PasswordHash, arg.ID)
+	return err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :exec
+UPDATE users
+SET
+    email = $1
+WHERE id = $2
+`
+
+type UpdateUserEmailParams struct {
 	Email string    `json:"email"`
+	ID    uuid.UUID `json:"id"`
 }
 
-func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.Column1, arg.Column2, arg.ID)
-	var i UpdateUserRow
-	err := row.Scan(&i.ID, &i.Email)
-	return i, err
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserEmail, arg.Email, arg.ID)
+	return err
+}
+
+const updateUserProfanityFilter = `-- name: UpdateUserProfanityFilter :exec
+UPDATE users
+SET
+    profanity_filter = $1
+WHERE id = $2
+`
+
+type UpdateUserProfanityFilterParams struct {
+	ProfanityFilter bool      `json:"profanity_filter"`
+	ID              uuid.UUID `json:"id"`
+}
+
+func (q *Queries) UpdateUserProfanityFilter(ctx context.Context, arg UpdateUserProfanityFilterParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserProfanityFilter, arg.ProfanityFilter, arg.ID)
+	return err
 }
@@ -0,0 +1,75 @@
+package entitlements
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Plan of users without a subscription in effect
+const PlanFree = "free"
+
+// Plan granted by a Chirpy Red subscription
+const PlanChirpyRed = "chirpy_red"
+
+// Limits and perks of a plan
+type Entitlements struct {
+	MaxChirpLength      int  `json:"max_chirp_length"`
+	CanEditChirps       bool `json:"can_edit_chirps"`
+	MaxScheduledChirps  int  `json:"max_scheduled_chirps"`  // Chirps waiting to be published at once, 0 disables scheduling
+	ChirpsPerHour       int  `json:"chirps_per_hour"`       // 0 means unlimited
+	MaxMediaAttachments int  `json:"max_media_attachments"` // Per chirp, 0 disables media
+}
+
+// Entitlements by plan name
+type Plans map[string]Entitlements
+
+// Plans used unless replaced by an entitlements file
+func DefaultPlans() Plans {
+	return Plans{
+		PlanFree: {
+			MaxChirpLength:      140,
+			CanEditChirps:       false,
+			MaxScheduledChirps:  1,
+			ChirpsPerHour:       30,
+			MaxMediaAttachments: 0,
+		},
+		PlanChirpyRed: {
+			MaxChirpLength:      1000,
+			CanEditChirps:       true,
+			MaxScheduledChirps:  25,
+			ChirpsPerHour:       300,
+			MaxMediaAttachments: 4,
+		},
+	}
+}
+
+// Read plans from a JSON file mapping plan names to limits, e.g. {"free": {"max_chirp_length": 140, ...}, ...}.
+// It must define the free plan, since that's the fallback for everyone else.
+func LoadPlans(path string) (Plans, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plans Plans
+	if err := json.Unmarshal(data, &plans); err != nil {
+		return nil, fmt.Errorf("invalid entitlements file %s: %w", path, err)
+	}
+	if _, ok := plans[PlanFree]; !ok {
+		return nil, fmt.Errorf("entitlements file %s doesn't define the %q plan", path, PlanFree)
+	}
+	for name, plan := range plans {
+		if plan.MaxChirpLength <= 0 {
+			return nil, fmt.Errorf("plan %q in %s needs a positive max_chirp_length", name, path)
+		}
+	}
+	return plans, nil
+}
+
+// Entitlements of a plan - plans that aren't configured get the free plan
+func (p Plans) For(plan string) Entitlements {
+	if e, ok := p[plan]; ok {
+		return e
+	}
+	return p[PlanFree]
+}
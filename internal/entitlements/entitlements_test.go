@@ -0,0 +1,39 @@
+package entitlements
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadPlans(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+		return path
+	}
+
+	plans, err := LoadPlans(write("plans.json", `{
+		"free": {"max_chirp_length": 200, "chirps_per_hour": 10},
+		"pro": {"max_chirp_length": 2000, "can_edit_chirps": true, "max_media_attachments": 8}
+	}`))
+	if err != nil {
+		t.Fatalf("Failed to load plans: %s", err)
+	}
+	if got := plans.For("pro"); !got.CanEditChirps || got.MaxMediaAttachments != 8 {
+		t.Errorf("Unexpected entitlements for pro: %+v", got)
+	}
+	if got := plans.For("unknown"); got != plans[PlanFree] {
+		t.Errorf("Expected unknown plans to fall back to free, got %+v", got)
+	}
+
+	if _, err := LoadPlans(write("nofree.json", `{"pro": {"max_chirp_length": 2000}}`)); err == nil {
+		t.Error("Expected an error for a file without the free plan")
+	}
+	if _, err := LoadPlans(write("nolength.json", `{"free": {"chirps_per_hour": 10}}`)); err == nil {
+		t.Error("Expected an error for a plan without a chirp length")
+	}
+}
@@ -0,0 +1,90 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscribe to every event type
+const AllEvents = "*"
+
+// A domain event, recorded in the same transaction as the change it describes
+type Event struct {
+	ID            uuid.UUID
+	AggregateType string
+	AggregateID   uuid.UUID
+	Type          string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+}
+
+// Subscriber callback - delivery is at least once, so it has to be idempotent
+type Handler func(ctx context.Context, event Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// In-process publish/subscribe of domain events
+type Bus struct {
+	subscribers map[string][]subscriber
+	mux         *sync.RWMutex
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[string][]subscriber),
+		mux:         &sync.RWMutex{},
+	}
+}
+
+// Register a handler for an event type, or for AllEvents. The name identifies it in errors.
+func (b *Bus) Subscribe(eventType, name string, handler Handler) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.subscribers[eventType] = append(b.subscribers[eventType], subscriber{name: name, handler: handler})
+}
+
+// Run every subscriber of the event, returning the errors of the ones that failed - the event is then published
+// again later, to all of them. A panicking subscriber counts as a failure rather than taking the dispatcher down.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mux.RLock()
+	subscribers := append(append([]subscriber{}, b.subscribers[event.Type]...), b.subscribers[AllEvents]...)
+	b.mux.RUnlock()
+
+	var errs []error
+	for _, sub := range subscribers {
+		if err := runHandler(ctx, sub, event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runHandler(ctx context.Context, sub subscriber, event Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return sub.handler(ctx, event)
+}
+
+// Retry schedule for events whose subscribers failed - 1s after the first failure, doubling up to 5m
+func RetryDelay(failedAttempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < failedAttempts; i++ {
+		delay *= 2
+		if delay >= 5*time.Minute {
+			return 5 * time.Minute
+		}
+	}
+	return delay
+}
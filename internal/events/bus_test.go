@@ -0,0 +1,68 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestPublish(t *testing.T) {
+	bus := NewBus()
+	var calls []string
+	bus.Subscribe("chirp.created", "counter", func(ctx context.Context, event Event) error {
+		calls = append(calls, "counter")
+		return nil
+	})
+	bus.Subscribe("chirp.created", "flaky", func(ctx context.Context, event Event) error {
+		calls = append(calls, "flaky")
+		return errors.New("receiver unavailable")
+	})
+	bus.Subscribe(AllEvents, "audit", func(ctx context.Context, event Event) error {
+		calls = append(calls, "audit")
+		panic("audit log closed")
+	})
+	bus.Subscribe("chirp.deleted", "cleanup", func(ctx context.Context, event Event) error {
+		calls = append(calls, "cleanup")
+		return nil
+	})
+
+	err := bus.Publish(context.Background(), Event{ID: uuid.New(), Type: "chirp.created"})
+	if got := strings.Join(calls, ","); got != "counter,flaky,audit" {
+		t.Errorf("Expected the chirp.created and catch-all subscribers to run, got '%s'", got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "flaky: receiver unavailable") || !strings.Contains(err.Error(), "audit: panic") {
+		t.Errorf("Expected the failures of flaky and audit, got '%v'", err)
+	}
+
+	calls = nil
+	if err := bus.Publish(context.Background(), Event{ID: uuid.New(), Type: "chirp.deleted"}); err == nil {
+		t.Error("Expected the panicking catch-all subscriber to fail")
+	}
+	if got := strings.Join(calls, ","); got != "cleanup,audit" {
+		t.Errorf("Expected cleanup and audit to run, got '%s'", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		failedAttempts int
+		want           time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{9, 256 * time.Second},
+		{10, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := RetryDelay(tt.failedAttempts); got != tt.want {
+			t.Errorf("Expected a delay of %s after %d failed attempts, got %s", tt.want, tt.failedAttempts, got)
+		}
+	}
+}
@@ -12,6 +12,7 @@ type AppLogs struct {
 	DatabaseLog string
 	ChirpLog    string
 	UserLog     string
+	SecurityLog string
 	mux         *sync.RWMutex
 }
 
@@ -56,6 +57,7 @@ func InitiateLogs(logFiles map[string]string) *AppLogs {
 	initLog(logFiles["databaseLog"])
 	initLog(logFiles["chirpLog"])
 	initLog(logFiles["userLog"])
+	initLog(logFiles["securityLog"])
 
 	appLogs := &AppLogs{
 		SystemLog:   logFiles["systemLog"],
@@ -63,6 +65,7 @@ func InitiateLogs(logFiles map[string]string) *AppLogs {
 		DatabaseLog: logFiles["databaseLog"],
 		ChirpLog:    logFiles["chirpLog"],
 		UserLog:     logFiles["userLog"],
+		SecurityLog: logFiles["securityLog"],
 		mux:         &sync.RWMutex{},
 	}
 
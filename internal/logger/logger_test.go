@@ -24,12 +24,13 @@ func InitMockLogs() *AppLogs {
 		log.Fatalf("Failed to get working directory: %v", err)
 	}
 	// Log file paths
-	mockLogFiles := make((map[string]string), 5)
+	mockLogFiles := make((map[string]string), 6)
 	mockLogFiles["systemLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "system_test.log")
 	mockLogFiles["handlerLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "handler_test.log")
 	mockLogFiles["databaseLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "database_test.log")
 	mockLogFiles["chirpLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "chirp_test.log")
 	mockLogFiles["userLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "user_test.log")
+	mockLogFiles["securityLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "security_test.log")
 
 	mockDB := InitiateLogs(mockLogFiles)
 	return mockDB
@@ -44,12 +45,13 @@ func TeardownMockLogs() []error {
 		log.Fatalf("Failed to get working directory: %v", err)
 	}
 	// Log file paths
-	mockLogFiles := make((map[string]string), 5)
+	mockLogFiles := make((map[string]string), 6)
 	mockLogFiles["systemLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "system_test.log")
 	mockLogFiles["handlerLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "handler_test.log")
 	mockLogFiles["databaseLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "database_test.log")
 	mockLogFiles["chirpLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "chirp_test.log")
 	mockLogFiles["userLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "user_test.log")
+	mockLogFiles["securityLog"] = filepath.Join(baseDir, "..", "..", "test", "logs", "security_test.log")
 
 	for index, file := range mockLogFiles {
 		err := os.Remove(file)
@@ -87,6 +89,10 @@ func TestNewApiConfig(t *testing.T) {
 	if !exists {
 		t.Error("User log file creation failed")
 	}
+	exists = FileExists(mockLogs.SecurityLog)
+	if !exists {
+		t.Error("Security log file creation failed")
+	}
 
 	errList := TeardownMockLogs()
 	if len(errList) != 0 {
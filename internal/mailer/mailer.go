@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// An e-mail message, plain text only
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sends e-mail messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Mailer that writes messages to a log instead of sending them - used in development and when no SMTP server is set
+type LogMailer struct {
+	logf func(format string, args ...interface{})
+}
+
+func NewLogMailer(logf func(format string, args ...interface{})) *LogMailer {
+	return &LogMailer{logf: logf}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	m.logf("E-mail to %s\nSubject: %s\n\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Mailer that sends messages through an SMTP server
+type SMTPMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// addr is host:port of the SMTP server. Without a username no authentication is used.
+func NewSMTPMailer(addr, username, password, from string) (*SMTPMailer, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %s: %w", addr, err)
+	}
+	if from == "" {
+		return nil, fmt.Errorf("missing sender address")
+	}
+
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m, nil
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := m.format(msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// net/smtp doesn't take a context, give up on the send when the context is done
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, data)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Build the message as sent over SMTP - headers, then the body with CRLF line endings
+func (m *SMTPMailer) format(msg Message, now time.Time) ([]byte, error) {
+	if strings.ContainsAny(msg.To, "\r\n") || strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid message headers")
+	}
+
+	var data strings.Builder
+	fmt.Fprintf(&data, "From: %s\r\n", m.from)
+	fmt.Fprintf(&data, "To: %s\r\n", msg.To)
+	// Non-ASCII subjects have to be encoded, header values are ASCII only
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	data.WriteString("\r\n")
+	body := strings.ReplaceAll(msg.Body, "\r\n", "\n")
+	data.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(data.String()), nil
+}
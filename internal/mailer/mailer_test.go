@@ -0,0 +1,156 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSMTPMailerFormat(t *testing.T) {
+	m, err := NewSMTPMailer("smtp.example.com:587", "", "", "Chirpy <noreply@chirpy.example.com>")
+	if err != nil {
+		t.Fatalf("Expected mailer to be created, got %v", err)
+	}
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		msg         Message
+		wantSubject string
+		wantBody    string
+	}{
+		{
+			name:        "Plain message",
+			msg:         Message{To: "walt@breakingbad.com", Subject: "Confirm your e-mail address", Body: "Hi,\n\nconfirm here.\n"},
+			wantSubject: "Confirm your e-mail address",
+			wantBody:    "Hi,\r\n\r\nconfirm here.\r\n",
+		},
+		{
+			name:        "CRLF line endings are kept",
+			msg:         Message{To: "walt@breakingbad.com", Subject: "Hello", Body: "one\r\ntwo\nthree"},
+			wantSubject: "Hello",
+			wantBody:    "one\r\ntwo\r\nthree",
+		},
+		{
+			name:        "Non-ASCII subject",
+			msg:         Message{To: "walt@breakingbad.com", Subject: "Potvrdite e-mail adresu – Chirpy", Body: "Pozdrav šalje Chirpy"},
+			wantSubject: "=?utf-8?q?Potvrdite_e-mail_adresu_=E2=80=93_Chirpy?=",
+			wantBody:    "Pozdrav šalje Chirpy",
+		},
+		{
+			name:        "Empty body",
+			msg:         Message{To: "walt@breakingbad.com", Subject: "Hello"},
+			wantSubject: "Hello",
+			wantBody:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := m.format(tt.msg, now)
+			if err != nil {
+				t.Fatalf("Expected message to be formatted, got %v", err)
+			}
+
+			headers, body, ok := strings.Cut(string(data), "\r\n\r\n")
+			if !ok {
+				t.Fatalf("Expected headers and body separated by an empty line, got %q", data)
+			}
+			wantHeaders := strings.Join([]string{
+				"From: Chirpy <noreply@chirpy.example.com>",
+				"To: " + tt.msg.To,
+				"Subject: " + tt.wantSubject,
+				"Date: Sat, 15 Jun 2024 12:00:00 +0000",
+				"MIME-Version: 1.0",
+				"Content-Type: text/plain; charset=utf-8",
+			}, "\r\n")
+			if headers != wantHeaders {
+				t.Errorf("Expected headers:\n%q\ngot:\n%q", wantHeaders, headers)
+			}
+			if body != tt.wantBody {
+				t.Errorf("Expected body %q, got %q", tt.wantBody, body)
+			}
+			if strings.Contains(strings.ReplaceAll(string(data), "\r\n", ""), "\n") {
+				t.Errorf("Expected only CRLF line endings, got %q", data)
+			}
+		})
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	m, err := NewSMTPMailer("127.0.0.1:1", "", "", "noreply@chirpy.example.com")
+	if err != nil {
+		t.Fatalf("Expected mailer to be created, got %v", err)
+	}
+
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"Newline in recipient", Message{To: "walt@breakingbad.com\r\nBcc: everyone@example.com", Subject: "Hello"}},
+		{"Bare LF in recipient", Message{To: "walt@breakingbad.com\nBcc: everyone@example.com", Subject: "Hello"}},
+		{"Newline in subject", Message{To: "walt@breakingbad.com", Subject: "Hello\r\nBcc: everyone@example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Rejected before connecting to the server
+			err := m.Send(context.Background(), tt.msg)
+			if err == nil || err.Error() != "invalid message headers" {
+				t.Errorf("Expected invalid message headers, got %v", err)
+			}
+		})
+	}
+}
+
+func TestNewSMTPMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     string
+		username string
+		from     string
+		wantErr  bool
+		wantAuth bool
+	}{
+		{"Without authentication", "smtp.example.com:25", "", "noreply@chirpy.example.com", false, false},
+		{"With authentication", "smtp.example.com:587", "chirpy", "noreply@chirpy.example.com", false, true},
+		{"Missing port", "smtp.example.com", "", "noreply@chirpy.example.com", true, false},
+		{"Missing sender", "smtp.example.com:25", "", "", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewSMTPMailer(tt.addr, tt.username, "secret", tt.from)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected mailer to be created, got %v", err)
+			}
+			if (m.auth != nil) != tt.wantAuth {
+				t.Errorf("Expected authentication %v, got %v", tt.wantAuth, m.auth != nil)
+			}
+		})
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var logged string
+	m := NewLogMailer(func(format string, args ...interface{}) {
+		logged = fmt.Sprintf(format, args...)
+	})
+
+	err := m.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Hello", Body: "Say my name."})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := "E-mail to walt@breakingbad.com\nSubject: Hello\n\nSay my name."
+	if logged != want {
+		t.Errorf("Expected %q, got %q", want, logged)
+	}
+}
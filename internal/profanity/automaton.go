@@ -0,0 +1,92 @@
+package profanity
+
+// Aho-Corasick automaton, compiled into a DFA - finds every pattern in one pass, one table lookup per byte of text
+type automaton struct {
+	// Bytes that don't occur in any pattern share class 0, which keeps the table small
+	classes    [256]uint16
+	numClasses int
+	// Next state for every state and byte class - state*numClasses+class
+	delta []int32
+	// Patterns ending in a state, and the next state on its failure chain where patterns end - 0 if none,
+	// as no pattern ends in the root
+	outputs  [][]int32
+	dictLink []int32
+}
+
+// Build the automaton for non-empty patterns, identified by their index
+func newAutomaton(patterns []string) *automaton {
+	a := &automaton{numClasses: 1}
+	for _, pattern := range patterns {
+		for i := 0; i < len(pattern); i++ {
+			if a.classes[pattern[i]] == 0 {
+				a.classes[pattern[i]] = uint16(a.numClasses)
+				a.numClasses++
+			}
+		}
+	}
+	width := a.numClasses
+
+	// The trie - a transition to 0 is a missing one, since no transition leads back to the root
+	a.delta = make([]int32, width)
+	a.outputs = [][]int32{nil}
+	for i, pattern := range patterns {
+		state := 0
+		for j := 0; j < len(pattern); j++ {
+			class := int(a.classes[pattern[j]])
+			next := a.delta[state*width+class]
+			if next == 0 {
+				next = int32(len(a.outputs))
+				a.outputs = append(a.outputs, nil)
+				a.delta = append(a.delta, make([]int32, width)...)
+				a.delta[state*width+class] = next
+			}
+			state = int(next)
+		}
+		a.outputs[state] = append(a.outputs[state], int32(i))
+	}
+
+	// Failure links to the longest proper suffix of a state's path that is also in the trie, breadth first
+	// so a state's failure target is complete before the state is.
+	// Missing transitions are replaced with those of the failure target.
+	fail := make([]int32, len(a.outputs))
+	a.dictLink = make([]int32, len(a.outputs))
+	queue := make([]int32, 0, len(a.outputs))
+	for class := 0; class < width; class++ {
+		if next := a.delta[class]; next != 0 {
+			queue = append(queue, next)
+		}
+	}
+	for len(queue) > 0 {
+		state := int(queue[0])
+		queue = queue[1:]
+		for class := 0; class < width; class++ {
+			next := a.delta[state*width+class]
+			fallback := a.delta[int(fail[state])*width+class]
+			if next == 0 {
+				a.delta[state*width+class] = fallback
+				continue
+			}
+			fail[next] = fallback
+			if len(a.outputs[fallback]) > 0 {
+				a.dictLink[next] = fallback
+			} else {
+				a.dictLink[next] = a.dictLink[fallback]
+			}
+			queue = append(queue, next)
+		}
+	}
+	return a
+}
+
+// Call found for every occurrence of a pattern in text, with the pattern's index and the offset it ends at
+func (a *automaton) find(text string, found func(pattern, end int)) {
+	state := 0
+	for i := 0; i < len(text); i++ {
+		state = int(a.delta[state*a.numClasses+int(a.classes[text[i]])])
+		for match := state; match != 0; match = int(a.dictLink[match]) {
+			for _, pattern := range a.outputs[match] {
+				found(int(pattern), i+1)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package profanity
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+const benchmarkChirp = "I really need a Kerfuffle to go to bed sooner, Fornax! (Not a sharbert though...) f0rnax?"
+
+// A dictionary of n made up words, every tenth of them a substring entry
+func benchmarkDictionary(n int) *Dictionary {
+	random := rand.New(rand.NewSource(1))
+	var lines strings.Builder
+	lines.WriteString("kerfuffle\nsharbert\nfornax\n")
+	for i := 0; i < n; i++ {
+		length := 5 + random.Intn(6)
+		word := make([]byte, length)
+		for j := range word {
+			word[j] = byte('a' + random.Intn(26))
+		}
+		if i%10 == 0 {
+			lines.WriteString(substringPrefix)
+		}
+		lines.Write(word)
+		lines.WriteByte('\n')
+	}
+	dict, err := ParseDictionary(strings.NewReader(lines.String()))
+	if err != nil {
+		panic(err)
+	}
+	return dict
+}
+
+func BenchmarkCheck(b *testing.B) {
+	longText := strings.Repeat(benchmarkChirp+" ", 50)
+	for _, size := range []int{0, 1000, 10000} {
+		dict := benchmarkDictionary(size)
+		filter := NewFilter(dict)
+		legacy := newLegacyDictionary(dict)
+		for _, text := range []struct {
+			name string
+			body string
+		}{
+			{name: "chirp", body: benchmarkChirp},
+			{name: "long", body: longText},
+		} {
+			b.Run(fmt.Sprintf("terms=%d/%s/automaton", dict.Len(), text.name), func(b *testing.B) {
+				b.SetBytes(int64(len(text.body)))
+				for i := 0; i < b.N; i++ {
+					filter.Check(text.body)
+				}
+			})
+			b.Run(fmt.Sprintf("terms=%d/%s/legacy", dict.Len(), text.name), func(b *testing.B) {
+				b.SetBytes(int64(len(text.body)))
+				for i := 0; i < b.N; i++ {
+					legacyMaskWords(text.body, legacy)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkBuild(b *testing.B) {
+	entries := benchmarkDictionary(10000).entries
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		newDictionary(entries)
+	}
+}
@@ -0,0 +1,106 @@
+package profanity
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Entry prefixes - "~sharbert" is masked inside words too, "!scunthorpe" is never masked, "#" starts a comment line
+const (
+	substringPrefix = "~"
+	allowPrefix     = "!"
+	commentPrefix   = "#"
+)
+
+// How an entry matches - entries without a prefix are masked as whole words, phrases word by word
+type matchMode int
+
+const (
+	matchWord matchMode = iota
+	matchSubstring
+	matchAllowed
+)
+
+type entry struct {
+	// Folded words of the entry, separated by single spaces
+	term string
+	mode matchMode
+}
+
+// Terms of one or more dictionary files, compiled into an automaton that finds all of them in one pass
+type Dictionary struct {
+	entries   []entry
+	automaton *automaton
+}
+
+func newDictionary(entries []entry) *Dictionary {
+	patterns := make([]string, len(entries))
+	for i, e := range entries {
+		patterns[i] = e.term
+	}
+	return &Dictionary{
+		entries:   entries,
+		automaton: newAutomaton(patterns),
+	}
+}
+
+// Read a dictionary file, one entry per line - entries are folded like the text they're compared with (see fold)
+func ParseDictionary(r io.Reader) (*Dictionary, error) {
+	entries, err := parseEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	return newDictionary(entries), nil
+}
+
+func parseEntries(r io.Reader) ([]entry, error) {
+	var entries []entry
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, commentPrefix) {
+			continue
+		}
+
+		e := entry{mode: matchWord}
+		switch {
+		case strings.HasPrefix(line, substringPrefix):
+			e.mode = matchSubstring
+			line = line[len(substringPrefix):]
+		case strings.HasPrefix(line, allowPrefix):
+			e.mode = matchAllowed
+			line = line[len(allowPrefix):]
+		}
+
+		var words []string
+		for _, word := range strings.Fields(line) {
+			if folded := fold(word); folded != "" {
+				words = append(words, folded)
+			}
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("line %d: entry without any letters or digits: %q", lineNumber, scanner.Text())
+		}
+		e.term = strings.Join(words, " ")
+		entries = append(entries, e)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Number of masked terms, whole-word and substring
+func (d *Dictionary) Len() int {
+	count := 0
+	for _, e := range d.entries {
+		if e.mode != matchAllowed {
+			count++
+		}
+	}
+	return count
+}
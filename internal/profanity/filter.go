@@ -0,0 +1,156 @@
+package profanity
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Extension of dictionary files - the rest of the file name is the language
+const dictionaryExt = ".txt"
+
+// Masks profane words using the dictionaries of every language in a directory.
+// The dictionaries can be reloaded while the filter is in use.
+type Filter struct {
+	dir       string
+	dict      *Dictionary
+	languages []string
+	// Modification times of the loaded files, to notice changes on disk
+	modTimes map[string]time.Time
+	mux      *sync.RWMutex
+}
+
+// A filter with a fixed dictionary, not backed by files
+func NewFilter(dict *Dictionary) *Filter {
+	return &Filter{
+		dict:     dict,
+		modTimes: make(map[string]time.Time),
+		mux:      &sync.RWMutex{},
+	}
+}
+
+// Load every dictionary file in dir
+func LoadDir(dir string) (*Filter, error) {
+	f := NewFilter(newDictionary(nil))
+	f.dir = dir
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Read the dictionary files again. On error the current dictionaries stay in use.
+func (f *Filter) Reload() error {
+	if f.dir == "" {
+		return nil
+	}
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*"+dictionaryExt))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no %s dictionary files in %s", dictionaryExt, f.dir)
+	}
+
+	var entries []entry
+	languages := make([]string, 0, len(paths))
+	modTimes := make(map[string]time.Time, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		languageEntries, err := parseEntries(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		entries = append(entries, languageEntries...)
+		languages = append(languages, strings.TrimSuffix(filepath.Base(path), dictionaryExt))
+		modTimes[path] = info.ModTime()
+	}
+	sort.Strings(languages)
+	// The automaton is built once for all languages, so checking a text is one pass however many there are
+	dict := newDictionary(entries)
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.dict = dict
+	f.languages = languages
+	f.modTimes = modTimes
+	return nil
+}
+
+// Whether a dictionary file was added, removed or modified since the last load
+func (f *Filter) changed() bool {
+	paths, err := filepath.Glob(filepath.Join(f.dir, "*"+dictionaryExt))
+	if err != nil {
+		return false
+	}
+
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	if len(paths) != len(f.modTimes) {
+		return true
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return true
+		}
+		if loaded, ok := f.modTimes[path]; !ok || !loaded.Equal(info.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check the dictionary directory for changes every interval and reload it when something changed.
+// onReload is called with the outcome of every reload. Blocks, so run it in its own goroutine.
+func (f *Filter) Watch(interval time.Duration, onReload func(error)) {
+	if f.dir == "" {
+		return
+	}
+	for range time.Tick(interval) {
+		if f.changed() {
+			onReload(f.Reload())
+		}
+	}
+}
+
+// Languages of the loaded dictionaries
+func (f *Filter) Languages() []string {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return append([]string{}, f.languages...)
+}
+
+// Number of masked terms in the loaded dictionaries
+func (f *Filter) Len() int {
+	f.mux.RLock()
+	defer f.mux.RUnlock()
+	return f.dict.Len()
+}
+
+// Find the profane words and phrases of a text - for callers that reject or flag text rather than mask it
+func (f *Filter) Find(body string) []Match {
+	f.mux.RLock()
+	dict := f.dict
+	f.mux.RUnlock()
+	return dict.find(body)
+}
+
+// Mask the profane words and phrases of a text
+func (f *Filter) Check(body string) string {
+	return Mask(body, f.Find(body))
+}
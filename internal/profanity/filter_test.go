@@ -0,0 +1,89 @@
+package profanity
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDictionary(t *testing.T) {
+	dict, err := ParseDictionary(strings.NewReader("# comment\n\nFornax\n~cunt\n!Scunthorpe\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse dictionary: %s", err)
+	}
+	filter := NewFilter(dict)
+
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: "What a fornax!", want: "What a ****!"},
+		{body: "FORNAX, again", want: "****, again"},
+		{body: "fornaxes are fine", want: "fornaxes are fine"},
+		{body: "welcome to Scunthorpe.", want: "welcome to Scunthorpe."},
+		{body: "cunts everywhere", want: "**** everywhere"},
+		{body: "Really?!", want: "Really?!"},
+	}
+	for _, tc := range tests {
+		if got := filter.Check(tc.body); got != tc.want {
+			t.Errorf("Check(%q): expected %q, got %q", tc.body, tc.want, got)
+		}
+	}
+}
+
+func TestParseDictionaryInvalidEntry(t *testing.T) {
+	if _, err := ParseDictionary(strings.NewReader("fornax\n~\n")); err == nil {
+		t.Error("Expected an error for an empty substring entry")
+	}
+}
+
+func TestLoadDirAndReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %s", name, err)
+		}
+	}
+	writeFile("en.txt", "fornax\n")
+	writeFile("de.txt", "mist\n")
+
+	filter, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to load dictionaries: %s", err)
+	}
+	if languages := filter.Languages(); !reflect.DeepEqual(languages, []string{"de", "en"}) {
+		t.Errorf("Expected languages [de en], got %v", languages)
+	}
+	if got := filter.Check("fornax mist kerfuffle"); got != "**** **** kerfuffle" {
+		t.Errorf("Unexpected result before reload: %q", got)
+	}
+	if filter.changed() {
+		t.Error("Expected no changes right after loading")
+	}
+
+	writeFile("en.txt", "kerfuffle\n")
+	// Make sure the modification time differs on file systems with a coarse resolution
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(dir, "en.txt"), later, later)
+	if !filter.changed() {
+		t.Fatal("Expected the modified file to be noticed")
+	}
+	if err := filter.Reload(); err != nil {
+		t.Fatalf("Failed to reload dictionaries: %s", err)
+	}
+	if got := filter.Check("fornax mist kerfuffle"); got != "fornax **** ****" {
+		t.Errorf("Unexpected result after reload: %q", got)
+	}
+
+	// A broken file doesn't replace the loaded dictionaries
+	writeFile("fr.txt", "~\n")
+	if err := filter.Reload(); err == nil {
+		t.Error("Expected an error for an invalid dictionary")
+	}
+	if got := filter.Check("kerfuffle"); got != "****" {
+		t.Errorf("Expected the previous dictionaries to stay in use, got %q", got)
+	}
+}
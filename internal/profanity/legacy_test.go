@@ -0,0 +1,93 @@
+package profanity
+
+import (
+	"strings"
+	"unicode"
+)
+
+// The map based matcher the Aho-Corasick automaton replaced - one lookup per word, and a scan over every
+// substring term for every word. Kept to benchmark the automaton against, and to check both agree.
+
+type legacyDictionary struct {
+	words      map[string]bool
+	substrings []string
+	allowed    map[string]bool
+}
+
+func newLegacyDictionary(dict *Dictionary) *legacyDictionary {
+	legacy := &legacyDictionary{
+		words:   make(map[string]bool),
+		allowed: make(map[string]bool),
+	}
+	for _, e := range dict.entries {
+		switch e.mode {
+		case matchWord:
+			legacy.words[e.term] = true
+		case matchSubstring:
+			legacy.substrings = append(legacy.substrings, e.term)
+		case matchAllowed:
+			legacy.allowed[e.term] = true
+		}
+	}
+	return legacy
+}
+
+func (d *legacyDictionary) matches(word string) bool {
+	if word == "" || d.allowed[word] {
+		return false
+	}
+	if d.words[word] {
+		return true
+	}
+	for _, substring := range d.substrings {
+		if strings.Contains(word, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+func legacyMaskWords(chBody string, dict *legacyDictionary) (cleanBody string) {
+	var clean strings.Builder
+	clean.Grow(len(chBody))
+
+	rest := chBody
+	for rest != "" {
+		wordStart := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+		if wordStart < 0 {
+			clean.WriteString(rest)
+			break
+		}
+		clean.WriteString(rest[:wordStart])
+		rest = rest[wordStart:]
+
+		wordEnd := strings.IndexFunc(rest, unicode.IsSpace)
+		if wordEnd < 0 {
+			wordEnd = len(rest)
+		}
+		word := rest[:wordEnd]
+		rest = rest[wordEnd:]
+
+		clean.WriteString(legacyMaskWord(word, dict))
+	}
+	cleanBody = clean.String()
+	return cleanBody
+}
+
+func legacyMaskWord(word string, dict *legacyDictionary) string {
+	trimmed := strings.TrimLeftFunc(word, isEdge)
+	core := strings.TrimRightFunc(trimmed, isEdge)
+	if core == "" {
+		return word
+	}
+	foldedCore := fold(core)
+	if dict.matches(foldedCore) {
+		prefix := word[:len(word)-len(trimmed)]
+		suffix := trimmed[len(core):]
+		return prefix + "****" + suffix
+	}
+	if core != word && !dict.allowed[foldedCore] && dict.matches(fold(word)) {
+		return "****"
+	}
+	return word
+}
@@ -0,0 +1,188 @@
+package profanity
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// What masked text is replaced with
+const maskText = "****"
+
+// A dictionary term found in a text
+type Match struct {
+	// Byte offsets of the matched words in the original text - punctuation around them isn't included,
+	// unless it's part of the term, like in "$harbert"
+	Start int
+	End   int
+	// The dictionary entry that matched, folded
+	Term string
+}
+
+// A word of the text, and where its folded form is in the folded text
+type word struct {
+	// Offsets in the original text, of the word and of the word with the punctuation around it
+	start, end           int
+	tokenStart, tokenEnd int
+	foldedStart          int
+	foldedEnd            int
+}
+
+// Split a text into words and fold them, separated by single spaces, into the text the automaton searches.
+// Tokens without any letters or digits, like a lone dash, are left out.
+func splitWords(text string) (words []word, folded string) {
+	buf := make([]byte, 0, len(text))
+	offset := 0
+	for offset < len(text) {
+		tokenStart := strings.IndexFunc(text[offset:], func(r rune) bool { return !unicode.IsSpace(r) })
+		if tokenStart < 0 {
+			break
+		}
+		tokenStart += offset
+		tokenEnd := strings.IndexFunc(text[tokenStart:], unicode.IsSpace)
+		if tokenEnd < 0 {
+			tokenEnd = len(text)
+		} else {
+			tokenEnd += tokenStart
+		}
+		offset = tokenEnd
+
+		token := text[tokenStart:tokenEnd]
+		trimmed := strings.TrimLeftFunc(token, isEdge)
+		core := strings.TrimRightFunc(trimmed, isEdge)
+
+		previousEnd := len(buf)
+		if previousEnd > 0 {
+			buf = append(buf, ' ')
+		}
+		foldedStart := len(buf)
+		buf = appendFolded(buf, core)
+		if len(buf) == foldedStart {
+			buf = buf[:previousEnd]
+			continue
+		}
+
+		start := tokenStart + len(token) - len(trimmed)
+		words = append(words, word{
+			start:       start,
+			end:         start + len(core),
+			tokenStart:  tokenStart,
+			tokenEnd:    tokenEnd,
+			foldedStart: foldedStart,
+			foldedEnd:   len(buf),
+		})
+	}
+	return words, string(buf)
+}
+
+// An entry found in folded text, by offsets in it
+type hit struct {
+	start, end int
+	entry      int
+}
+
+// Find the entries in folded text. Whole-word entries only count when they start and end at word
+// boundaries, and nothing counts inside an allowed term.
+func (d *Dictionary) scan(folded string) (hits, allowed []hit) {
+	d.automaton.find(folded, func(entry, end int) {
+		e := d.entries[entry]
+		h := hit{start: end - len(e.term), end: end, entry: entry}
+		if e.mode != matchSubstring && !(startsWord(folded, h.start) && endsWord(folded, h.end)) {
+			return
+		}
+		if e.mode == matchAllowed {
+			allowed = append(allowed, h)
+		} else {
+			hits = append(hits, h)
+		}
+	})
+
+	kept := hits[:0]
+	for _, h := range hits {
+		if !coveredBy(h.start, h.end, allowed) {
+			kept = append(kept, h)
+		}
+	}
+	return kept, allowed
+}
+
+func startsWord(folded string, offset int) bool {
+	return offset == 0 || folded[offset-1] == ' '
+}
+
+func endsWord(folded string, offset int) bool {
+	return offset == len(folded) || folded[offset] == ' '
+}
+
+func coveredBy(start, end int, spans []hit) bool {
+	for _, span := range spans {
+		if span.start <= start && end <= span.end {
+			return true
+		}
+	}
+	return false
+}
+
+// Find the dictionary terms in a text, ordered by where they start
+func (d *Dictionary) find(text string) []Match {
+	words, folded := splitWords(text)
+	if len(words) == 0 {
+		return nil
+	}
+
+	var matches []Match
+	matched := make([]bool, len(words))
+	wordAt := func(offset int) int {
+		return sort.Search(len(words), func(i int) bool { return words[i].foldedEnd > offset })
+	}
+	hits, allowed := d.scan(folded)
+	for _, h := range hits {
+		first, last := wordAt(h.start), wordAt(h.end-1)
+		for i := first; i <= last; i++ {
+			matched[i] = true
+		}
+		matches = append(matches, Match{Start: words[first].start, End: words[last].end, Term: d.entries[h.entry].term})
+	}
+
+	// Words that only become terms together with the punctuation around them - "$harbert"
+	for i, w := range words {
+		if matched[i] || (w.start == w.tokenStart && w.end == w.tokenEnd) || coveredBy(w.foldedStart, w.foldedEnd, allowed) {
+			continue
+		}
+		foldedToken := fold(text[w.tokenStart:w.tokenEnd])
+		if foldedToken == folded[w.foldedStart:w.foldedEnd] {
+			continue
+		}
+		if tokenHits, _ := d.scan(foldedToken); len(tokenHits) > 0 {
+			matches = append(matches, Match{Start: w.tokenStart, End: w.tokenEnd, Term: d.entries[tokenHits[0].entry].term})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Start < matches[j].Start })
+	return matches
+}
+
+// Replace the matched parts of a text, overlapping matches together, and keep the rest as it was
+func Mask(text string, matches []Match) string {
+	if len(matches) == 0 {
+		return text
+	}
+	sorted := append([]Match{}, matches...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start < sorted[j].Start })
+
+	var masked strings.Builder
+	masked.Grow(len(text))
+	offset := 0
+	for _, match := range sorted {
+		if match.End <= offset {
+			continue
+		}
+		if match.Start >= offset {
+			masked.WriteString(text[offset:match.Start])
+			masked.WriteString(maskText)
+		}
+		offset = match.End
+	}
+	masked.WriteString(text[offset:])
+	return masked.String()
+}
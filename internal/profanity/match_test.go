@@ -0,0 +1,96 @@
+package profanity
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAutomatonFind(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "s"}
+	a := newAutomaton(patterns)
+
+	type found struct {
+		pattern string
+		end     int
+	}
+	var got []found
+	a.find("ushers", func(pattern, end int) {
+		got = append(got, found{patterns[pattern], end})
+	})
+	sort.Slice(got, func(i, j int) bool {
+		if got[i].end != got[j].end {
+			return got[i].end < got[j].end
+		}
+		return got[i].pattern < got[j].pattern
+	})
+
+	want := []found{{"s", 2}, {"he", 4}, {"she", 4}, {"hers", 6}, {"s", 6}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestFind(t *testing.T) {
+	dict, err := ParseDictionary(strings.NewReader("fornax\nson of a fornax\n~sharbert\n!sharbertine\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse dictionary: %s", err)
+	}
+	filter := NewFilter(dict)
+
+	tests := []struct {
+		name string
+		body string
+		want []Match
+	}{
+		{name: "nothing", body: "a fine day", want: nil},
+		{name: "word", body: "what a (fornax)", want: []Match{{Start: 8, End: 14, Term: "fornax"}}},
+		{name: "phrase", body: "you SON of a\n f0rnax!", want: []Match{
+			{Start: 4, End: 20, Term: "son of a fornax"},
+			{Start: 14, End: 20, Term: "fornax"},
+		}},
+		{name: "phrase needs whole words", body: "son of afornax", want: nil},
+		{name: "substring", body: "unsharbertly", want: []Match{{Start: 0, End: 12, Term: "sharbert"}}},
+		{name: "allowed", body: "Sharbertine", want: nil},
+		{name: "punctuation makes the word", body: "$harbert", want: []Match{{Start: 0, End: 8, Term: "sharbert"}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filter.Find(tc.body); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Find(%q): expected %v, got %v", tc.body, tc.want, got)
+			}
+		})
+	}
+
+	if got := filter.Check("you son of a fornax!"); got != "you ****!" {
+		t.Errorf("Expected overlapping matches to be masked together, got %q", got)
+	}
+}
+
+// The automaton has to mask exactly what the map based matcher did, for the terms that one supported
+func TestMatchesLegacy(t *testing.T) {
+	dict, err := ParseDictionary(strings.NewReader("fornax\nkerfuffle\nsharbert\n~cunt\n~4ss\n!scunthorpe\n!classic\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse dictionary: %s", err)
+	}
+	filter := NewFilter(dict)
+	legacy := newLegacyDictionary(dict)
+
+	bodies := []string{
+		"I had something interesting for breakfast",
+		"This is a kerfuffle opinion I need to share with the world",
+		"(fornax [sharbert] “kerfuffle” -fornax- ?! ... --",
+		"a  fornax   b\tkerfuffle\nsharbert  ",
+		"f.o.r.n.a.x! s-h-a-r-b-e-r-t k3rfuff13 sh@rbert $harbert",
+		"fórnäx ｆｏｒｎａｘ 𝐟𝐨𝐫𝐧𝐚𝐱 fоrnах ΚΕRFUFFLΕ «Ｆ0.r.n.а.х»",
+		"a massive grass problem in (Scunthorpe!) - a classic c.u.n.t.s",
+		"0 1 3 4 5 7 8 9 日本語 ελληνικά",
+	}
+	for _, body := range bodies {
+		if got, want := filter.Check(body), legacyMaskWords(body, legacy); got != want {
+			t.Errorf("Check(%q): expected %q like the legacy matcher, got %q", body, want, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package profanity
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Look-alikes of Latin letters. Upper case entries are matched before lower casing, since e.g. Greek "Η"
+// looks like "H" while its lower case form "η" looks like "n".
+var confusables = map[rune]rune{
+	// Cyrillic
+	'А': 'a', 'В': 'b', 'Е': 'e', 'К': 'k', 'М': 'm', 'Н': 'h', 'О': 'o', 'Р': 'p', 'С': 'c', 'Т': 't',
+	'У': 'y', 'Х': 'x', 'Ѕ': 's', 'І': 'i', 'Ј': 'j', 'Ԛ': 'q', 'Ԝ': 'w',
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'һ': 'h', 'ӏ': 'l',
+	// Greek
+	'Α': 'a', 'Β': 'b', 'Ε': 'e', 'Ζ': 'z', 'Η': 'h', 'Ι': 'i', 'Κ': 'k', 'Μ': 'm', 'Ν': 'n', 'Ο': 'o',
+	'Ρ': 'p', 'Τ': 't', 'Υ': 'y', 'Χ': 'x',
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin letters that don't decompose into a base letter and an accent
+	'ø': 'o', 'ł': 'l', 'đ': 'd', 'ħ': 'h', 'ı': 'i', 'ɑ': 'a', 'ɡ': 'g',
+}
+
+// Leetspeak - only read as letters in words that also contain letters, so plain numbers stay numbers
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't', '€': 'e',
+}
+
+// Bring a word into the form it's compared in, so "ｆｏｒｎａｘ", "fórnäx", Cyrillic "fоrnах", "f0rnax" and "f.o.r.n.a.x" all read "fornax"
+func fold(word string) string {
+	return string(appendFolded(nil, word))
+}
+
+// Append the folded form of a word to buf - folding a whole text into one buffer saves an allocation per word
+func appendFolded(buf []byte, word string) []byte {
+	// NFKD rather than NFKC - the compatibility mapping is the same, but accents come apart as combining marks
+	decomposed := norm.NFKD.String(word)
+	readLeetspeak := strings.IndexFunc(decomposed, unicode.IsLetter) >= 0
+
+	for _, r := range decomposed {
+		// No look-alikes in ASCII - skipping the lookups keeps plain text fast
+		if r >= utf8.RuneSelf {
+			if latin, ok := confusables[r]; ok {
+				r = latin
+			} else if latin, ok := confusables[unicode.ToLower(r)]; ok {
+				r = latin
+			}
+		}
+		switch {
+		case unicode.IsLetter(r):
+			r = unicode.ToLower(r)
+		case readLeetspeak && leetspeak[r] != 0:
+			r = leetspeak[r]
+		case unicode.IsDigit(r):
+		default:
+			// Accents split off by NFKD, punctuation, zero-width characters
+			continue
+		}
+		// Upper case I and lower case l look the same, and 1 stands for either - they're all read as l
+		if r == 'i' {
+			r = 'l'
+		}
+		buf = utf8.AppendRune(buf, r)
+	}
+	return buf
+}
+
+// Whether a character can be cut off the start or end of a word - quotes, brackets, punctuation
+func isEdge(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
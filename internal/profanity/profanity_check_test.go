@@ -0,0 +1,98 @@
+package profanity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfanityCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		// Plain words
+		{name: "clean", body: "I had something interesting for breakfast", want: "I had something interesting for breakfast"},
+		{name: "profane word", body: "This is a kerfuffle opinion I need to share with the world", want: "This is a **** opinion I need to share with the world"},
+		{name: "upper case", body: "I really need a KERFUFFLE to go to bed sooner, Fornax !", want: "I really need a **** to go to bed sooner, **** !"},
+		{name: "longer word", body: "kerfuffles and fornaxes", want: "kerfuffles and fornaxes"},
+		{name: "empty", body: "", want: ""},
+
+		// Punctuation around words
+		{name: "trailing punctuation", body: "sharbert?!", want: "****?!"},
+		{name: "leading punctuation", body: "(fornax", want: "(****"},
+		{name: "brackets", body: "[sharbert]", want: "[****]"},
+		{name: "quotes", body: `she said "FORNAX!!"`, want: `she said "****!!"`},
+		{name: "curly quotes", body: "“kerfuffle”", want: "“****”"},
+		{name: "only punctuation", body: "?! ... --", want: "?! ... --"},
+		{name: "hyphenated", body: "-fornax-", want: "-****-"},
+
+		// Whitespace is kept as it was
+		{name: "several spaces", body: "a  fornax   b", want: "a  ****   b"},
+		{name: "tabs and newlines", body: "fornax\tkerfuffle\nsharbert", want: "****\t****\n****"},
+		{name: "leading and trailing whitespace", body: "  fornax\n", want: "  ****\n"},
+		{name: "no-break space", body: "fornax\u00a0sharbert", want: "****\u00a0****"},
+
+		// Separators inside words
+		{name: "dots", body: "f.o.r.n.a.x", want: "****"},
+		{name: "dots and trailing punctuation", body: "f.o.r.n.a.x!", want: "****!"},
+		{name: "dashes", body: "s-h-a-r-b-e-r-t", want: "****"},
+		{name: "zero-width space", body: "forn\u200bax", want: "****"},
+		{name: "soft hyphen", body: "kerfuf\u00adfle", want: "****"},
+
+		// Leetspeak
+		{name: "digits", body: "f0rnax", want: "****"},
+		{name: "several digits", body: "k3rfuff13", want: "****"},
+		{name: "symbol inside", body: "sh@rbert", want: "****"},
+		{name: "symbol at the start", body: "$harbert", want: "****"},
+		{name: "plain numbers", body: "0 1 3 4 5 7 8 9", want: "0 1 3 4 5 7 8 9"},
+
+		// Unicode
+		{name: "accents", body: "fórnäx", want: "****"},
+		{name: "fullwidth", body: "ｆｏｒｎａｘ", want: "****"},
+		{name: "mathematical bold", body: "𝐟𝐨𝐫𝐧𝐚𝐱", want: "****"},
+		{name: "cyrillic look-alikes", body: "fоrnах", want: "****"},
+		{name: "greek look-alikes", body: "ΚΕRFUFFLΕ", want: "****"},
+		{name: "decomposed accents", body: "sharbe\u0301rt", want: "****"},
+		{name: "other scripts untouched", body: "日本語 ελληνικά", want: "日本語 ελληνικά"},
+		{name: "combined", body: "«Ｆ0.r.n.а.х»", want: "«****»"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ProfanityCheck(tc.body); got != tc.want {
+				t.Errorf("ProfanityCheck(%q): expected %q, got %q", tc.body, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckSubstringsAndAllowlist(t *testing.T) {
+	dict, err := ParseDictionary(strings.NewReader("~cunt\n~4ss\n!scunthorpe\n!Cl@ssic\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse dictionary: %s", err)
+	}
+	filter := NewFilter(dict)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "substring", body: "a massive problem", want: "a **** problem"},
+		{name: "leetspeak term", body: "grass", want: "****"},
+		{name: "allowed", body: "Scunthorpe United", want: "Scunthorpe United"},
+		{name: "allowed with punctuation", body: "(Scunthorpe!)", want: "(Scunthorpe!)"},
+		{name: "allowed look-alike", body: "SCUNTHОRPE", want: "SCUNTHОRPE"},
+		{name: "allowed leetspeak term", body: "classic", want: "classic"},
+		{name: "substring with separators", body: "c.u.n.t.s", want: "****"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := filter.Check(tc.body); got != tc.want {
+				t.Errorf("Check(%q): expected %q, got %q", tc.body, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Headers of outgoing webhooks - signed like incoming ones, so receivers can check them with a Verifier.
+// The delivery ID is the same for every attempt.
+const (
+	HeaderTimestamp = "Chirpy-Timestamp"
+	HeaderSignature = "Chirpy-Signature"
+	HeaderEvent     = "Chirpy-Event"
+	HeaderDelivery  = "Chirpy-Delivery"
+)
+
+// Used unless configured otherwise
+const (
+	DefaultMaxAttempts = 10
+	DefaultTimeout     = 10 * time.Second
+)
+
+// Retry schedule - 30s after the first failed attempt, doubling up to 6h
+const (
+	baseBackoff = 30 * time.Second
+	maxBackoff  = 6 * time.Hour
+)
+
+var ErrPrivateAddress = errors.New("webhook endpoints must be on public addresses")
+
+// Ranges net.IP has no method for - carrier-grade NAT, "this network", IETF protocol assignments and benchmarking
+var reservedNetworks = []*net.IPNet{
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// Whether an address is reachable from the internet - loopback, private, link-local (like the cloud metadata
+// service on 169.254.169.254) and other special-purpose addresses aren't
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the host of an endpoint URL when it's registered. Host names are checked again for every connection,
+// as they can resolve to a different address by then.
+func CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// Refuse connections to non-public addresses - runs after DNS resolution, so a host name rebound to an
+// internal address is caught too
+func denyPrivateAddresses(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// HTTP client that only connects to public addresses. Proxies aren't used, so the check applies to the endpoint itself.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: denyPrivateAddresses,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// Sends outgoing webhooks - any 2xx response acknowledges a delivery
+type Sender struct {
+	client *http.Client
+	now    func() time.Time
+}
+
+// Create a sender - a nil client gets a PublicClient with DefaultTimeout.
+// Redirects are never followed, so an endpoint can't bounce a delivery to another address.
+func NewSender(client *http.Client) *Sender {
+	if client == nil {
+		client = PublicClient(DefaultTimeout)
+	}
+	noRedirects := *client
+	noRedirects.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Sender{
+		client: &noRedirects,
+		now:    time.Now,
+	}
+}
+
+// POST a signed event to an endpoint. statusCode is 0 when no response was received.
+func (s *Sender) Send(ctx context.Context, url, secret, eventType, deliveryID string, body []byte) (statusCode int, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp, signature := Sign(secret, s.now(), body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signature)
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, deliveryID)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// How long to wait before the next attempt after the given number of failed attempts
+func Backoff(failedAttempts int) time.Duration {
+	if failedAttempts < 1 {
+		return 0
+	}
+	backoff := baseBackoff
+	for i := 1; i < failedAttempts; i++ {
+		backoff *= 2
+		if backoff >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	const secret = "endpoint-secret"
+	body := []byte(`{"type":"chirp.created","data":{"id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+
+	verifier, err := NewVerifier([]string{secret}, DefaultTolerance)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+
+	// The receiver fails the first delivery and accepts the second
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+		payload, _ := io.ReadAll(r.Body)
+		if err := verifier.Verify(r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), payload); err != nil {
+			t.Errorf("Receiver failed to verify the delivery: %s", err)
+		}
+		if got := r.Header.Get(HeaderEvent); got != "chirp.created" {
+			t.Errorf("Expected event header 'chirp.created', got '%s'", got)
+		}
+		if got := r.Header.Get(HeaderDelivery); got != "delivery-1" {
+			t.Errorf("Expected delivery header 'delivery-1', got '%s'", got)
+		}
+		if received == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	sender := NewSender(receiver.Client())
+
+	statusCode, err := sender.Send(context.Background(), receiver.URL, secret, "chirp.created", "delivery-1", body)
+	if err == nil || statusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected a failed delivery with status 503, got %d, error '%v'", statusCode, err)
+	}
+	statusCode, err = sender.Send(context.Background(), receiver.URL, secret, "chirp.created", "delivery-1", body)
+	if err != nil || statusCode != http.StatusNoContent {
+		t.Errorf("Expected a successful delivery with status 204, got %d, error '%v'", statusCode, err)
+	}
+
+	// Nothing listening - no status code
+	receiver.Close()
+	statusCode, err = sender.Send(context.Background(), receiver.URL, secret, "chirp.created", "delivery-1", body)
+	if err == nil || statusCode != 0 {
+		t.Errorf("Expected a failed delivery without a status, got %d, error '%v'", statusCode, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		failedAttempts int
+		want           time.Duration
+	}{
+		{failedAttempts: 0, want: 0},
+		{failedAttempts: 1, want: 30 * time.Second},
+		{failedAttempts: 2, want: time.Minute},
+		{failedAttempts: 5, want: 8 * time.Minute},
+		{failedAttempts: 10, want: 256 * time.Minute},
+		{failedAttempts: 11, want: 6 * time.Hour},
+		{failedAttempts: 100, want: 6 * time.Hour},
+	}
+	for _, tc := range tests {
+		if got := Backoff(tc.failedAttempts); got != tc.want {
+			t.Errorf("Backoff(%d): expected %s, got %s", tc.failedAttempts, tc.want, got)
+		}
+	}
+}
+
+func TestSendRefusesPrivateAddresses(t *testing.T) {
+	var received int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer receiver.Close()
+
+	// The test server listens on 127.0.0.1
+	sender := NewSender(nil)
+	statusCode, err := sender.Send(context.Background(), receiver.URL, "secret", "chirp.created", "delivery-1", []byte(`{}`))
+	if !errors.Is(err, ErrPrivateAddress) || statusCode != 0 {
+		t.Errorf("Expected error '%v' without a status, got %d, error '%v'", ErrPrivateAddress, statusCode, err)
+	}
+	if received != 0 {
+		t.Errorf("Expected no request to reach the receiver, got %d", received)
+	}
+}
+
+func TestSendDoesNotFollowRedirects(t *testing.T) {
+	var redirected int
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected++
+	}))
+	defer internal.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(internal.URL, http.StatusFound))
+	defer receiver.Close()
+
+	sender := NewSender(receiver.Client())
+	statusCode, err := sender.Send(context.Background(), receiver.URL, "secret", "chirp.created", "delivery-1", []byte(`{}`))
+	if err == nil || statusCode != http.StatusFound {
+		t.Errorf("Expected a failed delivery with status 302, got %d, error '%v'", statusCode, err)
+	}
+	if redirected != 0 {
+		t.Errorf("Expected the redirect not to be followed, got %d requests", redirected)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr error
+	}{
+		{host: "example.com"},
+		{host: "93.184.216.34"},
+		{host: "2606:2800:220:1:248:1893:25c8:1946"},
+		{host: "127.0.0.1", wantErr: ErrPrivateAddress},
+		{host: "localhost", wantErr: ErrPrivateAddress},
+		{host: "api.localhost.", wantErr: ErrPrivateAddress},
+		{host: "10.0.0.1", wantErr: ErrPrivateAddress},
+		{host: "192.168.1.1", wantErr: ErrPrivateAddress},
+		{host: "169.254.169.254", wantErr: ErrPrivateAddress},
+		{host: "100.64.0.1", wantErr: ErrPrivateAddress},
+		{host: "0.0.0.0", wantErr: ErrPrivateAddress},
+		{host: "::1", wantErr: ErrPrivateAddress},
+		{host: "fd00::1", wantErr: ErrPrivateAddress},
+		{host: "fe80::1", wantErr: ErrPrivateAddress},
+		{host: "::ffff:127.0.0.1", wantErr: ErrPrivateAddress},
+	}
+
+	for _, tc := range tests {
+		if err := CheckHost(tc.host); err != tc.wantErr {
+			t.Errorf("CheckHost(%q): expected error '%v', got '%v'", tc.host, tc.wantErr, err)
+		}
+	}
+	if IsPublicIP(net.ParseIP("172.16.5.4")) {
+		t.Error("Expected 172.16.5.4 not to be public")
+	}
+}
@@ -0,0 +1,54 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1718000000, 0)
+	body := []byte(`{"event":"user.upgraded","data":{"user_id":"3311741c-680c-4546-99f3-fc9efac2036c"}}`)
+
+	verifier, err := NewVerifier([]string{"new-secret", "old-secret"}, DefaultTolerance)
+	if err != nil {
+		t.Fatalf("Failed to create verifier: %s", err)
+	}
+	verifier.now = func() time.Time { return now }
+
+	timestamp, signature := Sign("old-secret", now, body)
+	_, otherSignature := Sign("new-secret", now, body)
+	_, wrongSignature := Sign("unknown-secret", now, body)
+	staleTimestamp, staleSignature := Sign("new-secret", now.Add(-DefaultTolerance-time.Second), body)
+
+	tests := []struct {
+		name      string
+		timestamp string
+		signature string
+		body      []byte
+		wantErr   error
+	}{
+		{name: "rotated-out secret still active", timestamp: timestamp, signature: signature, body: body},
+		{name: "several signatures", timestamp: timestamp, signature: wrongSignature + "," + otherSignature, body: body},
+		{name: "unknown secret", timestamp: timestamp, signature: wrongSignature, body: body, wantErr: ErrInvalidSignature},
+		{name: "tampered body", timestamp: timestamp, signature: signature, body: []byte(`{"event":"user.upgraded"}`), wantErr: ErrInvalidSignature},
+		{name: "signature for another timestamp", timestamp: "1718000001", signature: signature, body: body, wantErr: ErrInvalidSignature},
+		{name: "stale timestamp", timestamp: staleTimestamp, signature: staleSignature, body: body, wantErr: ErrTimestampOutOfRange},
+		{name: "invalid timestamp", timestamp: "yesterday", signature: signature, body: body, wantErr: ErrInvalidTimestamp},
+		{name: "missing signature", timestamp: timestamp, signature: "", body: body, wantErr: ErrMissingSignature},
+		{name: "unknown signature version", timestamp: timestamp, signature: "v0" + signature[2:], body: body, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := verifier.Verify(tc.timestamp, tc.signature, tc.body); err != tc.wantErr {
+				t.Errorf("Expected error '%v', got '%v'", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewVerifierWithoutSecrets(t *testing.T) {
+	if _, err := NewVerifier([]string{"", " "}, DefaultTolerance); err != ErrNoSecrets {
+		t.Errorf("Expected error '%v', got '%v'", ErrNoSecrets, err)
+	}
+}
@@ -7,11 +7,22 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/vmilasin/chirpy/internal/auth"
+	"github.com/vmilasin/chirpy/internal/billing"
 	"github.com/vmilasin/chirpy/internal/config"
 	"github.com/vmilasin/chirpy/internal/database"
+	"github.com/vmilasin/chirpy/internal/entitlements"
+	"github.com/vmilasin/chirpy/internal/mailer"
+	"github.com/vmilasin/chirpy/internal/profanity"
+	"github.com/vmilasin/chirpy/internal/webhook"
 
 	_ "github.com/lib/pq"
 )
@@ -26,16 +37,21 @@ func main() {
 	const filepathRoot = "."
 	const port = "8080"
 	// Log file paths
-	logFiles := make((map[string]string), 5)
+	logFiles := make((map[string]string), 6)
 	logFiles["systemLog"] = filepath.Join(baseDir, "logs", "system.log")
 	logFiles["handlerLog"] = filepath.Join(baseDir, "logs", "handler.log")
 	logFiles["databaseLog"] = filepath.Join(baseDir, "logs", "database.log")
 	logFiles["chirpLog"] = filepath.Join(baseDir, "logs", "chirp.log")
 	logFiles["userLog"] = filepath.Join(baseDir, "logs", "user.log")
+	logFiles["securityLog"] = filepath.Join(baseDir, "logs", "security.log")
 
 	// --debug flag drops the table at the start for development purposes
 	// WARNING: THIS DROPS ALL DATABASE ENTRIES!!!
 	dbg := flag.Bool("debug", false, "Enable debug mode")
+	// --promote-admin grants the admin role to an existing user and exits - used to bootstrap the first admin
+	promoteAdmin := flag.String("promote-admin", "", "E-mail address of the user to promote to admin")
+	// --benchmark-password-hash times password hashing with the configured argon2id parameters and exits
+	benchmarkHash := flag.Bool("benchmark-password-hash", false, "Time password hashing with the configured parameters")
 	flag.Parse()
 	if *dbg {
 		log.Print("DEBUG MODE INITIATED")
@@ -44,11 +60,21 @@ func main() {
 		dropFile(logFiles["databaseLog"])
 		dropFile(logFiles["chirpLog"])
 		dropFile(logFiles["userLog"])
+		dropFile(logFiles["securityLog"])
 	}
 
 	// Load env variables
 	// Look for .env file in the current dir
 	godotenv.Load()
+	// Password hashing parameters
+	passwordParams := auth.DefaultPasswordParams()
+	passwordParams.Memory = uint32(uintFromEnv("ARGON2_MEMORY_KIB", uint64(passwordParams.Memory), 32))
+	passwordParams.Iterations = uint32(uintFromEnv("ARGON2_ITERATIONS", uint64(passwordParams.Iterations), 32))
+	passwordParams.Parallelism = uint8(uintFromEnv("ARGON2_PARALLELISM", uint64(passwordParams.Parallelism), 8))
+	if *benchmarkHash {
+		benchmarkPasswordHash(passwordParams)
+		return
+	}
 	// Get the database connection URL
 	dbURL := os.Getenv("DB_URL")
 	// Open a connection to the DB
@@ -58,20 +84,199 @@ func main() {
 	}
 	// Create an instance of Queries with the open db connection
 	queries := database.New(db)
+
+	if *promoteAdmin != "" {
+		params := database.SetUserRoleByEmailParams{
+			Role:  auth.RoleAdmin,
+			Email: *promoteAdmin,
+		}
+		userID, err := queries.SetUserRoleByEmail(context.Background(), params)
+		if err == sql.ErrNoRows {
+			log.Fatalf("No user registered with e-mail address '%s'", *promoteAdmin)
+		}
+		if err != nil {
+			log.Fatalf("Unable to promote '%s' to admin: %v", *promoteAdmin, err)
+		}
+		log.Printf("User %s (%s) promoted to admin", userID, *promoteAdmin)
+		return
+	}
 	// Get the JWT secret
 	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
+	// Load the access token signing keys - falls back to the JWT secret when no key directory is set
+	jwtKeys, err := auth.LoadKeySet(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_SIGNING_KEY_ID"), jwtSecret)
+	if err != nil {
+		log.Fatalf("Unable to load JWT keys: %v", err)
+	}
+	// Token lifetimes, issuer, audience and allowed clock skew
+	tokenConfig := auth.DefaultTokenConfig(jwtKeys)
+	tokenConfig.AccessTokenTTL = durationFromEnv("JWT_ACCESS_TOKEN_TTL", tokenConfig.AccessTokenTTL)
+	tokenConfig.RefreshTokenTTL = durationFromEnv("REFRESH_TOKEN_TTL", tokenConfig.RefreshTokenTTL)
+	tokenConfig.ClockSkew = durationFromEnv("JWT_CLOCK_SKEW", tokenConfig.ClockSkew)
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		tokenConfig.Issuer = issuer
+	}
+	tokenConfig.Audience = os.Getenv("JWT_AUDIENCE")
 	// Get the PLATFORM value
 	platform := os.Getenv("PLATFORM")
 	// Get the key for Polka webhooks
 	polkaKey := os.Getenv("POLKA_KEY")
 	// Initialize API config
-	cfg := config.NewApiConfig(db, queries, logFiles, jwtSecret, platform, polkaKey)
+	cfg := config.NewApiConfig(db, queries, logFiles, tokenConfig, platform, polkaKey)
+	cfg.PasswordParams = passwordParams
+	// Access tokens signed with JWT_SECRET before the move to JWT_KEYS_DIR carry no kid. They're accepted until
+	// JWT_LEGACY_TOKENS_UNTIL (RFC 3339) - by default for one access token lifetime after startup, so the tokens
+	// issued before the switch run out. Unset JWT_SECRET, or set a past time, to reject them right away.
+	if os.Getenv("JWT_KEYS_DIR") != "" && len(jwtSecret) > 0 {
+		legacyUntil := time.Now().Add(tokenConfig.AccessTokenTTL)
+		if until := os.Getenv("JWT_LEGACY_TOKENS_UNTIL"); until != "" {
+			legacyUntil, err = time.Parse(time.RFC3339, until)
+			if err != nil {
+				log.Fatalf("Invalid time in JWT_LEGACY_TOKENS_UNTIL: %v", err)
+			}
+		}
+		jwtKeys.AllowLegacyTokens(legacyUntil, func(format string, args ...interface{}) {
+			output := func() {
+				log.Printf(format, args...)
+			}
+			cfg.AppLogs.LogToFile(cfg.AppLogs.SecurityLog, output)
+		})
+		log.Printf("Accepting legacy access tokens without a kid until %s", legacyUntil.Format(time.RFC3339))
+	}
+	// Signed Polka webhooks - several comma-separated secrets can be active while one is being rotated.
+	// Without secrets Polka authenticates with the static POLKA_KEY.
+	if polkaSecrets := os.Getenv("POLKA_WEBHOOK_SECRETS"); polkaSecrets != "" {
+		tolerance := durationFromEnv("POLKA_WEBHOOK_TOLERANCE", webhook.DefaultTolerance)
+		polkaVerifier, err := webhook.NewVerifier(strings.Split(polkaSecrets, ","), tolerance)
+		if err != nil {
+			log.Fatalf("Unable to configure Polka webhook verification: %v", err)
+		}
+		cfg.PaymentProviders[billing.ProviderPolka] = &billing.Polka{Verifier: polkaVerifier, APIKey: polkaKey}
+	}
+	// Stripe-compatible billing webhooks, accepted at /api/billing/stripe/webhooks
+	if stripeSecrets := os.Getenv("STRIPE_WEBHOOK_SECRETS"); stripeSecrets != "" {
+		tolerance := durationFromEnv("STRIPE_WEBHOOK_TOLERANCE", webhook.DefaultTolerance)
+		stripeVerifier, err := webhook.NewVerifier(strings.Split(stripeSecrets, ","), tolerance)
+		if err != nil {
+			log.Fatalf("Unable to configure Stripe webhook verification: %v", err)
+		}
+		cfg.PaymentProviders[billing.ProviderStripe] = &billing.Stripe{Verifier: stripeVerifier}
+	}
+	// Send e-mails through SMTP when a server is configured
+	if smtpAddr := os.Getenv("SMTP_ADDR"); smtpAddr != "" {
+		smtpMailer, err := mailer.NewSMTPMailer(smtpAddr, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), os.Getenv("MAIL_FROM"))
+		if err != nil {
+			log.Fatalf("Unable to configure the SMTP mailer: %v", err)
+		}
+		cfg.Mailer = smtpMailer
+	}
+
+	cfg.AccountDeletionGracePeriod = durationFromEnv("ACCOUNT_DELETION_GRACE_PERIOD", cfg.AccountDeletionGracePeriod)
+	cfg.DataExportDir = filepath.Join(baseDir, "exports")
+	if exportDir := os.Getenv("DATA_EXPORT_DIR"); exportDir != "" {
+		cfg.DataExportDir = exportDir
+	}
+	cfg.DataExportLinkTTL = durationFromEnv("DATA_EXPORT_LINK_TTL", cfg.DataExportLinkTTL)
+	cfg.SubscriptionPeriod = durationFromEnv("SUBSCRIPTION_PERIOD", cfg.SubscriptionPeriod)
+	cfg.WebhookMaxAttempts = int(uintFromEnv("WEBHOOK_MAX_ATTEMPTS", uint64(cfg.WebhookMaxAttempts), 16))
+	// Per-plan limits can be replaced with a JSON file
+	if entitlementsFile := os.Getenv("ENTITLEMENTS_FILE"); entitlementsFile != "" {
+		cfg.Plans, err = entitlements.LoadPlans(entitlementsFile)
+		if err != nil {
+			log.Fatalf("Unable to load plan entitlements: %v", err)
+		}
+	}
+	// Profanity dictionaries, one file per language - the built-in one is used when the directory doesn't exist
+	profanityDir := filepath.Join(baseDir, "profanity")
+	if dir := os.Getenv("PROFANITY_DIR"); dir != "" {
+		profanityDir = dir
+	}
+	if _, err := os.Stat(profanityDir); err == nil {
+		cfg.Profanity, err = profanity.LoadDir(profanityDir)
+		if err != nil {
+			log.Fatalf("Unable to load profanity dictionaries: %v", err)
+		}
+	} else {
+		log.Printf("No profanity dictionaries in %s, using the built-in one", profanityDir)
+	}
+	profanityReloadInterval := durationFromEnv("PROFANITY_RELOAD_INTERVAL", 30*time.Second)
 
 	if *dbg {
 		cfg.Queries.TruncateAllTables(context.Background())
 		log.Print("ALL DATABASE TABLES TRUNCATED")
 	}
 
+	// Periodically drop stale failed login records
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			cfg.LoginThrottle.Prune()
+		}
+	}()
+
+	// Delete accounts once their deletion grace period has passed and expired data exports, fail interrupted data
+	// exports, expire lapsed subscriptions and drop old dispatched and dead domain events
+	go func() {
+		cfg.FailStaleDataExports(context.Background())
+		for range time.Tick(1 * time.Hour) {
+			cfg.PurgeDeletedAccounts(context.Background())
+			cfg.PurgeExpiredDataExports(context.Background())
+			cfg.FailStaleDataExports(context.Background())
+			cfg.ExpireLapsedSubscriptions(context.Background())
+			cfg.PurgeDomainEvents(context.Background())
+		}
+	}()
+
+	// Hand recorded domain events to their subscribers - right after a transaction records them, and
+	// periodically for retries
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		for {
+			select {
+			case <-ticker.C:
+			case <-cfg.DomainEventsRecorded:
+			}
+			cfg.DispatchDomainEvents(context.Background())
+		}
+	}()
+
+	// Publish scheduled chirps when their time comes
+	go func() {
+		for range time.Tick(1 * time.Minute) {
+			cfg.PublishScheduledChirps(context.Background())
+		}
+	}()
+
+	// Send queued webhook deliveries
+	go func() {
+		for range time.Tick(10 * time.Second) {
+			cfg.DeliverWebhooks(context.Background())
+		}
+	}()
+
+	// Reload the profanity dictionaries when they change on disk
+	go cfg.Profanity.Watch(profanityReloadInterval, func(err error) {
+		if err != nil {
+			log.Printf("Failed to reload profanity dictionaries, keeping the current ones: %v", err)
+			return
+		}
+		log.Printf("Profanity dictionaries reloaded: %v", cfg.Profanity.Languages())
+	})
+
+	// Reload the JWT keys and profanity dictionaries on SIGHUP, so they can be changed without a restart
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			if err := cfg.Profanity.Reload(); err != nil {
+				log.Printf("Failed to reload profanity dictionaries, keeping the current ones: %v", err)
+			}
+			if err := cfg.TokenConfig.Keys.Reload(); err != nil {
+				log.Printf("Failed to reload JWT keys, keeping the current ones: %v", err)
+				continue
+			}
+			log.Print("JWT keys reloaded")
+		}
+	}()
+
 	// ServeMux is an HTTP request router
 	mux := http.NewServeMux()
 
@@ -82,24 +287,74 @@ func main() {
 	mux.Handle("/app/*", cfg.MiddlewareMetricsInc(http.StripPrefix("/app", fileserver)))
 
 	mux.HandleFunc("GET /api/healthz", cfg.HandlerReadiness)
-	mux.HandleFunc("GET /admin/metrics", cfg.HandlerMetrics)
-	mux.HandleFunc("POST /admin/reset", cfg.HandlerDBReset)
-	mux.HandleFunc("GET /api/reset", cfg.HandlerMetricsReset)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.HandlerJWKS)
+	mux.Handle("GET /admin/metrics", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerMetrics)))
+	mux.Handle("POST /admin/reset", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerDBReset)))
+	mux.Handle("POST /admin/profanity/reload", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerProfanityReload)))
+	mux.Handle("GET /api/reset", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerMetricsReset)))
+	mux.Handle("GET /admin/webhooks/events", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerAdminWebhookEventsGetAll)))
+	mux.Handle("POST /admin/webhooks/events/{eventID}/replay", cfg.AdminMiddleware(http.HandlerFunc(cfg.HandlerAdminWebhookEventReplay)))
 
-	mux.HandleFunc("GET /api/chirps", cfg.HandlerChirpsGetAll)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.HandlerChirpsGetByID)
+	mux.Handle("GET /api/chirps", cfg.OptionalAuthTokenMiddleware(http.HandlerFunc(cfg.HandlerChirpsGetAll)))
+	mux.Handle("GET /api/chirps/{chirpID}", cfg.OptionalAuthTokenMiddleware(http.HandlerFunc(cfg.HandlerChirpsGetByID)))
 
 	mux.HandleFunc("POST /api/users", cfg.HandlerUserRegistration)
 	mux.HandleFunc("POST /api/login", cfg.HandlerUserLogin)
 
 	mux.Handle("POST /api/chirps", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerChirpsCreate)))
+	mux.Handle("PUT /api/chirps/{chirpID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerChirpsUpdate)))
 	mux.Handle("DELETE /api/chirps/{chirpID}", cfg.AuthTokenMiddleware((http.HandlerFunc(cfg.HandlerChirpsDelete))))
+	mux.Handle("POST /api/chirps/scheduled", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerScheduledChirpsCreate)))
+	mux.Handle("GET /api/chirps/scheduled", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerScheduledChirpsGetAll)))
+	mux.Handle("DELETE /api/chirps/scheduled/{scheduledID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerScheduledChirpsDelete)))
+	mux.Handle("GET /api/users/me/entitlements", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerEntitlementsGet)))
 	mux.Handle("PUT /api/users", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserUpdate)))
+	mux.HandleFunc("POST /api/users/email/confirm", cfg.HandlerUserEmailConfirm)
+	mux.Handle("DELETE /api/users", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserDelete)))
+	mux.Handle("POST /api/users/me/export", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerDataExportCreate)))
+	mux.Handle("GET /api/users/me/export/{exportID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerDataExportGet)))
+	mux.HandleFunc("GET /api/exports/{token}", cfg.HandlerDataExportDownload)
+	mux.Handle("GET /api/users/me/subscription", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerSubscriptionGet)))
+
+	mux.Handle("POST /api/users/{userID}/block", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserBlock)))
+	mux.Handle("DELETE /api/users/{userID}/block", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserUnblock)))
+	mux.Handle("GET /api/blocks", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserBlocksGetAll)))
+	mux.Handle("POST /api/users/{userID}/mute", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserMute)))
+	mux.Handle("DELETE /api/users/{userID}/mute", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserUnmute)))
+	mux.Handle("GET /api/mutes", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerUserMutesGetAll)))
+
+	mux.Handle("POST /api/conversations", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerConversationsCreate)))
+	mux.Handle("GET /api/conversations", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerConversationsGetAll)))
+	mux.Handle("POST /api/conversations/{conversationID}/messages", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerMessagesCreate)))
+	mux.Handle("GET /api/conversations/{conversationID}/messages", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerMessagesGetAll)))
+	mux.Handle("POST /api/conversations/{conversationID}/read", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerConversationRead)))
+	mux.Handle("GET /api/messages/unread", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerMessagesUnread)))
+
+	mux.Handle("POST /api/webhooks", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerWebhookEndpointsCreate)))
+	mux.Handle("GET /api/webhooks", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerWebhookEndpointsGetAll)))
+	mux.Handle("DELETE /api/webhooks/{endpointID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerWebhookEndpointsDelete)))
+	mux.Handle("GET /api/webhooks/{endpointID}/deliveries", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerWebhookDeliveriesGetAll)))
+	mux.Handle("POST /api/webhooks/{endpointID}/deliveries/{deliveryID}/retry", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerWebhookDeliveryRetry)))
 
 	mux.Handle("POST /api/refresh", cfg.RefreshTokenMiddleware(http.HandlerFunc(cfg.HandlerRefreshTokenRefresh)))
 	mux.Handle("POST /api/revoke", cfg.RefreshTokenMiddleware(http.HandlerFunc(cfg.HandlerRefreshTokenRevoke)))
 
-	mux.Handle("POST /api/polka/webhooks", cfg.PolkaMiddleware(http.HandlerFunc(cfg.HandlerWebhooksPolkaEnableChirpyRed)))
+	mux.Handle("GET /api/sessions", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerSessionsGetAll)))
+	mux.Handle("DELETE /api/sessions/{sessionID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerSessionsDelete)))
+	mux.Handle("POST /api/sessions/revoke-others", cfg.RefreshTokenMiddleware(http.HandlerFunc(cfg.HandlerSessionsRevokeOthers)))
+
+	mux.Handle("POST /api/tokens", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerPersonalAccessTokensCreate)))
+	mux.Handle("GET /api/tokens", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerPersonalAccessTokensGetAll)))
+	mux.Handle("DELETE /api/tokens/{tokenID}", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerPersonalAccessTokensDelete)))
+
+	mux.Handle("POST /api/oauth/clients", cfg.AuthTokenMiddleware(http.HandlerFunc(cfg.HandlerOAuthClientsCreate)))
+	mux.HandleFunc("GET /oauth/authorize", cfg.HandlerOAuthAuthorize)
+	mux.HandleFunc("POST /oauth/authorize", cfg.HandlerOAuthAuthorizeDecision)
+	mux.HandleFunc("POST /oauth/token", cfg.HandlerOAuthToken)
+	mux.HandleFunc("POST /oauth/revoke", cfg.HandlerOAuthRevoke)
+
+	mux.Handle("POST /api/billing/{provider}/webhooks", cfg.PaymentProviderMiddleware(http.HandlerFunc(cfg.HandlerBillingWebhooks)))
+	mux.Handle("POST /api/polka/webhooks", cfg.PaymentProviderMiddleware(http.HandlerFunc(cfg.HandlerBillingWebhooks)))
 
 	// Server parameters
 	server := &http.Server{
@@ -126,3 +381,43 @@ func dropFile(path string) {
 		log.Printf("DEBUG: No old file with path %s to remove", path)
 	}
 }
+
+// Read a duration (e.g. "90m", "720h") from an env variable, falling back to a default
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid duration in %s: %v", name, err)
+	}
+	return duration
+}
+
+// Read an unsigned integer of the given bit size from an env variable, falling back to a default
+func uintFromEnv(name string, fallback uint64, bitSize int) uint64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	number, err := strconv.ParseUint(value, 10, bitSize)
+	if err != nil || number == 0 {
+		log.Fatalf("Invalid value in %s: %s", name, value)
+	}
+	return number
+}
+
+// Hash a password a few times and report how long it takes - aim for well under a second per login
+func benchmarkPasswordHash(params *auth.PasswordParams) {
+	const rounds = 5
+	log.Printf("Hashing with argon2id m=%d KiB, t=%d, p=%d", params.Memory, params.Iterations, params.Parallelism)
+
+	start := time.Now()
+	for i := 0; i < rounds; i++ {
+		if _, err := auth.CreatePasswordHash("chirpy-benchmark-password", params); err != nil {
+			log.Fatalf("Password hashing failed: %v", err)
+		}
+	}
+	log.Printf("Average time per hash: %s", (time.Since(start) / rounds).Round(time.Millisecond))
+}
@@ -1,6 +1,6 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (user_id, body)
-VALUES ($1, $2)
+INSERT INTO chirps (user_id, body, media_urls)
+VALUES ($1, $2, $3)
 RETURNING *;
 
 -- name: GetChirpAll :many
@@ -9,7 +9,8 @@ SELECT
     body AS "body", --json:"body"
     user_id AS "user_id", --json:"user_id"
     created_at AS "created_at", --json:"created_at"
-    updated_at AS "updated_at" --json:"updated_at"
+    updated_at AS "updated_at", --json:"updated_at"
+    media_urls AS "media_urls" --json:"media_urls"
 FROM chirps
 ORDER BY 
     CASE WHEN $1 THEN created_at END DESC,
@@ -21,7 +22,8 @@ SELECT
     body AS "body", --json:"body"
     user_id AS "user_id", --json:"user_id"
     created_at AS "created_at", --json:"created_at"
-    updated_at AS "updated_at" --json:"updated_at"
+    updated_at AS "updated_at", --json:"updated_at"
+    media_urls AS "media_urls" --json:"media_urls"
 FROM chirps
 WHERE user_id = $1
 ORDER BY 
@@ -34,6 +36,83 @@ SELECT *
 FROM chirps
 WHERE id = $1;
 
+-- name: GetChirpByIDForViewer :one
+-- A chirp is hidden from a signed-in viewer if either of them blocked the other
+SELECT c.*
+FROM chirps c
+WHERE c.id = sqlc.arg(id)
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = sqlc.arg(viewer_id) AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = sqlc.arg(viewer_id))
+    );
+
 -- name: DeleteChirp :exec
 DELETE FROM chirps 
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: GetChirpAllForViewer :many
+SELECT
+    c.id AS "id", --json:"id"
+    c.body AS "body", --json:"body"
+    c.user_id AS "user_id", --json:"user_id"
+    c.created_at AS "created_at", --json:"created_at"
+    c.updated_at AS "updated_at", --json:"updated_at"
+    c.media_urls AS "media_urls" --json:"media_urls"
+FROM chirps c
+WHERE NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = sqlc.arg(viewer_id) AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = sqlc.arg(viewer_id))
+    )
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_mutes m
+        WHERE m.muter_id = sqlc.arg(viewer_id) AND m.muted_id = c.user_id
+    )
+ORDER BY
+    CASE WHEN sqlc.arg(sort_desc)::BOOLEAN THEN c.created_at END DESC,
+    CASE WHEN NOT sqlc.arg(sort_desc)::BOOLEAN THEN c.created_at END ASC;
+
+-- name: GetChirpsFromAuthorForViewer :many
+SELECT
+    c.id AS "id", --json:"id"
+    c.body AS "body", --json:"body"
+    c.user_id AS "user_id", --json:"user_id"
+    c.created_at AS "created_at", --json:"created_at"
+    c.updated_at AS "updated_at", --json:"updated_at"
+    c.media_urls AS "media_urls" --json:"media_urls"
+FROM chirps c
+WHERE c.user_id = sqlc.arg(author_id)
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_blocks b
+        WHERE (b.blocker_id = sqlc.arg(viewer_id) AND b.blocked_id = c.user_id)
+           OR (b.blocker_id = c.user_id AND b.blocked_id = sqlc.arg(viewer_id))
+    )
+    AND NOT EXISTS (
+        SELECT 1
+        FROM user_mutes m
+        WHERE m.muter_id = sqlc.arg(viewer_id) AND m.muted_id = c.user_id
+    )
+ORDER BY
+    CASE WHEN sqlc.arg(sort_desc)::BOOLEAN THEN c.created_at END DESC,
+    CASE WHEN NOT sqlc.arg(sort_desc)::BOOLEAN THEN c.created_at END ASC;
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET
+    body = $1,
+    updated_at = NOW()
+WHERE id = $2
+RETURNING *;
+
+-- name: GetChirpRateWindow :one
+-- How many chirps a user posted since a point in time, and when the oldest of them was posted
+SELECT
+    COUNT(*) AS chirp_count,
+    COALESCE(MIN(created_at), NOW())::TIMESTAMP AS oldest_created_at
+FROM chirps
+WHERE user_id = $1 AND created_at > $2;
\ No newline at end of file
@@ -0,0 +1,62 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (user_a, user_b)
+VALUES ($1, $2)
+ON CONFLICT (user_a, user_b) DO NOTHING
+RETURNING *;
+
+-- name: GetConversationBetween :one
+SELECT *
+FROM conversations
+WHERE user_a = $1 AND user_b = $2;
+
+-- name: GetConversationForUser :one
+SELECT *
+FROM conversations
+WHERE id = sqlc.arg(id) AND (user_a = sqlc.arg(user_id) OR user_b = sqlc.arg(user_id));
+
+-- name: GetConversationsForUser :many
+SELECT
+    c.id,
+    (CASE WHEN c.user_a = sqlc.arg(user_id) THEN c.user_b ELSE c.user_a END)::UUID AS other_user_id,
+    c.created_at,
+    c.last_message_at,
+    (
+        SELECT COUNT(*)
+        FROM messages m
+        WHERE m.conversation_id = c.id AND m.sender_id <> sqlc.arg(user_id) AND m.read_at IS NULL
+    ) AS unread_count
+FROM conversations c
+WHERE c.user_a = sqlc.arg(user_id) OR c.user_b = sqlc.arg(user_id)
+ORDER BY COALESCE(c.last_message_at, c.created_at) DESC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET last_message_at = $2
+WHERE id = $1;
+
+-- name: CreateMessage :one
+INSERT INTO messages (conversation_id, sender_id, body)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetMessages :many
+-- Messages older than the (created_at, id) cursor, newest first - the id breaks ties between messages sent at the same time
+SELECT *
+FROM messages
+WHERE conversation_id = sqlc.arg(conversation_id)
+    AND (created_at, id) < (sqlc.arg(before_created_at)::TIMESTAMP, sqlc.arg(before_id)::UUID)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(max_messages);
+
+-- name: MarkConversationRead :execrows
+UPDATE messages
+SET read_at = NOW()
+WHERE conversation_id = sqlc.arg(conversation_id) AND sender_id <> sqlc.arg(reader_id) AND read_at IS NULL;
+
+-- name: GetUnreadMessageCount :one
+SELECT COUNT(*)
+FROM messages m
+JOIN conversations c ON c.id = m.conversation_id
+WHERE (c.user_a = sqlc.arg(user_id) OR c.user_b = sqlc.arg(user_id))
+    AND m.sender_id <> sqlc.arg(user_id)
+    AND m.read_at IS NULL;
\ No newline at end of file
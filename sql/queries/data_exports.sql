@@ -0,0 +1,50 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (user_id, download_token_hash, expires_at)
+VALUES ($1, $2, $3)
+RETURNING id, status, created_at, expires_at;
+
+-- name: GetPendingDataExportForUser :one
+-- Exports started before the cutoff were interrupted - they don't hold up a new one
+SELECT id
+FROM data_exports
+WHERE user_id = $1 AND status = 'pending' AND created_at > sqlc.arg(started_after)
+LIMIT 1;
+
+-- name: GetDataExportForUser :one
+SELECT id, status, created_at, completed_at, expires_at
+FROM data_exports
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDataExportByTokenHash :one
+SELECT id, user_id, status, file_path, expires_at
+FROM data_exports
+WHERE download_token_hash = $1;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports
+SET
+    status = 'ready',
+    file_path = $2,
+    completed_at = CURRENT_TIMESTAMP,
+    expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports
+SET
+    status = 'failed',
+    completed_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: FailStaleDataExports :execrows
+-- Exports still pending after the export timeout were interrupted by a restart or crash
+UPDATE data_exports
+SET
+    status = 'failed',
+    completed_at = CURRENT_TIMESTAMP
+WHERE status = 'pending' AND created_at <= sqlc.arg(started_before);
+
+-- name: DeleteExpiredDataExports :many
+DELETE FROM data_exports
+WHERE expires_at <= NOW()
+RETURNING file_path;
\ No newline at end of file
@@ -1,2 +1,2 @@
 -- name: TruncateAllTables :exec
-TRUNCATE TABLE users, chirps, refresh_tokens;
\ No newline at end of file
+TRUNCATE TABLE users, chirps, refresh_tokens, personal_access_tokens, oauth_clients, oauth_authorization_codes, oauth_refresh_tokens, data_exports, email_change_requests, user_blocks, user_mutes, conversations, messages, webhook_events, subscriptions, scheduled_chirps, webhook_endpoints, webhook_deliveries, domain_events;
\ No newline at end of file
@@ -0,0 +1,63 @@
+-- name: CreateDomainEvent :exec
+INSERT INTO domain_events (aggregate_type, aggregate_id, event_type, payload)
+VALUES ($1, $2, $3, $4);
+
+-- name: ClaimDomainEvents :many
+-- Lease the oldest undispatched event of each aggregate whose turn it is - later events of an aggregate
+-- wait until the ones before them are dispatched or dead
+UPDATE domain_events
+SET
+    next_attempt_at = sqlc.arg(leased_until)
+WHERE id IN (
+    SELECT e.id
+    FROM domain_events e
+    WHERE e.dispatched_at IS NULL
+        AND e.dead_at IS NULL
+        AND e.next_attempt_at <= NOW()
+        AND NOT EXISTS (
+            SELECT 1
+            FROM domain_events earlier
+            WHERE earlier.aggregate_type = e.aggregate_type
+                AND earlier.aggregate_id = e.aggregate_id
+                AND earlier.dispatched_at IS NULL
+                AND earlier.dead_at IS NULL
+                AND earlier.sequence < e.sequence
+        )
+    ORDER BY e.sequence
+    LIMIT sqlc.arg(max_events)
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: MarkDomainEventDispatched :exec
+UPDATE domain_events
+SET
+    attempts = attempts + 1,
+    last_error = NULL,
+    dispatched_at = NOW()
+WHERE id = $1;
+
+-- name: MarkDomainEventDead :exec
+-- Give up on an event that ran out of attempts
+UPDATE domain_events
+SET
+    attempts = attempts + 1,
+    last_error = $2,
+    dead_at = NOW()
+WHERE id = $1;
+
+-- name: RecordDomainEventFailure :exec
+UPDATE domain_events
+SET
+    attempts = attempts + 1,
+    last_error = $2,
+    next_attempt_at = $3
+WHERE id = $1;
+
+-- name: DeleteDeadDomainEvents :execrows
+DELETE FROM domain_events
+WHERE dead_at < $1;
+
+-- name: DeleteDispatchedDomainEvents :execrows
+DELETE FROM domain_events
+WHERE dispatched_at < $1;
\ No newline at end of file
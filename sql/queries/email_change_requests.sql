@@ -0,0 +1,15 @@
+-- name: CreateEmailChangeRequest :one
+INSERT INTO email_change_requests (user_id, new_email, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+RETURNING id, expires_at;
+
+-- name: DeletePendingEmailChangeRequests :exec
+DELETE FROM email_change_requests
+WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: ConfirmEmailChangeRequest :one
+UPDATE email_change_requests
+SET
+    confirmed_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND confirmed_at IS NULL AND expires_at > NOW()
+RETURNING user_id, new_email;
\ No newline at end of file
@@ -0,0 +1,41 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, owner_id)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, name, redirect_uris, created_at;
+
+-- name: GetOAuthClient :one
+SELECT id, secret_hash, name, redirect_uris
+FROM oauth_clients
+WHERE id = $1;
+
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8);
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes
+SET
+    used_at = CURRENT_TIMESTAMP
+WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+RETURNING client_id, user_id, redirect_uri, scopes, code_challenge, code_challenge_method;
+
+-- name: CreateOAuthRefreshToken :exec
+INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5);
+
+-- name: GetOAuthRefreshToken :one
+SELECT id, client_id, user_id, scopes, expires_at, revoked_at
+FROM oauth_refresh_tokens
+WHERE token_hash = $1;
+
+-- name: RevokeOAuthRefreshToken :execrows
+UPDATE oauth_refresh_tokens
+SET
+    revoked_at = CURRENT_TIMESTAMP
+WHERE token_hash = $1 AND client_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllOAuthRefreshTokensForUser :exec
+UPDATE oauth_refresh_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE user_id = $1;
\ No newline at end of file
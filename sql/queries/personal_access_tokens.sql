@@ -0,0 +1,33 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, name, scopes, created_at, expires_at;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT id, user_id, scopes, expires_at, revoked_at
+FROM personal_access_tokens
+WHERE token_hash = $1;
+
+-- name: GetPersonalAccessTokensForUser :many
+SELECT id, name, scopes, created_at, expires_at, last_used_at
+FROM personal_access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL
+ORDER BY created_at DESC;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens
+SET
+    last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens
+SET
+    revoked_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllPersonalAccessTokensForUser :exec
+UPDATE personal_access_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE user_id = $1;
\ No newline at end of file
@@ -1,7 +1,15 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (user_id, refresh_token, expires_at)
-VALUES ($1, $2, $3)
-RETURNING refresh_token;
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip_address, family_id, parent_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING id;
+
+-- name: CreateRotatedRefreshToken :one
+-- The successor of a rotated token continues its session - it keeps the family and the sign-in time, and was just used
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at, user_agent, ip_address, family_id, parent_id, created_at, last_used_at)
+SELECT user_id, sqlc.arg(token_hash), sqlc.arg(expires_at), sqlc.arg(user_agent), sqlc.arg(ip_address), family_id, id, created_at, CURRENT_TIMESTAMP
+FROM refresh_tokens
+WHERE id = sqlc.arg(parent_id)
+RETURNING id;
 
 -- name: GetRefreshTokenForUser :one
 SELECT *
@@ -9,12 +17,51 @@ FROM refresh_tokens
 WHERE user_id = $1 and revoked_at IS NULL;
 
 -- name: CheckRefreshTokenValidity :one
-SELECT revoked_at, user_id
+SELECT id, revoked_at, user_id, expires_at, family_id, rotated_at, user_agent
 FROM refresh_tokens
-where refresh_token =$1;
+where token_hash =$1;
 
 -- name: RevokeRefreshToken :exec
 UPDATE refresh_tokens
 SET
     revoked_at = CURRENT_TIMESTAMP
-WHERE refresh_token =$1;
\ No newline at end of file
+WHERE token_hash =$1;
+
+-- name: RotateRefreshToken :execrows
+UPDATE refresh_tokens
+SET
+    rotated_at = CURRENT_TIMESTAMP,
+    revoked_at = CURRENT_TIMESTAMP,
+    last_used_at = CURRENT_TIMESTAMP
+WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE family_id = $1;
+
+-- name: GetSessionsForUser :many
+SELECT family_id, user_agent, ip_address, created_at, last_used_at, expires_at
+FROM refresh_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+ORDER BY COALESCE(last_used_at, created_at) DESC;
+
+-- name: GetSessionForUser :one
+-- A session is a refresh token family - its newest token tells whether the session is still active
+SELECT revoked_at
+FROM refresh_tokens
+WHERE family_id = $1 AND user_id = $2
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: GetOtherActiveRefreshTokens :many
+SELECT token_hash
+FROM refresh_tokens
+WHERE user_id = $1 AND token_hash <> $2 AND revoked_at IS NULL;
+
+-- name: RevokeAllRefreshTokensForUser :exec
+UPDATE refresh_tokens
+SET
+    revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP)
+WHERE user_id = $1;
\ No newline at end of file
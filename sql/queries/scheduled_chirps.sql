@@ -0,0 +1,30 @@
+-- name: CreateScheduledChirp :one
+INSERT INTO scheduled_chirps (user_id, body, media_urls, publish_at)
+VALUES ($1, $2, $3, $4)
+RETURNING *;
+
+-- name: GetScheduledChirpsForUser :many
+SELECT *
+FROM scheduled_chirps
+WHERE user_id = $1
+ORDER BY publish_at;
+
+-- name: CountScheduledChirpsForUser :one
+SELECT COUNT(*)
+FROM scheduled_chirps
+WHERE user_id = $1;
+
+-- name: DeleteScheduledChirp :execrows
+DELETE FROM scheduled_chirps
+WHERE id = $1 AND user_id = $2;
+
+-- name: PublishDueScheduledChirps :many
+WITH due AS (
+    DELETE FROM scheduled_chirps
+    WHERE publish_at <= NOW()
+    RETURNING user_id, body, media_urls, publish_at
+)
+INSERT INTO chirps (user_id, body, media_urls, created_at, updated_at)
+SELECT user_id, body, media_urls, publish_at, publish_at
+FROM due
+RETURNING *;
\ No newline at end of file
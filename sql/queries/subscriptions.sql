@@ -0,0 +1,50 @@
+-- name: ActivateSubscription :one
+INSERT INTO subscriptions (user_id, plan, status, current_period_start, current_period_end)
+VALUES ($1, $2, 'active', $3, $4)
+ON CONFLICT (user_id) DO UPDATE
+SET
+    plan = EXCLUDED.plan,
+    status = 'active',
+    current_period_start = EXCLUDED.current_period_start,
+    current_period_end = EXCLUDED.current_period_end,
+    cancelled_at = NULL,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: GetSubscriptionByUser :one
+SELECT *
+FROM subscriptions
+WHERE user_id = $1;
+
+-- name: CancelSubscription :one
+UPDATE subscriptions
+SET
+    status = 'cancelled',
+    cancelled_at = NOW(),
+    updated_at = NOW()
+WHERE user_id = $1 AND status = 'active'
+RETURNING *;
+
+-- name: ExpireSubscription :one
+UPDATE subscriptions
+SET
+    status = 'expired',
+    current_period_end = LEAST(current_period_end, NOW()),
+    updated_at = NOW()
+WHERE user_id = $1 AND status <> 'expired'
+RETURNING *;
+
+-- name: ExpireLapsedSubscriptions :many
+UPDATE subscriptions
+SET
+    status = 'expired',
+    updated_at = NOW()
+WHERE status IN ('active', 'cancelled') AND current_period_end <= NOW()
+RETURNING user_id;
+
+-- name: GetActiveSubscriptionPlan :one
+SELECT plan
+FROM subscriptions
+WHERE user_id = $1
+    AND status IN ('active', 'cancelled')
+    AND current_period_end > NOW();
\ No newline at end of file
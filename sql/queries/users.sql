@@ -1,7 +1,7 @@
 -- name: CreateUser :one
 INSERT INTO users (email, password_hash)
 VALUES ($1, $2)
-RETURNING id, email, created_at, updated_at, is_chirpy_red;
+RETURNING id, email, created_at, updated_at;
 
 -- name: GetUserByID :one
 SELECT id, email, password_hash
@@ -18,22 +18,64 @@ SELECT password_hash
 FROM users
 WHERE id = $1;
 
--- name: UpdateUser :one
+-- name: CheckChirpyRed :one
+SELECT EXISTS (
+    SELECT 1
+    FROM subscriptions
+    WHERE user_id = $1
+        AND status IN ('active', 'cancelled')
+        AND current_period_end > NOW()
+);
+
+-- name: GetUserRole :one
+SELECT role
+FROM users
+WHERE id = $1;
+
+-- name: SetUserRoleByEmail :one
 UPDATE users
 SET
-    email = COALESCE(NULLIF($1, ''), email),  -- If email is provided, update it, otherwise keep the existing value
-    password_hash = COALESCE($2::BYTEA, password_hash)  -- If password is provided, update it, otherwise keep the existing value
-WHERE id = $3
-RETURNING id, email;
+    role = $1
+WHERE email = $2
+RETURNING id;
 
--- name: EnableChirpyRed :one
+-- name: ScheduleUserDeletion :one
 UPDATE users
 SET
-    is_chirpy_red = TRUE
-WHERE id = $1
+    deletion_scheduled_at = $1
+WHERE id = $2
+RETURNING deletion_scheduled_at;
+
+-- name: CancelUserDeletion :execrows
+UPDATE users
+SET
+    deletion_scheduled_at = NULL
+WHERE id = $1 AND deletion_scheduled_at IS NOT NULL;
+
+-- name: DeleteUsersScheduledForDeletion :many
+DELETE FROM users
+WHERE deletion_scheduled_at <= $1
 RETURNING id;
 
--- name: CheckChirpyRed :one
-SELECT is_chirpy_red
+-- name: UpdatePasswordHash :exec
+UPDATE users
+SET
+    password_hash = $1
+WHERE id = $2;
+
+-- name: UpdateUserEmail :exec
+UPDATE users
+SET
+    email = $1
+WHERE id = $2;
+
+-- name: GetUserProfanityFilter :one
+SELECT profanity_filter
 FROM users
-WHERE id = $1;
\ No newline at end of file
+WHERE id = $1;
+
+-- name: UpdateUserProfanityFilter :exec
+UPDATE users
+SET
+    profanity_filter = $1
+WHERE id = $2;
\ No newline at end of file
@@ -0,0 +1,76 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (user_id, url, secret, event_types, all_users)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING *;
+
+-- name: GetWebhookEndpointsForUser :many
+SELECT *
+FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: GetWebhookEndpointForUser :one
+SELECT *
+FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :execrows
+-- One delivery for every endpoint subscribed to the event - the owner's, and admins' endpoints for all users
+INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+SELECT e.id, sqlc.arg(event_id), sqlc.arg(event_type), sqlc.arg(payload)
+FROM webhook_endpoints e
+WHERE sqlc.arg(event_type) = ANY(e.event_types)
+    AND (e.user_id = sqlc.arg(user_id) OR e.all_users)
+ON CONFLICT (endpoint_id, event_id) DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+-- Lease due deliveries to one dispatcher - pushing next_attempt_at forward keeps other dispatchers away,
+-- and lets the delivery be picked up again if this one dies mid-attempt
+UPDATE webhook_deliveries d
+SET
+    next_attempt_at = sqlc.arg(leased_until)
+FROM webhook_endpoints e
+WHERE e.id = d.endpoint_id
+    AND d.id IN (
+        SELECT id
+        FROM webhook_deliveries
+        WHERE status = 'pending' AND next_attempt_at <= NOW()
+        ORDER BY next_attempt_at
+        LIMIT sqlc.arg(max_deliveries)
+        FOR UPDATE SKIP LOCKED
+    )
+RETURNING d.id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: RecordWebhookDeliveryAttempt :exec
+UPDATE webhook_deliveries
+SET
+    status = $2,
+    attempts = attempts + 1,
+    next_attempt_at = $3,
+    last_attempt_at = NOW(),
+    last_status_code = $4,
+    last_error = $5,
+    delivered_at = CASE WHEN $2 = 'delivered' THEN NOW() ELSE NULL END
+WHERE id = $1;
+
+-- name: GetWebhookDeliveriesForEndpoint :many
+SELECT *
+FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg(endpoint_id)
+    AND (sqlc.narg(status)::TEXT IS NULL OR status = sqlc.narg(status))
+ORDER BY created_at DESC
+LIMIT sqlc.arg(max_deliveries);
+
+-- name: RetryDeadWebhookDelivery :one
+-- Give a dead delivery a fresh set of attempts
+UPDATE webhook_deliveries
+SET
+    status = 'pending',
+    attempts = 0,
+    next_attempt_at = NOW()
+WHERE id = $1 AND endpoint_id = $2 AND status = 'dead'
+RETURNING *;
\ No newline at end of file
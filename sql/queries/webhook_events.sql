@@ -0,0 +1,49 @@
+-- name: ClaimWebhookEvent :one
+-- Take up an event again - one that failed, or one whose processing was interrupted before its outcome was recorded
+UPDATE webhook_events
+SET
+    status = 'processing',
+    attempts = attempts + 1,
+    error = NULL,
+    claimed_at = NOW()
+WHERE id = sqlc.arg(id)
+    AND (status = 'failed' OR (status = 'processing' AND claimed_at < sqlc.arg(stale_before)))
+RETURNING *;
+
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (provider, event_id, event_type, payload)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (provider, event_id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT *
+FROM webhook_events
+WHERE provider = $1 AND event_id = $2;
+
+-- name: GetWebhookEventByID :one
+SELECT *
+FROM webhook_events
+WHERE id = $1;
+
+-- name: FinishWebhookEvent :exec
+UPDATE webhook_events
+SET
+    status = $2,
+    error = $3,
+    processed_at = NOW()
+WHERE id = $1;
+
+-- name: ListWebhookEvents :many
+SELECT *
+FROM webhook_events
+WHERE sqlc.narg(status)::TEXT IS NULL OR status = sqlc.narg(status)
+ORDER BY received_at DESC
+LIMIT sqlc.arg(max_events);
+
+-- name: RetireWebhookEventID :execrows
+-- Free the event ID of a delivery received before a point in time, so a later delivery with the same ID is
+-- recorded as a new event. The old delivery keeps its ID with its own row ID appended.
+UPDATE webhook_events
+SET event_id = event_id || '@' || id::TEXT
+WHERE provider = $1 AND event_id = $2 AND received_at < $3;
\ No newline at end of file
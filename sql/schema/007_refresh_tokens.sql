@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- Record which device/client a refresh token (session) belongs to
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip_address TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+
+ALTER TABLE refresh_tokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip_address,
+DROP COLUMN user_agent;
\ No newline at end of file
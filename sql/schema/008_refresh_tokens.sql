@@ -0,0 +1,19 @@
+-- +goose Up
+
+-- Every refresh rotates the token. Tokens issued from the same login share a family,
+-- and each token points to the one it was rotated from.
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD COLUMN parent_id INT DEFAULT NULL REFERENCES refresh_tokens(id) ON DELETE SET NULL,
+ADD COLUMN rotated_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS refresh_tokens_family_id_idx;
+
+ALTER TABLE refresh_tokens
+DROP COLUMN rotated_at,
+DROP COLUMN parent_id,
+DROP COLUMN family_id;
\ No newline at end of file
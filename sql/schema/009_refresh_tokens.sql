@@ -0,0 +1,18 @@
+-- +goose Up
+
+-- Refresh tokens are stored as SHA-256 digests (hex encoded) instead of plaintext.
+-- Existing tokens are converted in place, so current sessions stay valid.
+UPDATE refresh_tokens
+SET refresh_token = encode(digest(refresh_token, 'sha256'), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN refresh_token TO token_hash;
+
+-- +goose Down
+
+-- Digests can't be turned back into tokens - invalidate every existing session instead
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO refresh_token;
+
+UPDATE refresh_tokens
+SET revoked_at = COALESCE(revoked_at, CURRENT_TIMESTAMP);
\ No newline at end of file
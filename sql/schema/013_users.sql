@@ -0,0 +1,12 @@
+-- +goose Up
+-- Accounts are hard-deleted once the grace period after the deletion request has passed
+ALTER TABLE users
+ADD COLUMN deletion_scheduled_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX users_deletion_scheduled_at_idx ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS users_deletion_scheduled_at_idx;
+
+ALTER TABLE users
+DROP COLUMN deletion_scheduled_at;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Personal data exports. The archive is downloaded with a time-limited token, only its SHA-256 digest is stored.
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    download_token_hash TEXT NOT NULL UNIQUE,
+    file_path TEXT DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP DEFAULT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS data_exports;
\ No newline at end of file
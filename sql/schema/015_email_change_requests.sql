@@ -0,0 +1,27 @@
+-- +goose Up
+-- Case-insensitive e-mail addresses, so A@x.com and a@x.com can't both register.
+-- This fails if such duplicates already exist - merge or rename them first.
+CREATE EXTENSION IF NOT EXISTS citext;
+
+ALTER TABLE users
+ALTER COLUMN email TYPE CITEXT;
+
+-- E-mail changes wait for confirmation through a token sent to the new address. Only a SHA-256 digest of the token is stored.
+CREATE TABLE email_change_requests (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    new_email CITEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    confirmed_at TIMESTAMP DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX email_change_requests_user_id_idx ON email_change_requests (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS email_change_requests;
+
+ALTER TABLE users
+ALTER COLUMN email TYPE TEXT;
\ No newline at end of file
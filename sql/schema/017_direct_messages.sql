@@ -0,0 +1,40 @@
+-- +goose Up
+-- Whether message bodies are run through the profanity filter before they're shown to the user
+ALTER TABLE users
+ADD COLUMN profanity_filter BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- One conversation per pair of users - user_a is always the smaller ID, so a pair can only be stored one way
+CREATE TABLE conversations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_a UUID NOT NULL,
+    user_b UUID NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_message_at TIMESTAMP DEFAULT NULL,
+    UNIQUE (user_a, user_b),
+    CHECK (user_a < user_b),
+    FOREIGN KEY (user_a) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_b) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX conversations_user_b_idx ON conversations (user_b);
+
+-- Bodies are stored as sent, the profanity filter is applied when they're read
+CREATE TABLE messages (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    conversation_id UUID NOT NULL,
+    sender_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP DEFAULT NULL,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_created_at_idx ON messages (conversation_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS conversations;
+
+ALTER TABLE users
+DROP COLUMN profanity_filter;
\ No newline at end of file
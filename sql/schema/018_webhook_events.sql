@@ -0,0 +1,20 @@
+-- +goose Up
+-- Every webhook delivery we receive, keyed by the provider's event ID so retried deliveries are only processed once
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    status TEXT NOT NULL DEFAULT 'processing' CHECK (status IN ('processing', 'processed', 'ignored', 'failed')),
+    error TEXT DEFAULT NULL,
+    attempts INTEGER NOT NULL DEFAULT 1,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP DEFAULT NULL,
+    UNIQUE (provider, event_id)
+);
+
+CREATE INDEX webhook_events_status_idx ON webhook_events (status, received_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS webhook_events;
\ No newline at end of file
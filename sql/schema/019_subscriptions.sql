@@ -0,0 +1,41 @@
+-- +goose Up
+-- Chirpy Red subscriptions. A cancelled subscription stays in effect until the end of the paid period,
+-- expired ones no longer grant anything.
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL UNIQUE,
+    plan TEXT NOT NULL DEFAULT 'chirpy_red',
+    status TEXT NOT NULL CHECK (status IN ('active', 'cancelled', 'expired')),
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    cancelled_at TIMESTAMP DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX subscriptions_status_period_end_idx ON subscriptions (status, current_period_end);
+
+-- Upgrades recorded before subscriptions existed never ran out, so they keep Chirpy Red with a period
+-- that doesn't end
+INSERT INTO subscriptions (user_id, status, current_period_start, current_period_end)
+SELECT id, 'active', NOW(), TIMESTAMP '9999-12-31 23:59:59'
+FROM users
+WHERE is_chirpy_red;
+
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
+
+-- +goose Down
+ALTER TABLE users
+ADD COLUMN is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE users
+SET is_chirpy_red = TRUE
+WHERE id IN (
+    SELECT user_id
+    FROM subscriptions
+    WHERE status IN ('active', 'cancelled') AND current_period_end > NOW()
+);
+
+DROP TABLE IF EXISTS subscriptions;
\ No newline at end of file
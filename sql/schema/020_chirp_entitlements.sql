@@ -0,0 +1,28 @@
+-- +goose Up
+-- Media attachments are links to files hosted elsewhere
+ALTER TABLE chirps
+ADD COLUMN media_urls TEXT[] NOT NULL DEFAULT '{}';
+
+-- Chirps waiting to be published - they're moved to chirps once publish_at has passed
+CREATE TABLE scheduled_chirps (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    body TEXT NOT NULL,
+    media_urls TEXT[] NOT NULL DEFAULT '{}',
+    publish_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX scheduled_chirps_publish_at_idx ON scheduled_chirps (publish_at);
+CREATE INDEX scheduled_chirps_user_id_idx ON scheduled_chirps (user_id);
+
+-- Chirp rate limits count a user's recent chirps
+CREATE INDEX chirps_user_id_created_at_idx ON chirps (user_id, created_at);
+
+-- +goose Down
+DROP INDEX IF EXISTS chirps_user_id_created_at_idx;
+DROP TABLE IF EXISTS scheduled_chirps;
+
+ALTER TABLE chirps
+DROP COLUMN media_urls;
\ No newline at end of file
@@ -0,0 +1,29 @@
+-- +goose Up
+-- Outbox of domain events, written in the same transaction as the change they describe.
+-- sequence orders the events of an aggregate - created_at is the same for every row of a transaction.
+CREATE TABLE domain_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sequence BIGSERIAL NOT NULL UNIQUE,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    dispatched_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX domain_events_pending_idx ON domain_events (aggregate_type, aggregate_id, sequence) WHERE dispatched_at IS NULL;
+CREATE INDEX domain_events_dispatched_at_idx ON domain_events (dispatched_at) WHERE dispatched_at IS NOT NULL;
+
+-- Webhook deliveries are queued by a domain event subscriber, which runs again when an event is retried
+ALTER TABLE webhook_deliveries
+ADD CONSTRAINT webhook_deliveries_endpoint_event_key UNIQUE (endpoint_id, event_id);
+
+-- +goose Down
+ALTER TABLE webhook_deliveries
+DROP CONSTRAINT IF EXISTS webhook_deliveries_endpoint_event_key;
+
+DROP TABLE IF EXISTS domain_events;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- +goose Up
+-- When an event was last taken up for processing - a crash before its outcome is recorded leaves it processing,
+-- and claims older than a lease can be taken over by retries and replays
+ALTER TABLE webhook_events
+ADD COLUMN claimed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE webhook_events
+DROP COLUMN IF EXISTS claimed_at;
\ No newline at end of file
@@ -0,0 +1,15 @@
+-- +goose Up
+-- Events whose subscribers keep failing are given up on after a number of attempts. A dead event stays
+-- for inspection, and no longer holds back the later events of its aggregate.
+ALTER TABLE domain_events
+ADD COLUMN dead_at TIMESTAMP DEFAULT NULL;
+
+DROP INDEX IF EXISTS domain_events_pending_idx;
+CREATE INDEX domain_events_pending_idx ON domain_events (aggregate_type, aggregate_id, sequence) WHERE dispatched_at IS NULL AND dead_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS domain_events_pending_idx;
+CREATE INDEX domain_events_pending_idx ON domain_events (aggregate_type, aggregate_id, sequence) WHERE dispatched_at IS NULL;
+
+ALTER TABLE domain_events
+DROP COLUMN IF EXISTS dead_at;
\ No newline at end of file
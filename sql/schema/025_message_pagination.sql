@@ -0,0 +1,8 @@
+-- +goose Up
+-- Messages are paged by (created_at, id), so messages sent at the same time aren't skipped between pages
+DROP INDEX IF EXISTS messages_conversation_id_created_at_idx;
+CREATE INDEX messages_conversation_id_created_at_id_idx ON messages (conversation_id, created_at, id);
+
+-- +goose Down
+DROP INDEX IF EXISTS messages_conversation_id_created_at_id_idx;
+CREATE INDEX messages_conversation_id_created_at_idx ON messages (conversation_id, created_at);
\ No newline at end of file
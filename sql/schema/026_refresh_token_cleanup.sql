@@ -0,0 +1,23 @@
+-- +goose Up
+-- Rotated tokens are kept until their session ends, so a stolen token replayed late in a session
+-- still revokes the family instead of not being found. Rotated tokens keep the sign-in time of
+-- their session, so created_at alone would delete them 3 days after sign-in.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION delete_old_revoked_tokens()
+RETURNS VOID AS $$
+BEGIN
+    DELETE FROM refresh_tokens t
+    WHERE t.revoked_at IS NOT NULL
+        AND t.created_at < NOW() - INTERVAL '3 days'
+        AND NOT EXISTS (
+            SELECT 1
+            FROM refresh_tokens f
+            WHERE f.family_id = t.family_id AND f.revoked_at IS NULL AND f.expires_at > NOW()
+        );
+END; $$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+CREATE OR REPLACE FUNCTION delete_old_revoked_tokens()
+RETURNS VOID AS $$
+BEGIN DELETE FROM refresh_tokens WHERE revoked_at IS NOT NULL AND created_at < NOW() - INTERVAL '3 days'; END; $$ LANGUAGE plpgsql;
\ No newline at end of file
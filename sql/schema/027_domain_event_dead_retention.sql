@@ -0,0 +1,6 @@
+-- +goose Up
+-- Dead events are deleted once they're past their retention period too
+CREATE INDEX domain_events_dead_at_idx ON domain_events (dead_at) WHERE dead_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS domain_events_dead_at_idx;
\ No newline at end of file